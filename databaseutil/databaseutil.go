@@ -1,13 +1,15 @@
 /*
 Package databaseutil abstracts away details about sql and postgres.
 
-These functions only accept and return primitive types.
+These functions only accept and return primitive types, or plain rows built from them.
 */
 package databaseutil
 
 import (
 	"database/sql"
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -24,6 +26,18 @@ var QueryResultContainedMultipleRowsError = errors.New("query result unexpectedl
 // QueryResultContainedNoRowsError is returned when a query unexpectedly returns no rows.
 var QueryResultContainedNoRowsError = errors.New("query result unexpectedly contained no rows")
 
+// NoteAlreadyPublishedError is returned when modifying a note that belongs to a publication
+// or answers a question.
+var NoteAlreadyPublishedError = errors.New("note already belongs to a publication")
+
+var ForeignKeyConstraintError = errors.New("postgres: foreign key constraint violation")
+
+var ClubLeftWithoutOrganizerError = errors.New("club would be left with members but no organizer")
+
+var ClubInviteNotUsableError = errors.New("club invite was revoked, has expired or has no uses left")
+
+var NoteCommentingLockedError = errors.New("note comments are locked")
+
 // ConnectToDatabase also pings the database to ensure a working connection.
 func ConnectToDatabase(databaseUrl string) error {
 	{
@@ -65,6 +79,36 @@ func InsertIntoUserTable(
 	return nil
 }
 
+// InsertUserRedeemingClubInvite creates a user and makes them a member of the invite's club in one step.
+// It returns ClubInviteNotUsableError, without creating the user, if the invite cannot be used anymore.
+func InsertUserRedeemingClubInvite(
+	displayName string,
+	emailAddress string,
+	password []byte,
+	creationTime time.Time,
+	inviteId int64,
+) error {
+	return withTransaction(func(tx *sql.Tx) error {
+		sqlQuery := `
+			INSERT INTO app_user (display_name, email_address, password, creation_time)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id`
+
+		var userId int64
+		if err := tx.QueryRow(
+			sqlQuery,
+			displayName,
+			emailAddress,
+			password,
+			creationTime,
+		).Scan(&userId); err != nil {
+			return err
+		}
+
+		return redeemClubInvite(tx, inviteId, userId, creationTime)
+	})
+}
+
 func GetPasswordForUserWithEmailAddress(emailAddress string) ([]byte, error) {
 	sqlQuery := `
 		SELECT password FROM app_user
@@ -94,47 +138,209 @@ func GetPasswordForUserWithEmailAddress(emailAddress string) ([]byte, error) {
 	return password, nil
 }
 
-func InsertNewNote(authorId int64, content string, creationTime time.Time) (int64, error) {
-	sqlQuery := `
-		INSERT INTO note (author_id, content, creation_time)
-		VALUES ($1, $2, $3)
-		RETURNING id`
+// InsertNewNote also records the note's initial content as its first revision.
+// bookId is nil for notes that are not about any book.
+// It returns ForeignKeyConstraintError if no such book exists.
+func InsertNewNote(authorId int64, bookId *int64, content string, creationTime time.Time) (int64, error) {
+	var noteId int64 = 0
 
-	rows, err := db.Query(sqlQuery, authorId, content, creationTime)
-	if err != nil {
-		return 0, convertPostgresError(err)
+	if err := withTransaction(func(tx *sql.Tx) error {
+		insertedNoteId, err := insertNote(tx, authorId, bookId, content, creationTime)
+		noteId = insertedNoteId
+		return err
+	}); err != nil {
+		return 0, err
 	}
-	defer rows.Close()
 
+	return noteId, nil
+}
+
+// InsertAnswerNote inserts a note answering the given question note.
+// The answer is about the same book as the question.
+func InsertAnswerNote(
+	questionNoteId int64,
+	authorId int64,
+	bookId *int64,
+	content string,
+	creationTime time.Time,
+) (int64, error) {
 	var noteId int64 = 0
-	for rows.Next() {
 
-		if noteId != 0 {
-			return 0, QueryResultContainedMultipleRowsError
+	if err := withTransaction(func(tx *sql.Tx) error {
+		insertedNoteId, err := insertNote(tx, authorId, bookId, content, creationTime)
+		if err != nil {
+			return err
 		}
+		noteId = insertedNoteId
 
-		if err := rows.Scan(&noteId); err != nil {
-			return 0, convertPostgresError(err)
+		sqlQuery := `
+			INSERT INTO question_answer (answer_note_id, question_note_id)
+			VALUES ($1, $2)`
+
+		_, err = tx.Exec(sqlQuery, noteId, questionNoteId)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	return noteId, nil
+}
+
+// GetAnswersToQuestion returns the undeleted answers to a question note, oldest first.
+func GetAnswersToQuestion(questionNoteId int64) ([]*NoteRow, error) {
+	sqlQuery := selectNoteRowsQuery + `
+		WHERE question_answer.question_note_id = $1
+			AND note.deletion_time IS NULL
+		ORDER BY note.creation_time, note.id`
+
+	return queryNoteRows(sqlQuery, questionNoteId)
+}
+
+// UpsertAcceptedAnswer replaces any answer the question had accepted before.
+// It fails if the answer does not answer this question.
+func UpsertAcceptedAnswer(questionNoteId int64, answerNoteId int64) error {
+	sqlQuery := `
+		INSERT INTO question_accepted_answer (question_note_id, answer_note_id)
+		VALUES ($1, $2)
+		ON CONFLICT (question_note_id) DO UPDATE SET answer_note_id = EXCLUDED.answer_note_id`
+
+	if _, err := db.Exec(sqlQuery, questionNoteId, answerNoteId); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// DeleteAcceptedAnswer does nothing if the question has no accepted answer.
+func DeleteAcceptedAnswer(questionNoteId int64) error {
+	sqlQuery := `
+		DELETE FROM question_accepted_answer
+		WHERE question_note_id = $1`
+
+	if _, err := db.Exec(sqlQuery, questionNoteId); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// UpdateNoteContent replaces the content of a note and records the new content as a revision.
+// NoteAlreadyPublishedError is returned if the note belongs to a publication.
+func UpdateNoteContent(noteId int64, content string, editTime time.Time) error {
+	return withTransaction(func(tx *sql.Tx) error {
+		// Locking the note row blocks any publication from claiming the note until we finish.
+		if err := lockNoteRowIfUnpublished(tx, noteId); err != nil {
+			return err
+		}
+
+		sqlQuery := `
+			UPDATE note SET content = $2
+			WHERE id = $1`
+
+		if _, err := tx.Exec(sqlQuery, noteId, content); err != nil {
+			return err
 		}
+
+		return insertNoteRevision(tx, noteId, content, editTime)
+	})
+}
+
+// UpdateNoteBook moves a note to another book, or to no book when bookId is nil.
+// The note's location is cleared, since it referred to the old book.
+// NoteAlreadyPublishedError is returned if the note belongs to a publication,
+// and ForeignKeyConstraintError if no such book exists.
+func UpdateNoteBook(noteId int64, bookId *int64) error {
+	return withTransaction(func(tx *sql.Tx) error {
+		if err := lockNoteRowIfUnpublished(tx, noteId); err != nil {
+			return err
+		}
+
+		{
+			sqlQuery := `
+				UPDATE note SET book_id = $2
+				WHERE id = $1`
+
+			if _, err := tx.Exec(sqlQuery, noteId, bookId); err != nil {
+				return err
+			}
+		}
+
+		sqlQuery := `
+			DELETE FROM note_location
+			WHERE note_id = $1`
+
+		_, err := tx.Exec(sqlQuery, noteId)
+		return err
+	})
+}
+
+// UpsertNoteLocation replaces the note's location if it already has one.
+// At least one of chapter, page and percent must be set.
+func UpsertNoteLocation(noteId int64, chapter *int64, page *int64, percent *float64) error {
+	sqlQuery := `
+		INSERT INTO note_location (note_id, chapter, page, percent)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (note_id) DO UPDATE
+			SET chapter = EXCLUDED.chapter, page = EXCLUDED.page, percent = EXCLUDED.percent`
+
+	_, err := db.Exec(sqlQuery, noteId, chapter, page, percent)
+	return convertPostgresError(err)
+}
+
+func DeleteNoteLocation(noteId int64) error {
+	sqlQuery := `
+		DELETE FROM note_location
+		WHERE note_id = $1`
+
+	_, err := db.Exec(sqlQuery, noteId)
+	return convertPostgresError(err)
+}
+
+// NoteRevisionRow holds one stored version of a note's content.
+type NoteRevisionRow struct {
+	Content      string
+	CreationTime time.Time
+}
+
+// GetNoteRevisions returns every revision of a note, oldest first.
+func GetNoteRevisions(noteId int64) ([]*NoteRevisionRow, error) {
+	sqlQuery := `
+		SELECT content, creation_time FROM note_revision
+		WHERE note_id = $1
+		ORDER BY creation_time, id`
+
+	rows, err := db.Query(sqlQuery, noteId)
+	if err != nil {
+		return nil, convertPostgresError(err)
 	}
+	defer rows.Close()
 
-	if noteId == 0 {
-		return 0, QueryResultContainedNoRowsError
+	revisionRows := make([]*NoteRevisionRow, 0)
+	for rows.Next() {
+		revisionRow := new(NoteRevisionRow)
+
+		if err := rows.Scan(&revisionRow.Content, &revisionRow.CreationTime); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		revisionRows = append(revisionRows, revisionRow)
 	}
 
 	if err := rows.Err(); err != nil {
-		return 0, convertPostgresError(err)
+		return nil, convertPostgresError(err)
 	}
 
-	return noteId, nil
+	return revisionRows, nil
 }
 
-func InsertNoteCategoryRelationship(noteId int64, category string) error {
+// UpsertNoteCategoryRelationship replaces the note's category if it already has one.
+func UpsertNoteCategoryRelationship(noteId int64, categoryId int64) error {
 	sqlQuery := `
-		INSERT INTO note_to_category_relationship (note_id, category)
-		VALUES ($1, $2)`
+		INSERT INTO note_to_category_relationship (note_id, category_id)
+		VALUES ($1, $2)
+		ON CONFLICT (note_id) DO UPDATE SET category_id = EXCLUDED.category_id`
 
-	rows, err := db.Query(sqlQuery, noteId, category)
+	rows, err := db.Query(sqlQuery, noteId, categoryId)
 	if err != nil {
 		return convertPostgresError(err)
 	}
@@ -147,43 +353,3013 @@ func InsertNoteCategoryRelationship(noteId int64, category string) error {
 	return nil
 }
 
-func GetIdForUserWithEmailAddress(emailAddress string) (int64, error) {
+// GetNoteById returns QueryResultContainedNoRowsError if no such note exists or the note is deleted.
+func GetNoteById(noteId int64) (*NoteRow, error) {
+	sqlQuery := selectNoteRowsQuery + `
+		WHERE note.id = $1
+			AND note.deletion_time IS NULL`
+
+	noteRows, err := queryNoteRows(sqlQuery, noteId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(noteRows) > 1 {
+		return nil, QueryResultContainedMultipleRowsError
+	}
+
+	if len(noteRows) == 0 {
+		return nil, QueryResultContainedNoRowsError
+	}
+
+	return noteRows[0], nil
+}
+
+// isNotePublicCondition holds for notes that anyone may read: notes whose publication has gone live,
+// and answers to questions whose publication has gone live.
+const isNotePublicCondition = `(
+			publication.publication_time IS NOT NULL
+			OR EXISTS (
+				SELECT 1 FROM note AS question_note
+				INNER JOIN note_to_publication_relationship AS question_publication_relationship
+					ON question_publication_relationship.note_id = question_note.id
+				INNER JOIN publication AS question_publication
+					ON question_publication.id = question_publication_relationship.publication_id
+				WHERE question_note.id = question_answer.question_note_id
+					AND question_note.deletion_time IS NULL
+					AND question_publication.publication_time IS NOT NULL
+			)
+		)`
+
+// selectNoteRowsQuery selects the columns of NoteRow, in order, and is meant to be followed by a WHERE clause.
+const selectNoteRowsQuery = `
+		SELECT
+			note.id,
+			note.author_id,
+			note.content,
+			note.creation_time,
+			COALESCE(note.book_id, 0),
+			COALESCE(note_to_category_relationship.category_id, 0),
+			COALESCE(category.name, ''),
+			COALESCE(category.sort_order, 0),
+			COALESCE(note_to_publication_relationship.publication_id, 0),
+			publication.publication_time,
+			note.deletion_time,
+			ARRAY(
+				SELECT tag.name FROM tag
+				INNER JOIN note_to_tag_relationship
+					ON note_to_tag_relationship.tag_id = tag.id
+				WHERE note_to_tag_relationship.note_id = note.id
+				ORDER BY tag.name
+			),
+			note_location.chapter,
+			note_location.page,
+			note_location.percent,
+			prediction.confidence,
+			prediction.outcome::text,
+			COALESCE(question_answer.question_note_id, 0),
+			(
+				SELECT COUNT(*) FROM question_answer AS answer_relationship
+				INNER JOIN note AS answer_note
+					ON answer_note.id = answer_relationship.answer_note_id
+				WHERE answer_relationship.question_note_id = note.id
+					AND answer_note.deletion_time IS NULL
+			),
+			COALESCE(question_accepted_answer.answer_note_id, 0),
+			(
+				SELECT COUNT(*) FROM note_comment
+				WHERE note_comment.note_id = note.id
+					AND note_comment.deletion_time IS NULL
+			),
+			note_comment_lock.note_id IS NOT NULL,
+			` + isNotePublicCondition + `
+		FROM note
+		LEFT JOIN note_location
+			ON note_location.note_id = note.id
+		LEFT JOIN note_to_category_relationship
+			ON note_to_category_relationship.note_id = note.id
+		LEFT JOIN category
+			ON category.id = note_to_category_relationship.category_id
+		LEFT JOIN note_to_publication_relationship
+			ON note_to_publication_relationship.note_id = note.id
+		LEFT JOIN publication
+			ON publication.id = note_to_publication_relationship.publication_id
+		LEFT JOIN prediction
+			ON prediction.note_id = note.id
+		LEFT JOIN question_answer
+			ON question_answer.answer_note_id = note.id
+		LEFT JOIN question_accepted_answer
+			ON question_accepted_answer.question_note_id = note.id
+		LEFT JOIN note_comment_lock
+			ON note_comment_lock.note_id = note.id
+`
+
+// NoteRow holds the columns of a note joined with its category and publication.
+// BookId, CategoryId and PublicationId are 0 when the note has none.
+// CategoryName and CategorySortOrder come from the note's category, and are zero values without one.
+// PublicationTime stays nil until the note's publication goes live.
+// The location fields are nil where the note's place in its book is unknown.
+// PredictionConfidence and PredictionOutcome are nil unless set on a prediction.
+// QuestionId is the question the note answers, and AcceptedAnswerId the answer it accepted, or 0.
+// CommentCount leaves out deleted comments.
+// IsPublic tells whether anyone may read the note, not only its author.
+type NoteRow struct {
+	Id                int64
+	AuthorId          int64
+	Content           string
+	CreationTime      time.Time
+	BookId            int64
+	CategoryId        int64
+	CategoryName      string
+	CategorySortOrder int
+	PublicationId     int64
+	PublicationTime   *time.Time
+	DeletionTime      *time.Time
+	Tags              []string
+
+	LocationChapter *int64
+	LocationPage    *int64
+	LocationPercent *float64
+
+	PredictionConfidence *int64
+	PredictionOutcome    *string
+
+	QuestionId       int64
+	AnswerCount      int
+	AcceptedAnswerId int64
+
+	CommentCount       int
+	IsCommentingLocked bool
+
+	IsPublic bool
+}
+
+// NoteListingOptions narrows down and pages GetNotesVisibleToUser.
+// Nil fields do not filter anything.
+// The location ranges are inclusive and leave out notes whose location lacks that field.
+type NoteListingOptions struct {
+	AuthorId      *int64
+	BookId        *int64
+	CategoryId    *int64
+	CreatedAfter  *time.Time // inclusive
+	CreatedBefore *time.Time // exclusive
+	IsPublished   *bool
+	TagName       *string
+	// only questions, in the category QuestionCategoryId, with or without an accepted answer
+	IsAnswered         *bool
+	QuestionCategoryId int64
+
+	MinChapter *int64
+	MaxChapter *int64
+	MinPage    *int64
+	MaxPage    *int64
+	MinPercent *float64
+	MaxPercent *float64
+
+	// Reading order sorts by chapter, then page, then percent, each with unknown values last,
+	// and then oldest first. Otherwise notes are sorted newest first.
+	InReadingOrder bool
+
+	// Keyset cursor: only notes strictly after this (creation time, id) pair are returned.
+	// In reading order the cursor also holds the location of the last note returned.
+	CursorCreationTime *time.Time
+	CursorId           int64
+	CursorChapter      *int64
+	CursorPage         *int64
+	CursorPercent      *float64
+
+	// 0 returns every matching note
+	Limit int
+}
+
+// readingOrderColumns sorts notes without a chapter, page or percent after those that have one.
+const readingOrderColumns = `
+			COALESCE(note_location.chapter, 2147483647),
+			COALESCE(note_location.page, 2147483647),
+			COALESCE(note_location.percent, 101),
+			note.creation_time,
+			note.id`
+
+// GetNotesVisibleToUser returns the user's own notes along with the notes of the members of the user's clubs
+// whose publication has gone live, newest first unless options ask for reading order.
+func GetNotesVisibleToUser(userId int64, options *NoteListingOptions) ([]*NoteRow, error) {
+	builder := new(queryBuilder)
+
+	builder.addCondition("note.deletion_time IS NULL")
+	userIdArgument := builder.addArgument(userId)
+	builder.addCondition(
+		"(note.author_id = " + userIdArgument + " OR (" +
+			isNotePublicCondition + " AND " + sharesClubCondition(userIdArgument, "note.author_id") + "))")
+
+	if options.AuthorId != nil {
+		builder.addCondition("note.author_id = " + builder.addArgument(*options.AuthorId))
+	}
+
+	if options.BookId != nil {
+		builder.addCondition("note.book_id = " + builder.addArgument(*options.BookId))
+	}
+
+	if options.CategoryId != nil {
+		builder.addCondition(
+			"note_to_category_relationship.category_id = " + builder.addArgument(*options.CategoryId))
+	}
+
+	if options.CreatedAfter != nil {
+		builder.addCondition("note.creation_time >= " + builder.addArgument(*options.CreatedAfter))
+	}
+
+	if options.CreatedBefore != nil {
+		builder.addCondition("note.creation_time < " + builder.addArgument(*options.CreatedBefore))
+	}
+
+	// the same notes count as published here as when editing or trashing them
+	if options.IsPublished != nil {
+		if *options.IsPublished {
+			builder.addCondition(isNotePublishedCondition)
+		} else {
+			builder.addCondition("NOT " + isNotePublishedCondition)
+		}
+	}
+
+	if options.IsAnswered != nil {
+		builder.addCondition(
+			"note_to_category_relationship.category_id = " + builder.addArgument(options.QuestionCategoryId))
+
+		if *options.IsAnswered {
+			builder.addCondition("question_accepted_answer.answer_note_id IS NOT NULL")
+		} else {
+			builder.addCondition("question_accepted_answer.answer_note_id IS NULL")
+		}
+	}
+
+	if options.TagName != nil {
+		builder.addCondition(`EXISTS (
+				SELECT 1 FROM note_to_tag_relationship
+				INNER JOIN tag ON tag.id = note_to_tag_relationship.tag_id
+				WHERE note_to_tag_relationship.note_id = note.id
+					AND tag.name = ` + builder.addArgument(*options.TagName) + `
+			)`)
+	}
+
+	for _, locationBound := range []struct {
+		condition string
+		bound     interface{}
+		isSet     bool
+	}{
+		{"note_location.chapter >= ", options.MinChapter, options.MinChapter != nil},
+		{"note_location.chapter <= ", options.MaxChapter, options.MaxChapter != nil},
+		{"note_location.page >= ", options.MinPage, options.MinPage != nil},
+		{"note_location.page <= ", options.MaxPage, options.MaxPage != nil},
+		{"note_location.percent >= ", options.MinPercent, options.MinPercent != nil},
+		{"note_location.percent <= ", options.MaxPercent, options.MaxPercent != nil},
+	} {
+		if locationBound.isSet {
+			builder.addCondition(locationBound.condition + builder.addArgument(locationBound.bound))
+		}
+	}
+
+	orderByClause := `
+		ORDER BY note.creation_time DESC, note.id DESC`
+
+	if options.InReadingOrder {
+		if options.CursorCreationTime != nil {
+			builder.addCondition(
+				"(" + readingOrderColumns + ") > (" +
+					"COALESCE(" + builder.addArgument(options.CursorChapter) + "::integer, 2147483647), " +
+					"COALESCE(" + builder.addArgument(options.CursorPage) + "::integer, 2147483647), " +
+					"COALESCE(" + builder.addArgument(options.CursorPercent) + "::double precision, 101), " +
+					builder.addArgument(*options.CursorCreationTime) + ", " +
+					builder.addArgument(options.CursorId) + ")")
+		}
+
+		orderByClause = `
+		ORDER BY` + readingOrderColumns
+	} else if options.CursorCreationTime != nil {
+		builder.addCondition(
+			"(note.creation_time, note.id) < (" +
+				builder.addArgument(*options.CursorCreationTime) + ", " +
+				builder.addArgument(options.CursorId) + ")")
+	}
+
+	sqlQuery := selectNoteRowsQuery + builder.whereClause() + orderByClause
+
+	if options.Limit > 0 {
+		sqlQuery += `
+		LIMIT ` + builder.addArgument(options.Limit)
+	}
+
+	return queryNoteRows(sqlQuery, builder.arguments...)
+}
+
+// GetNotesByIds returns the undeleted notes among the given ones, in no particular order.
+func GetNotesByIds(noteIds []int64) ([]*NoteRow, error) {
+	sqlQuery := selectNoteRowsQuery + `
+		WHERE note.id = ANY($1)
+			AND note.deletion_time IS NULL`
+
+	return queryNoteRows(sqlQuery, pq.Array(noteIds))
+}
+
+// GetDeletedNotesByAuthor returns the author's soft-deleted notes that have not been purged yet.
+func GetDeletedNotesByAuthor(authorId int64) ([]*NoteRow, error) {
+	sqlQuery := selectNoteRowsQuery + `
+		WHERE note.author_id = $1
+			AND note.deletion_time IS NOT NULL`
+
+	return queryNoteRows(sqlQuery, authorId)
+}
+
+// MarkNoteDeleted returns QueryResultContainedNoRowsError if no undeleted note has the given id,
+// and NoteAlreadyPublishedError if the note belongs to a publication.
+func MarkNoteDeleted(noteId int64, deletionTime time.Time) error {
+	return withTransaction(func(tx *sql.Tx) error {
+		if err := lockNoteRowIfUnpublished(tx, noteId); err != nil {
+			return err
+		}
+
+		sqlQuery := `
+			UPDATE note SET deletion_time = $2
+			WHERE id = $1`
+
+		_, err := tx.Exec(sqlQuery, noteId, deletionTime)
+		return err
+	})
+}
+
+// RestoreDeletedNote returns QueryResultContainedNoRowsError if the author has no deleted note with the given id.
+func RestoreDeletedNote(noteId int64, authorId int64) error {
 	sqlQuery := `
-		SELECT id FROM app_user
-		WHERE email_address = $1`
+		UPDATE note SET deletion_time = NULL
+		WHERE id = $1
+			AND author_id = $2
+			AND deletion_time IS NOT NULL`
 
-	rows, err := db.Query(sqlQuery, emailAddress)
+	return execExpectingOneRow(sqlQuery, noteId, authorId)
+}
+
+// PurgeNotesDeletedBefore permanently removes the notes deleted before the cutoff,
+// along with every row that refers to them, and returns how many notes were removed.
+func PurgeNotesDeletedBefore(cutoffTime time.Time) (int64, error) {
+	var purgedNoteCount int64 = 0
+
+	if err := withTransaction(func(tx *sql.Tx) error {
+		noteIds := make([]int64, 0)
+		{
+			sqlQuery := `
+				SELECT id FROM note
+				WHERE deletion_time < $1
+				FOR UPDATE`
+
+			rows, err := tx.Query(sqlQuery, cutoffTime)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var noteId int64
+				if err := rows.Scan(&noteId); err != nil {
+					return err
+				}
+
+				noteIds = append(noteIds, noteId)
+			}
+
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+
+		if len(noteIds) == 0 {
+			return nil
+		}
+
+		for _, sqlQuery := range []string{
+			`DELETE FROM note_revision WHERE note_id = ANY($1)`,
+			`DELETE FROM note_to_category_relationship WHERE note_id = ANY($1)`,
+			`DELETE FROM note_to_tag_relationship WHERE note_id = ANY($1)`,
+			`DELETE FROM note_location WHERE note_id = ANY($1)`,
+			`DELETE FROM prediction WHERE note_id = ANY($1)`,
+			`DELETE FROM note_reaction WHERE note_id = ANY($1)`,
+			`DELETE FROM mention WHERE note_id = ANY($1)`,
+			`DELETE FROM note_comment WHERE note_id = ANY($1)`,
+			`DELETE FROM note_comment_lock WHERE note_id = ANY($1)`,
+			`DELETE FROM question_accepted_answer
+				WHERE question_note_id = ANY($1) OR answer_note_id = ANY($1)`,
+			`DELETE FROM question_answer
+				WHERE answer_note_id = ANY($1) OR question_note_id = ANY($1)`,
+			`DELETE FROM note_to_publication_relationship WHERE note_id = ANY($1)`,
+			`DELETE FROM note WHERE id = ANY($1)`,
+		} {
+			if _, err := tx.Exec(sqlQuery, pq.Array(noteIds)); err != nil {
+				return err
+			}
+		}
+
+		purgedNoteCount = int64(len(noteIds))
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return purgedNoteCount, nil
+}
+
+// DeleteNoteCategoryRelationship does nothing if the note has no category.
+func DeleteNoteCategoryRelationship(noteId int64) error {
+	sqlQuery := `
+		DELETE FROM note_to_category_relationship
+		WHERE note_id = $1`
+
+	if _, err := db.Exec(sqlQuery, noteId); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// InsertNoteTagRelationship creates the tag if nobody has used it before.
+// Attaching a tag the note already has does nothing.
+func InsertNoteTagRelationship(noteId int64, tagName string) error {
+	sqlQuery := `
+		WITH upserted_tag AS (
+			INSERT INTO tag (name) VALUES ($2)
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id
+		)
+		INSERT INTO note_to_tag_relationship (note_id, tag_id)
+		SELECT $1, id FROM upserted_tag
+		ON CONFLICT DO NOTHING`
+
+	if _, err := db.Exec(sqlQuery, noteId, tagName); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// DeleteNoteTagRelationship does nothing if the note does not have the tag.
+func DeleteNoteTagRelationship(noteId int64, tagName string) error {
+	sqlQuery := `
+		DELETE FROM note_to_tag_relationship
+		USING tag
+		WHERE tag.id = note_to_tag_relationship.tag_id
+			AND note_to_tag_relationship.note_id = $1
+			AND tag.name = $2`
+
+	if _, err := db.Exec(sqlQuery, noteId, tagName); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// GetTagNamesUsedByAuthor returns the names of the tags on the author's notes that start with the prefix,
+// most used first.
+func GetTagNamesUsedByAuthor(authorId int64, prefix string, limit int) ([]string, error) {
+	sqlQuery := `
+		SELECT tag.name FROM tag
+		INNER JOIN note_to_tag_relationship
+			ON note_to_tag_relationship.tag_id = tag.id
+		INNER JOIN note
+			ON note.id = note_to_tag_relationship.note_id
+		WHERE note.author_id = $1
+			AND note.deletion_time IS NULL
+			AND tag.name LIKE $2 ESCAPE '\'
+		GROUP BY tag.name
+		ORDER BY COUNT(*) DESC, tag.name
+		LIMIT $3`
+
+	likePattern := likePatternEscaper.Replace(prefix) + "%"
+
+	rows, err := db.Query(sqlQuery, authorId, likePattern, limit)
 	if err != nil {
-		return 0, convertPostgresError(err)
+		return nil, convertPostgresError(err)
 	}
 	defer rows.Close()
 
-	var userId int64
+	tagNames := make([]string, 0)
 	for rows.Next() {
-		if userId != 0 {
-			return 0, QueryResultContainedMultipleRowsError
+		var tagName string
+		if err := rows.Scan(&tagName); err != nil {
+			return nil, convertPostgresError(err)
 		}
 
-		if err := rows.Scan(&userId); err != nil {
-			return 0, err
+		tagNames = append(tagNames, tagName)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return tagNames, nil
+}
+
+// GetUnpublishedNoteIdsByAuthor returns the ids of the author's notes about the book
+// that are neither published nor deleted. Answers count as published.
+func GetUnpublishedNoteIdsByAuthor(authorId int64, bookId int64) ([]int64, error) {
+	sqlQuery := `
+		SELECT note.id FROM note
+		WHERE note.author_id = $1
+			AND note.book_id = $2
+			AND note.deletion_time IS NULL
+			AND NOT ` + isNotePublishedCondition + `
+		ORDER BY note.creation_time, note.id`
+
+	rows, err := db.Query(sqlQuery, authorId, bookId)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	noteIds := make([]int64, 0)
+	for rows.Next() {
+		var noteId int64
+		if err := rows.Scan(&noteId); err != nil {
+			return nil, convertPostgresError(err)
 		}
+
+		noteIds = append(noteIds, noteId)
 	}
 
-	if userId == 0 {
-		return 0, QueryResultContainedNoRowsError
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
 	}
 
-	return userId, nil
+	return noteIds, nil
 }
 
-// PRIVATE
+// InsertPublication creates a publication holding the given notes in a single transaction.
+// The publication goes live right away when publicationTime is set, and is left for
+// PublishDuePublications otherwise.
+// It returns QueryResultContainedNoRowsError if any of the notes is deleted, not written by the author
+// or not about the book, and NoteAlreadyPublishedError if any of them already belongs to a publication
+// or answers a question.
+func InsertPublication(
+	authorId int64,
+	bookId int64,
+	milestoneId *int64,
+	title string,
+	introMessage string,
+	creationTime time.Time,
+	publishAt time.Time,
+	publicationTime *time.Time,
+	noteIds []int64,
+) (int64, error) {
+	var publicationId int64 = 0
+
+	if err := withTransaction(func(tx *sql.Tx) error {
+		{
+			sqlQuery := `
+				SELECT COUNT(*) FROM (
+					SELECT id FROM note
+					WHERE id = ANY($1)
+						AND author_id = $2
+						AND book_id = $3
+						AND deletion_time IS NULL
+					FOR UPDATE
+				) AS locked_note`
+
+			var lockedNoteCount int
+			if err := tx.QueryRow(
+				sqlQuery,
+				pq.Array(noteIds),
+				authorId,
+				bookId,
+			).Scan(&lockedNoteCount); err != nil {
+				return err
+			}
+
+			if lockedNoteCount != len(noteIds) {
+				return QueryResultContainedNoRowsError
+			}
+		}
+
+		{
+			sqlQuery := `
+				SELECT EXISTS (
+					SELECT 1 FROM note
+					WHERE id = ANY($1)
+						AND ` + isNotePublishedCondition + `
+				)`
+
+			var isAnyNotePublished bool
+			if err := tx.QueryRow(sqlQuery, pq.Array(noteIds)).Scan(&isAnyNotePublished); err != nil {
+				return err
+			}
+
+			if isAnyNotePublished {
+				return NoteAlreadyPublishedError
+			}
+		}
+
+		{
+			sqlQuery := `
+				INSERT INTO publication (
+					author_id,
+					book_id,
+					milestone_id,
+					title,
+					intro_message,
+					creation_time,
+					publish_at,
+					publication_time
+				)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				RETURNING id`
+
+			if err := tx.QueryRow(
+				sqlQuery,
+				authorId,
+				bookId,
+				milestoneId,
+				title,
+				introMessage,
+				creationTime,
+				publishAt,
+				publicationTime,
+			).Scan(&publicationId); err != nil {
+				return err
+			}
+		}
+
+		{
+			sqlQuery := `
+				INSERT INTO note_to_publication_relationship (note_id, publication_id, author_id, book_id)
+				SELECT unnest($1::bigint[]), $2, $3, $4`
+
+			if _, err := tx.Exec(sqlQuery, pq.Array(noteIds), publicationId, authorId, bookId); err != nil {
+				if convertPostgresError(err) == UniqueConstraintError {
+					return NoteAlreadyPublishedError
+				}
+
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return publicationId, nil
+}
+
+// PublicationRow holds the columns of a publication joined with its author's display name and book title.
+// BookId is 0 and BookTitle empty for publications made before books existed,
+// and MilestoneId is 0 and MilestoneTitle empty for publications not attached to a milestone.
+// PublicationTime is nil while the publication is scheduled, and RetractionTime is nil unless it was retracted.
+type PublicationRow struct {
+	Id                int64
+	AuthorId          int64
+	AuthorDisplayName string
+	BookId            int64
+	BookTitle         string
+	MilestoneId       int64
+	MilestoneTitle    string
+	CreationTime      time.Time
+	PublishAt         time.Time
+	PublicationTime   *time.Time
+	RetractionTime    *time.Time
+	Title             string
+	IntroMessage      string
+}
+
+// PublicationListingOptions narrows down GetLivePublications. Nil fields do not filter anything.
+type PublicationListingOptions struct {
+	BookId          *int64
+	MilestoneId     *int64
+	PublishedAfter  *time.Time // inclusive
+	PublishedBefore *time.Time // exclusive
+}
+
+// GetLivePublications returns every publication by the user or by the members of the user's clubs
+// that has gone live, most recently published first.
+func GetLivePublications(userId int64, options *PublicationListingOptions) ([]*PublicationRow, error) {
+	builder := new(queryBuilder)
+
+	builder.addCondition("publication.publication_time IS NOT NULL")
+
+	userIdArgument := builder.addArgument(userId)
+	builder.addCondition(
+		"(publication.author_id = " + userIdArgument + " OR " +
+			sharesClubCondition(userIdArgument, "publication.author_id") + ")")
+
+	if options.BookId != nil {
+		builder.addCondition("publication.book_id = " + builder.addArgument(*options.BookId))
+	}
+
+	if options.MilestoneId != nil {
+		builder.addCondition("publication.milestone_id = " + builder.addArgument(*options.MilestoneId))
+	}
+
+	if options.PublishedAfter != nil {
+		builder.addCondition("publication.publication_time >= " + builder.addArgument(*options.PublishedAfter))
+	}
+
+	if options.PublishedBefore != nil {
+		builder.addCondition("publication.publication_time < " + builder.addArgument(*options.PublishedBefore))
+	}
+
+	sqlQuery := selectPublicationRowsQuery + builder.whereClause() + `
+		ORDER BY publication.publication_time DESC, publication.id DESC`
+
+	return queryPublicationRows(sqlQuery, builder.arguments...)
+}
+
+// PublishDuePublications makes every scheduled publication whose time has come go live, and
+// returns their ids. Rows locked by another instance doing the same are skipped, so each
+// publication goes live exactly once. The publication time is now rather than publish_at,
+// so that a late run does not backdate when readers could first see the publication.
+func PublishDuePublications(now time.Time) ([]int64, error) {
+	sqlQuery := `
+		UPDATE publication SET publication_time = $1
+		WHERE id IN (
+			SELECT id FROM publication
+			WHERE publication_time IS NULL
+				AND publish_at <= $1
+				AND NOT EXISTS (
+					SELECT 1 FROM publication_retraction
+					WHERE publication_retraction.publication_id = publication.id
+				)
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`
+
+	rows, err := db.Query(sqlQuery, now)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	publicationIds := make([]int64, 0)
+	for rows.Next() {
+		var publicationId int64
+		if err := rows.Scan(&publicationId); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		publicationIds = append(publicationIds, publicationId)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return publicationIds, nil
+}
+
+// GetPublicationById returns QueryResultContainedNoRowsError if no such publication exists.
+func GetPublicationById(publicationId int64) (*PublicationRow, error) {
+	sqlQuery := selectPublicationRowsQuery + `
+		WHERE publication.id = $1`
+
+	publicationRows, err := queryPublicationRows(sqlQuery, publicationId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(publicationRows) > 1 {
+		return nil, QueryResultContainedMultipleRowsError
+	}
+
+	if len(publicationRows) == 0 {
+		return nil, QueryResultContainedNoRowsError
+	}
+
+	return publicationRows[0], nil
+}
+
+// RetractPublication turns the notes of the publication back into unpublished notes and records the retraction.
+// It returns UniqueConstraintError if the publication was already retracted.
+func RetractPublication(publicationId int64, retractorId int64, retractionTime time.Time) error {
+	return withTransaction(func(tx *sql.Tx) error {
+		{
+			sqlQuery := `
+				SELECT id FROM publication
+				WHERE id = $1
+				FOR UPDATE`
+
+			var lockedPublicationId int64
+			if err := tx.QueryRow(sqlQuery, publicationId).Scan(&lockedPublicationId); err != nil {
+				return err
+			}
+		}
+
+		noteIds := make([]int64, 0)
+		{
+			sqlQuery := `
+				DELETE FROM note_to_publication_relationship
+				WHERE publication_id = $1
+				RETURNING note_id`
+
+			rows, err := tx.Query(sqlQuery, publicationId)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var noteId int64
+				if err := rows.Scan(&noteId); err != nil {
+					return err
+				}
+
+				noteIds = append(noteIds, noteId)
+			}
+
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+
+		sqlQuery := `
+			INSERT INTO publication_retraction (publication_id, retractor_id, retraction_time, note_ids)
+			VALUES ($1, $2, $3, $4)`
+
+		_, err := tx.Exec(sqlQuery, publicationId, retractorId, retractionTime, pq.Array(noteIds))
+		return err
+	})
+}
+
+// GetNotesInPublications returns the undeleted notes of the given publications, oldest first.
+func GetNotesInPublications(publicationIds []int64) ([]*NoteRow, error) {
+	sqlQuery := selectNoteRowsQuery + `
+		WHERE note_to_publication_relationship.publication_id = ANY($1)
+			AND note.deletion_time IS NULL
+		ORDER BY note.creation_time, note.id`
+
+	return queryNoteRows(sqlQuery, pq.Array(publicationIds))
+}
+
+// UpsertPredictionConfidence sets or, when confidence is nil, clears the confidence of a prediction.
+// NoteAlreadyPublishedError is returned if the note belongs to a publication.
+func UpsertPredictionConfidence(noteId int64, confidence *int64) error {
+	return withTransaction(func(tx *sql.Tx) error {
+		if err := lockNoteRowIfUnpublished(tx, noteId); err != nil {
+			return err
+		}
+
+		sqlQuery := `
+			INSERT INTO prediction (note_id, confidence)
+			VALUES ($1, $2)
+			ON CONFLICT (note_id) DO UPDATE SET confidence = EXCLUDED.confidence`
+
+		_, err := tx.Exec(sqlQuery, noteId, confidence)
+		return err
+	})
+}
+
+// UpsertPredictionOutcome records how a prediction turned out, replacing any earlier resolution.
+func UpsertPredictionOutcome(
+	noteId int64,
+	outcome string,
+	resolverId int64,
+	resolutionTime time.Time,
+) error {
+	sqlQuery := `
+		INSERT INTO prediction (note_id, outcome, resolver_id, resolution_time)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (note_id) DO UPDATE SET
+			outcome = EXCLUDED.outcome,
+			resolver_id = EXCLUDED.resolver_id,
+			resolution_time = EXCLUDED.resolution_time`
+
+	if _, err := db.Exec(sqlQuery, noteId, outcome, resolverId, resolutionTime); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// ScoredPredictionRow holds one published prediction that has a confidence and came out correct or incorrect.
+type ScoredPredictionRow struct {
+	AuthorId          int64
+	AuthorDisplayName string
+	Confidence        int64
+	IsCorrect         bool
+}
+
+// GetScoredPredictions returns every live, undeleted prediction that can be scored, written by the members
+// of the club, or by the user and the members of the user's clubs when clubId is nil.
+// A nil bookId returns the predictions about every book.
+func GetScoredPredictions(userId int64, clubId *int64, bookId *int64) ([]*ScoredPredictionRow, error) {
+	builder := new(queryBuilder)
+
+	if clubId != nil {
+		builder.addCondition(`EXISTS (
+				SELECT 1 FROM club_membership
+				WHERE club_membership.club_id = ` + builder.addArgument(*clubId) + `
+					AND club_membership.user_id = note.author_id
+			)`)
+	} else {
+		userIdArgument := builder.addArgument(userId)
+		builder.addCondition(
+			"(note.author_id = " + userIdArgument + " OR " + sharesClubCondition(userIdArgument, "note.author_id") + ")")
+	}
+
+	builder.addCondition("prediction.confidence IS NOT NULL")
+	builder.addCondition("prediction.outcome IN ('correct', 'incorrect')")
+	builder.addCondition("publication.publication_time IS NOT NULL")
+	builder.addCondition("note.deletion_time IS NULL")
+
+	if bookId != nil {
+		builder.addCondition("note.book_id = " + builder.addArgument(*bookId))
+	}
+
+	sqlQuery := `
+		SELECT
+			note.author_id,
+			app_user.display_name,
+			prediction.confidence,
+			prediction.outcome = 'correct'
+		FROM prediction
+		INNER JOIN note ON note.id = prediction.note_id
+		INNER JOIN app_user ON app_user.id = note.author_id
+		INNER JOIN note_to_publication_relationship
+			ON note_to_publication_relationship.note_id = note.id
+		INNER JOIN publication
+			ON publication.id = note_to_publication_relationship.publication_id` + builder.whereClause()
+
+	rows, err := db.Query(sqlQuery, builder.arguments...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	predictionRows := make([]*ScoredPredictionRow, 0)
+	for rows.Next() {
+		predictionRow := new(ScoredPredictionRow)
+
+		if err := rows.Scan(
+			&predictionRow.AuthorId,
+			&predictionRow.AuthorDisplayName,
+			&predictionRow.Confidence,
+			&predictionRow.IsCorrect,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		predictionRows = append(predictionRows, predictionRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return predictionRows, nil
+}
+
+// CategoryRow holds the columns of a category definition.
+// ClubId is 0 for the default categories.
+type CategoryRow struct {
+	Id          int64
+	ClubId      int64
+	Name        string
+	Description string
+	Color       string
+	SortOrder   int
+}
+
+// InsertCategory returns UniqueConstraintError if the club or the default categories
+// already have a category by that name.
+func InsertCategory(
+	clubId int64,
+	name string,
+	description string,
+	color string,
+	sortOrder int,
+	creatorId int64,
+	creationTime time.Time,
+) (int64, error) {
+	sqlQuery := `
+		INSERT INTO category (club_id, name, description, color, sort_order, creator_id, creation_time)
+		SELECT $1::bigint, $2::text, $3::text, $4::text, $5::integer, $6::bigint, $7::timestamp
+		WHERE NOT EXISTS (
+			SELECT 1 FROM category
+			WHERE club_id IS NULL
+				AND name = $2
+		)
+		RETURNING id`
+
+	var categoryId int64
+	if err := db.QueryRow(
+		sqlQuery,
+		clubId,
+		name,
+		description,
+		color,
+		sortOrder,
+		creatorId,
+		creationTime,
+	).Scan(&categoryId); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, UniqueConstraintError
+		}
+
+		return 0, convertPostgresError(err)
+	}
+
+	return categoryId, nil
+}
+
+// GetCategoriesAvailableToUser returns the default categories and those of the user's clubs,
+// ordered by sort order.
+func GetCategoriesAvailableToUser(userId int64) ([]*CategoryRow, error) {
+	sqlQuery := selectCategoryRowsQuery + `
+		WHERE ` + isCategoryAvailableCondition("$1") + `
+		ORDER BY sort_order, id`
+
+	return queryCategoryRows(sqlQuery, userId)
+}
+
+// GetCategoriesAvailableToUserByName returns the default category or the categories of the user's clubs
+// with the given name. Only the categories of different clubs may share a name.
+// When clubId is set, only the default categories and those of that club are searched.
+func GetCategoriesAvailableToUserByName(userId int64, clubId *int64, name string) ([]*CategoryRow, error) {
+	sqlQuery := selectCategoryRowsQuery + `
+		WHERE name = $2
+			AND ` + isCategoryAvailableCondition("$1")
+	args := []interface{}{userId, name}
+
+	if clubId != nil {
+		sqlQuery += `
+			AND (club_id IS NULL OR club_id = $3)`
+		args = append(args, *clubId)
+	}
+
+	sqlQuery += `
+		ORDER BY id`
+
+	return queryCategoryRows(sqlQuery, args...)
+}
+
+func IsCategoryAvailableToUser(categoryId int64, userId int64) (bool, error) {
+	sqlQuery := `
+		SELECT EXISTS (
+			SELECT 1 FROM category
+			WHERE id = $1
+				AND ` + isCategoryAvailableCondition("$2") + `
+		)`
+
+	var isAvailable bool
+	if err := db.QueryRow(sqlQuery, categoryId, userId).Scan(&isAvailable); err != nil {
+		return false, convertPostgresError(err)
+	}
+
+	return isAvailable, nil
+}
+
+// BookRow holds the columns of a book.
+type BookRow struct {
+	Id           int64
+	Title        string
+	Authors      []string
+	Isbn         string
+	Edition      string
+	Chapters     []string
+	CreatorId    int64
+	CreationTime time.Time
+}
+
+func InsertBook(
+	title string,
+	authors []string,
+	isbn string,
+	edition string,
+	chapters []string,
+	creatorId int64,
+	creationTime time.Time,
+) (int64, error) {
+	sqlQuery := `
+		INSERT INTO book (title, authors, isbn, edition, chapters, creator_id, creation_time)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`
+
+	var bookId int64
+	if err := db.QueryRow(
+		sqlQuery,
+		title,
+		pq.Array(authors),
+		isbn,
+		edition,
+		pq.Array(chapters),
+		creatorId,
+		creationTime,
+	).Scan(&bookId); err != nil {
+		return 0, convertPostgresError(err)
+	}
+
+	return bookId, nil
+}
+
+// GetBooks returns every book, most recently added first.
+func GetBooks() ([]*BookRow, error) {
+	sqlQuery := selectBookRowsQuery + `
+		ORDER BY creation_time DESC, id DESC`
+
+	return queryBookRows(sqlQuery)
+}
+
+// GetBookById returns QueryResultContainedNoRowsError if no such book exists.
+func GetBookById(bookId int64) (*BookRow, error) {
+	sqlQuery := selectBookRowsQuery + `
+		WHERE id = $1`
+
+	bookRows, err := queryBookRows(sqlQuery, bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bookRows) > 1 {
+		return nil, QueryResultContainedMultipleRowsError
+	}
+
+	if len(bookRows) == 0 {
+		return nil, QueryResultContainedNoRowsError
+	}
+
+	return bookRows[0], nil
+}
+
+// UpdateBook returns QueryResultContainedNoRowsError if no such book exists.
+func UpdateBook(
+	bookId int64,
+	title string,
+	authors []string,
+	isbn string,
+	edition string,
+	chapters []string,
+) error {
+	sqlQuery := `
+		UPDATE book SET title = $2, authors = $3, isbn = $4, edition = $5, chapters = $6
+		WHERE id = $1`
+
+	return execExpectingOneRow(
+		sqlQuery,
+		bookId,
+		title,
+		pq.Array(authors),
+		isbn,
+		edition,
+		pq.Array(chapters))
+}
+
+// DeleteBook returns QueryResultContainedNoRowsError if no such book exists,
+// and ForeignKeyConstraintError if any note or publication is still about the book.
+func DeleteBook(bookId int64) error {
+	sqlQuery := `
+		DELETE FROM book
+		WHERE id = $1`
+
+	return execExpectingOneRow(sqlQuery, bookId)
+}
+
+// ReadingProgressRow holds one recorded update of a member's progress through a book.
+type ReadingProgressRow struct {
+	BookId     int64
+	Chapter    *int64
+	Page       *int64
+	Percent    *float64
+	RecordTime time.Time
+}
+
+// InsertReadingProgress returns ForeignKeyConstraintError if no such book exists.
+func InsertReadingProgress(
+	userId int64,
+	bookId int64,
+	chapter *int64,
+	page *int64,
+	percent *float64,
+	recordTime time.Time,
+) error {
+	sqlQuery := `
+		INSERT INTO reading_progress (user_id, book_id, chapter, page, percent, record_time)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := db.Exec(sqlQuery, userId, bookId, chapter, page, percent, recordTime)
+	return convertPostgresError(err)
+}
+
+// GetReadingProgressHistory returns every progress update the user recorded for the book, newest first.
+func GetReadingProgressHistory(userId int64, bookId int64) ([]*ReadingProgressRow, error) {
+	sqlQuery := selectReadingProgressRowsQuery + `
+		WHERE user_id = $1
+			AND book_id = $2
+		ORDER BY record_time DESC, id DESC`
+
+	return queryReadingProgressRows(sqlQuery, userId, bookId)
+}
+
+// GetCurrentReadingProgress returns the latest progress update of the user for each book they recorded progress in.
+func GetCurrentReadingProgress(userId int64) ([]*ReadingProgressRow, error) {
+	sqlQuery := `
+		SELECT DISTINCT ON (book_id) book_id, chapter, page, percent, record_time FROM reading_progress
+		WHERE user_id = $1
+		ORDER BY book_id, record_time DESC, id DESC`
+
+	return queryReadingProgressRows(sqlQuery, userId)
+}
+
+// InsertClub creates a club with its creator as its first organizer.
+func InsertClub(name string, creatorId int64, creationTime time.Time) (int64, error) {
+	var clubId int64 = 0
+
+	if err := withTransaction(func(tx *sql.Tx) error {
+		{
+			sqlQuery := `
+				INSERT INTO club (name, creator_id, creation_time)
+				VALUES ($1, $2, $3)
+				RETURNING id`
+
+			if err := tx.QueryRow(sqlQuery, name, creatorId, creationTime).Scan(&clubId); err != nil {
+				return err
+			}
+		}
+
+		sqlQuery := `
+			INSERT INTO club_membership (club_id, user_id, role, join_time)
+			VALUES ($1, $2, 'organizer', $3)`
+
+		_, err := tx.Exec(sqlQuery, clubId, creatorId, creationTime)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	return clubId, nil
+}
+
+// ClubMembershipRow holds the columns of a club along with the role of one of its members.
+type ClubMembershipRow struct {
+	ClubId       int64
+	Name         string
+	CreatorId    int64
+	CreationTime time.Time
+	Role         string
+}
+
+// GetClubMembershipsOfUser returns the clubs the user belongs to, oldest first.
+func GetClubMembershipsOfUser(userId int64) ([]*ClubMembershipRow, error) {
+	sqlQuery := selectClubMembershipRowsQuery + `
+		WHERE club_membership.user_id = $1
+		ORDER BY club.creation_time, club.id`
+
+	return queryClubMembershipRows(sqlQuery, userId)
+}
+
+// GetClubMembershipOfUser returns QueryResultContainedNoRowsError if the user does not belong to the club.
+func GetClubMembershipOfUser(clubId int64, userId int64) (*ClubMembershipRow, error) {
+	sqlQuery := selectClubMembershipRowsQuery + `
+		WHERE club_membership.club_id = $1
+			AND club_membership.user_id = $2`
+
+	membershipRows, err := queryClubMembershipRows(sqlQuery, clubId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(membershipRows) > 1 {
+		return nil, QueryResultContainedMultipleRowsError
+	}
+
+	if len(membershipRows) == 0 {
+		return nil, QueryResultContainedNoRowsError
+	}
+
+	return membershipRows[0], nil
+}
+
+// ClubMemberRow holds one member of a club joined with their display name.
+type ClubMemberRow struct {
+	UserId      int64
+	DisplayName string
+	Role        string
+	JoinTime    time.Time
+}
+
+// GetClubMembers returns the members of the club, organizers first and then in the order they joined.
+func GetClubMembers(clubId int64) ([]*ClubMemberRow, error) {
+	sqlQuery := `
+		SELECT club_membership.user_id, app_user.display_name, club_membership.role::text, club_membership.join_time
+		FROM club_membership
+		INNER JOIN app_user ON app_user.id = club_membership.user_id
+		WHERE club_membership.club_id = $1
+		ORDER BY club_membership.role, club_membership.join_time, club_membership.user_id`
+
+	rows, err := db.Query(sqlQuery, clubId)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	memberRows := make([]*ClubMemberRow, 0)
+	for rows.Next() {
+		memberRow := new(ClubMemberRow)
+
+		if err := rows.Scan(
+			&memberRow.UserId,
+			&memberRow.DisplayName,
+			&memberRow.Role,
+			&memberRow.JoinTime,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		memberRows = append(memberRows, memberRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return memberRows, nil
+}
+
+// UpdateClubMemberRole returns QueryResultContainedNoRowsError if the user does not belong to the club,
+// and ClubLeftWithoutOrganizerError if the club's last organizer would become a plain member.
+func UpdateClubMemberRole(clubId int64, userId int64, role string) error {
+	return withTransaction(func(tx *sql.Tx) error {
+		if err := lockClubRow(tx, clubId); err != nil {
+			return err
+		}
+
+		sqlQuery := `
+			UPDATE club_membership SET role = $3
+			WHERE club_id = $1
+				AND user_id = $2`
+
+		result, err := tx.Exec(sqlQuery, clubId, userId, role)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return QueryResultContainedNoRowsError
+		}
+
+		return checkClubHasOrganizer(tx, clubId)
+	})
+}
+
+// DeleteClubMembership returns QueryResultContainedNoRowsError if the user does not belong to the club,
+// and ClubLeftWithoutOrganizerError if the club's last organizer would leave other members behind.
+func DeleteClubMembership(clubId int64, userId int64) error {
+	return withTransaction(func(tx *sql.Tx) error {
+		if err := lockClubRow(tx, clubId); err != nil {
+			return err
+		}
+
+		sqlQuery := `
+			DELETE FROM club_membership
+			WHERE club_id = $1
+				AND user_id = $2`
+
+		result, err := tx.Exec(sqlQuery, clubId, userId)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return QueryResultContainedNoRowsError
+		}
+
+		return checkClubHasOrganizer(tx, clubId)
+	})
+}
+
+// UserRow holds the id and display name of a user.
+type UserRow struct {
+	Id          int64
+	DisplayName string
+}
+
+// GetUsersSharingClubWith returns the user along with every member of the user's clubs.
+func GetUsersSharingClubWith(userId int64) ([]*UserRow, error) {
+	sqlQuery := `
+		SELECT app_user.id, app_user.display_name FROM app_user
+		WHERE app_user.id = $1
+			OR ` + sharesClubCondition("$1", "app_user.id") + `
+		ORDER BY app_user.id`
+
+	rows, err := db.Query(sqlQuery, userId)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	userRows := make([]*UserRow, 0)
+	for rows.Next() {
+		userRow := new(UserRow)
+
+		if err := rows.Scan(&userRow.Id, &userRow.DisplayName); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		userRows = append(userRows, userRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return userRows, nil
+}
+
+// DoUsersShareClub tells whether the two users belong to at least one club together.
+func DoUsersShareClub(userId int64, otherUserId int64) (bool, error) {
+	sqlQuery := `SELECT ` + sharesClubCondition("$1", "$2::bigint")
+
+	var doShareClub bool
+	if err := db.QueryRow(sqlQuery, userId, otherUserId).Scan(&doShareClub); err != nil {
+		return false, convertPostgresError(err)
+	}
+
+	return doShareClub, nil
+}
+
+// IsOrganizerOverUser tells whether the organizer organizes any club the member belongs to.
+func IsOrganizerOverUser(organizerId int64, memberId int64) (bool, error) {
+	sqlQuery := `
+		SELECT EXISTS (
+			SELECT 1 FROM club_membership AS organizer_membership
+			INNER JOIN club_membership AS member_membership
+				ON member_membership.club_id = organizer_membership.club_id
+			WHERE organizer_membership.user_id = $1
+				AND organizer_membership.role = 'organizer'
+				AND member_membership.user_id = $2
+		)`
+
+	var isOrganizer bool
+	if err := db.QueryRow(sqlQuery, organizerId, memberId).Scan(&isOrganizer); err != nil {
+		return false, convertPostgresError(err)
+	}
+
+	return isOrganizer, nil
+}
+
+// InsertClubInvite takes a nil maxUses for an invite that can be used any number of times.
+func InsertClubInvite(
+	clubId int64,
+	creatorId int64,
+	maxUses *int64,
+	expirationTime time.Time,
+	creationTime time.Time,
+) (int64, error) {
+	sqlQuery := `
+		INSERT INTO club_invite (club_id, creator_id, max_uses, expiration_time, creation_time)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	var inviteId int64
+	if err := db.QueryRow(
+		sqlQuery,
+		clubId,
+		creatorId,
+		maxUses,
+		expirationTime,
+		creationTime,
+	).Scan(&inviteId); err != nil {
+		return 0, convertPostgresError(err)
+	}
+
+	return inviteId, nil
+}
+
+// ClubInviteRow holds the columns of a club invite.
+type ClubInviteRow struct {
+	Id             int64
+	ClubId         int64
+	CreatorId      int64
+	MaxUses        *int64
+	UseCount       int64
+	ExpirationTime time.Time
+	RevocationTime *time.Time
+	CreationTime   time.Time
+}
+
+// GetClubInviteById returns QueryResultContainedNoRowsError if no such invite exists.
+func GetClubInviteById(inviteId int64) (*ClubInviteRow, error) {
+	sqlQuery := selectClubInviteRowsQuery + `
+		WHERE id = $1`
+
+	inviteRows, err := queryClubInviteRows(sqlQuery, inviteId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inviteRows) > 1 {
+		return nil, QueryResultContainedMultipleRowsError
+	}
+
+	if len(inviteRows) == 0 {
+		return nil, QueryResultContainedNoRowsError
+	}
+
+	return inviteRows[0], nil
+}
+
+// GetOutstandingClubInvites returns the invites of the club that can still be used at the given time,
+// most recently created first.
+func GetOutstandingClubInvites(clubId int64, currentTime time.Time) ([]*ClubInviteRow, error) {
+	sqlQuery := selectClubInviteRowsQuery + `
+		WHERE club_id = $1
+			AND ` + isClubInviteUsableCondition + `
+		ORDER BY creation_time DESC, id DESC`
+
+	return queryClubInviteRows(sqlQuery, clubId, currentTime)
+}
+
+// UpdateClubInviteMaxUses returns QueryResultContainedNoRowsError if the invite does not exist
+// or has been revoked. A limit below the number of uses already made leaves the invite used up.
+func UpdateClubInviteMaxUses(inviteId int64, maxUses *int64) error {
+	sqlQuery := `
+		UPDATE club_invite SET max_uses = $2
+		WHERE id = $1
+			AND revocation_time IS NULL`
+
+	return execExpectingOneRow(sqlQuery, inviteId, maxUses)
+}
+
+// RevokeClubInvite returns QueryResultContainedNoRowsError if the invite does not exist
+// or has already been revoked.
+func RevokeClubInvite(inviteId int64, revocationTime time.Time) error {
+	sqlQuery := `
+		UPDATE club_invite SET revocation_time = $2
+		WHERE id = $1
+			AND revocation_time IS NULL`
+
+	return execExpectingOneRow(sqlQuery, inviteId, revocationTime)
+}
+
+// RedeemClubInvite makes the user a member of the invite's club and counts the use.
+// Members of the club are left as they are without using up the invite.
+// It returns ClubInviteNotUsableError if the invite cannot be used anymore.
+func RedeemClubInvite(inviteId int64, userId int64, joinTime time.Time) error {
+	return withTransaction(func(tx *sql.Tx) error {
+		return redeemClubInvite(tx, inviteId, userId, joinTime)
+	})
+}
+
+func InsertReadingMilestone(
+	clubId int64,
+	bookId int64,
+	title string,
+	firstChapter int,
+	lastChapter int,
+	dueTime time.Time,
+	creatorId int64,
+	creationTime time.Time,
+) (int64, error) {
+	sqlQuery := `
+		INSERT INTO reading_milestone (
+			club_id,
+			book_id,
+			title,
+			first_chapter,
+			last_chapter,
+			due_time,
+			creator_id,
+			creation_time
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`
+
+	var milestoneId int64
+	if err := db.QueryRow(
+		sqlQuery,
+		clubId,
+		bookId,
+		title,
+		firstChapter,
+		lastChapter,
+		dueTime,
+		creatorId,
+		creationTime,
+	).Scan(&milestoneId); err != nil {
+		return 0, convertPostgresError(err)
+	}
+
+	return milestoneId, nil
+}
+
+// MilestoneRow holds the columns of a reading milestone.
+type MilestoneRow struct {
+	Id           int64
+	ClubId       int64
+	BookId       int64
+	Title        string
+	FirstChapter int
+	LastChapter  int
+	DueTime      time.Time
+	CreatorId    int64
+	CreationTime time.Time
+}
+
+// GetReadingMilestones returns the reading schedule of the club for the book, ordered by due time.
+func GetReadingMilestones(clubId int64, bookId int64) ([]*MilestoneRow, error) {
+	sqlQuery := selectMilestoneRowsQuery + `
+		WHERE club_id = $1
+			AND book_id = $2
+		ORDER BY due_time, id`
+
+	return queryMilestoneRows(sqlQuery, clubId, bookId)
+}
+
+// GetReadingMilestoneById returns QueryResultContainedNoRowsError if no such milestone exists.
+func GetReadingMilestoneById(milestoneId int64) (*MilestoneRow, error) {
+	sqlQuery := selectMilestoneRowsQuery + `
+		WHERE id = $1`
+
+	milestoneRows, err := queryMilestoneRows(sqlQuery, milestoneId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(milestoneRows) > 1 {
+		return nil, QueryResultContainedMultipleRowsError
+	}
+
+	if len(milestoneRows) == 0 {
+		return nil, QueryResultContainedNoRowsError
+	}
+
+	return milestoneRows[0], nil
+}
+
+// UpdateReadingMilestone returns QueryResultContainedNoRowsError if no such milestone exists.
+func UpdateReadingMilestone(
+	milestoneId int64,
+	title string,
+	firstChapter int,
+	lastChapter int,
+	dueTime time.Time,
+) error {
+	sqlQuery := `
+		UPDATE reading_milestone
+		SET title = $2, first_chapter = $3, last_chapter = $4, due_time = $5
+		WHERE id = $1`
+
+	return execExpectingOneRow(sqlQuery, milestoneId, title, firstChapter, lastChapter, dueTime)
+}
+
+// DeleteReadingMilestone returns QueryResultContainedNoRowsError if no such milestone exists,
+// and ForeignKeyConstraintError while publications are still attached to it.
+func DeleteReadingMilestone(milestoneId int64) error {
+	sqlQuery := `
+		DELETE FROM reading_milestone
+		WHERE id = $1`
+
+	return execExpectingOneRow(sqlQuery, milestoneId)
+}
+
+// InsertNoteReaction does nothing if the user already reacted to the note with the reaction.
+func InsertNoteReaction(noteId int64, userId int64, reaction string, creationTime time.Time) error {
+	sqlQuery := `
+		INSERT INTO note_reaction (note_id, user_id, reaction, creation_time)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`
+
+	if _, err := db.Exec(sqlQuery, noteId, userId, reaction, creationTime); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// DeleteNoteReaction does nothing if the user has not reacted to the note with the reaction.
+func DeleteNoteReaction(noteId int64, userId int64, reaction string) error {
+	sqlQuery := `
+		DELETE FROM note_reaction
+		WHERE note_id = $1
+			AND user_id = $2
+			AND reaction = $3`
+
+	if _, err := db.Exec(sqlQuery, noteId, userId, reaction); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+type NoteReactionRow struct {
+	UserId       int64
+	Reaction     string
+	CreationTime time.Time
+}
+
+// GetNoteReactions returns the reactions to the note, oldest first.
+func GetNoteReactions(noteId int64) ([]*NoteReactionRow, error) {
+	sqlQuery := `
+		SELECT user_id, reaction::text, creation_time FROM note_reaction
+		WHERE note_id = $1
+		ORDER BY creation_time, user_id, reaction`
+
+	rows, err := db.Query(sqlQuery, noteId)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	reactionRows := make([]*NoteReactionRow, 0)
+	for rows.Next() {
+		reactionRow := new(NoteReactionRow)
+
+		if err := rows.Scan(&reactionRow.UserId, &reactionRow.Reaction, &reactionRow.CreationTime); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		reactionRows = append(reactionRows, reactionRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return reactionRows, nil
+}
+
+// NoteReactionCountRow tells how many users reacted to a note with a reaction,
+// and whether the viewer is one of them.
+type NoteReactionCountRow struct {
+	NoteId     int64
+	Reaction   string
+	Count      int
+	HasReacted bool
+}
+
+// GetNoteReactionCounts returns a row for each reaction the given notes received,
+// ordered by note and then in the order the reactions are declared.
+func GetNoteReactionCounts(noteIds []int64, viewerId int64) ([]*NoteReactionCountRow, error) {
+	sqlQuery := `
+		SELECT
+			note_id,
+			reaction::text,
+			COUNT(*),
+			BOOL_OR(user_id = $2)
+		FROM note_reaction
+		WHERE note_id = ANY($1)
+		GROUP BY note_id, reaction
+		ORDER BY note_id, reaction`
+
+	rows, err := db.Query(sqlQuery, pq.Array(noteIds), viewerId)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	countRows := make([]*NoteReactionCountRow, 0)
+	for rows.Next() {
+		countRow := new(NoteReactionCountRow)
+
+		if err := rows.Scan(
+			&countRow.NoteId,
+			&countRow.Reaction,
+			&countRow.Count,
+			&countRow.HasReacted,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		countRows = append(countRows, countRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return countRows, nil
+}
+
+// InsertNoteComment takes a nil parentCommentId for a comment that does not reply to another.
+// It returns ForeignKeyConstraintError if the parent comment is not on the same note,
+// and NoteCommentingLockedError if the note's author has locked its comments.
+func InsertNoteComment(
+	noteId int64,
+	parentCommentId *int64,
+	authorId int64,
+	content string,
+	creationTime time.Time,
+) (int64, error) {
+	sqlQuery := `
+		INSERT INTO note_comment (note_id, parent_comment_id, author_id, content, creation_time)
+		SELECT $1::bigint, $2::bigint, $3::bigint, $4::text, $5::timestamp
+		WHERE NOT EXISTS (
+			SELECT 1 FROM note_comment_lock
+			WHERE note_id = $1
+		)
+		RETURNING id`
+
+	var commentId int64
+	if err := db.QueryRow(
+		sqlQuery,
+		noteId,
+		parentCommentId,
+		authorId,
+		content,
+		creationTime,
+	).Scan(&commentId); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, NoteCommentingLockedError
+		}
+
+		return 0, convertPostgresError(err)
+	}
+
+	return commentId, nil
+}
+
+// NoteCommentRow holds the columns of a comment. ParentCommentId is 0 for a comment that replies to none.
+// DeletionTime is set once the author deleted the comment.
+type NoteCommentRow struct {
+	Id              int64
+	NoteId          int64
+	ParentCommentId int64
+	AuthorId        int64
+	Content         string
+	CreationTime    time.Time
+	EditTime        *time.Time
+	DeletionTime    *time.Time
+}
+
+// GetNoteComments returns every comment on the note, deleted ones included, in the order they were stored.
+// Replies therefore always come after the comment they reply to.
+func GetNoteComments(noteId int64) ([]*NoteCommentRow, error) {
+	sqlQuery := selectNoteCommentRowsQuery + `
+		WHERE note_id = $1
+		ORDER BY id`
+
+	return queryNoteCommentRows(sqlQuery, noteId)
+}
+
+// GetNoteCommentById returns QueryResultContainedNoRowsError if no such comment exists.
+func GetNoteCommentById(commentId int64) (*NoteCommentRow, error) {
+	sqlQuery := selectNoteCommentRowsQuery + `
+		WHERE id = $1`
+
+	commentRows, err := queryNoteCommentRows(sqlQuery, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(commentRows) > 1 {
+		return nil, QueryResultContainedMultipleRowsError
+	}
+
+	if len(commentRows) == 0 {
+		return nil, QueryResultContainedNoRowsError
+	}
+
+	return commentRows[0], nil
+}
+
+// UpdateNoteCommentContent returns QueryResultContainedNoRowsError if no undeleted comment has the given id.
+func UpdateNoteCommentContent(commentId int64, content string, editTime time.Time) error {
+	sqlQuery := `
+		UPDATE note_comment SET content = $2, edit_time = $3
+		WHERE id = $1
+			AND deletion_time IS NULL`
+
+	return execExpectingOneRow(sqlQuery, commentId, content, editTime)
+}
+
+// MarkNoteCommentDeleted keeps the comment so that its replies keep their place in the thread.
+// It returns QueryResultContainedNoRowsError if no undeleted comment has the given id.
+func MarkNoteCommentDeleted(commentId int64, deletionTime time.Time) error {
+	sqlQuery := `
+		UPDATE note_comment SET deletion_time = $2
+		WHERE id = $1
+			AND deletion_time IS NULL`
+
+	return execExpectingOneRow(sqlQuery, commentId, deletionTime)
+}
+
+// InsertNoteCommentLock does nothing if the note's comments are already locked.
+func InsertNoteCommentLock(noteId int64, lockTime time.Time) error {
+	sqlQuery := `
+		INSERT INTO note_comment_lock (note_id, lock_time)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	if _, err := db.Exec(sqlQuery, noteId, lockTime); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// DeleteNoteCommentLock does nothing if the note's comments are not locked.
+func DeleteNoteCommentLock(noteId int64) error {
+	sqlQuery := `
+		DELETE FROM note_comment_lock
+		WHERE note_id = $1`
+
+	if _, err := db.Exec(sqlQuery, noteId); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// ReplaceMentions records who is mentioned in the content of a note, or of one of its comments
+// when commentId is not nil, forgetting anyone the content no longer mentions.
+// Mentions that were already recorded keep their creation time.
+// It returns the ids of the users who were not mentioned before.
+func ReplaceMentions(
+	noteId int64,
+	commentId *int64,
+	mentionedUserIds []int64,
+	creationTime time.Time,
+) ([]int64, error) {
+	newlyMentionedUserIds := make([]int64, 0)
+
+	if err := withTransaction(func(tx *sql.Tx) error {
+		{
+			sqlQuery := `
+				DELETE FROM mention
+				WHERE note_id = $1
+					AND comment_id IS NOT DISTINCT FROM $2
+					AND NOT (mentioned_user_id = ANY($3))`
+
+			if _, err := tx.Exec(sqlQuery, noteId, commentId, pq.Array(mentionedUserIds)); err != nil {
+				return err
+			}
+		}
+
+		sqlQuery := `
+			INSERT INTO mention (note_id, comment_id, mentioned_user_id, creation_time)
+			SELECT $1::bigint, $2::bigint, mentioned_user.id, $4::timestamp
+			FROM unnest($3::bigint[]) AS mentioned_user (id)
+			WHERE NOT EXISTS (
+				SELECT 1 FROM mention
+				WHERE mention.note_id = $1
+					AND mention.comment_id IS NOT DISTINCT FROM $2
+					AND mention.mentioned_user_id = mentioned_user.id
+			)
+			RETURNING mentioned_user_id`
+
+		rows, err := tx.Query(sqlQuery, noteId, commentId, pq.Array(mentionedUserIds), creationTime)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var mentionedUserId int64
+			if err := rows.Scan(&mentionedUserId); err != nil {
+				return err
+			}
+
+			newlyMentionedUserIds = append(newlyMentionedUserIds, mentionedUserId)
+		}
+
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+
+	return newlyMentionedUserIds, nil
+}
+
+// MentionRow holds a mention of a user. CommentId is 0 for a mention in the content of the note itself.
+// MentionerId is the author of the content, and MentionTime when the mention could first be read.
+type MentionRow struct {
+	NoteId          int64
+	CommentId       int64
+	MentionerId     int64
+	MentionedUserId int64
+	MentionTime     time.Time
+}
+
+// GetMentionsOfUser returns the most recent mentions of the user that the user can read, newest first.
+// Mentions in notes whose publication has not gone live yet are left out.
+func GetMentionsOfUser(userId int64, limit int) ([]*MentionRow, error) {
+	sqlQuery := `
+		SELECT
+			mention.note_id,
+			COALESCE(mention.comment_id, 0),
+			COALESCE(note_comment.author_id, note.author_id),
+			mention.mentioned_user_id,
+			GREATEST(mention.creation_time, publication.publication_time) AS mention_time
+		FROM mention
+		INNER JOIN note
+			ON note.id = mention.note_id
+		LEFT JOIN note_comment
+			ON note_comment.id = mention.comment_id
+		LEFT JOIN note_to_publication_relationship
+			ON note_to_publication_relationship.note_id = note.id
+		LEFT JOIN publication
+			ON publication.id = note_to_publication_relationship.publication_id
+		LEFT JOIN question_answer
+			ON question_answer.answer_note_id = note.id
+		WHERE mention.mentioned_user_id = $1
+			AND note.deletion_time IS NULL
+			AND note_comment.deletion_time IS NULL
+			AND ` + isNotePublicCondition + `
+			AND ` + sharesClubCondition("$1", "COALESCE(note_comment.author_id, note.author_id)") + `
+		ORDER BY mention_time DESC, mention.note_id DESC, mention.comment_id DESC
+		LIMIT $2`
+
+	return queryMentionRows(sqlQuery, userId, limit)
+}
+
+// InsertNotifications gives each of the recipients its own copy of the notification.
+func InsertNotifications(
+	recipientIds []int64,
+	notificationType string,
+	payload []byte,
+	creationTime time.Time,
+) error {
+	sqlQuery := `
+		INSERT INTO notification (recipient_id, type, payload, creation_time)
+		SELECT recipient.id, $2::notification_type, $3::jsonb, $4::timestamp
+		FROM unnest($1::bigint[]) AS recipient (id)`
+
+	if _, err := db.Exec(sqlQuery, pq.Array(recipientIds), notificationType, string(payload), creationTime); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// NotificationRow holds the columns of a notification. Payload is the JSON the notification was stored with.
+type NotificationRow struct {
+	Id           int64
+	Type         string
+	Payload      []byte
+	CreationTime time.Time
+	ReadTime     *time.Time
+}
+
+// GetNotificationsOfUser returns up to limit of the user's notifications, newest first.
+// A cursorId other than 0 only returns notifications older than the one with that id.
+func GetNotificationsOfUser(
+	recipientId int64,
+	isUnreadOnly bool,
+	cursorId int64,
+	limit int,
+) ([]*NotificationRow, error) {
+	builder := new(queryBuilder)
+
+	builder.addCondition("recipient_id = " + builder.addArgument(recipientId))
+
+	if isUnreadOnly {
+		builder.addCondition("read_time IS NULL")
+	}
+
+	if cursorId != 0 {
+		builder.addCondition("id < " + builder.addArgument(cursorId))
+	}
+
+	sqlQuery := `
+		SELECT id, type::text, payload, creation_time, read_time FROM notification` +
+		builder.whereClause() + `
+		ORDER BY id DESC
+		LIMIT ` + builder.addArgument(limit)
+
+	rows, err := db.Query(sqlQuery, builder.arguments...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	notificationRows := make([]*NotificationRow, 0)
+	for rows.Next() {
+		notificationRow := new(NotificationRow)
+
+		if err := rows.Scan(
+			&notificationRow.Id,
+			&notificationRow.Type,
+			&notificationRow.Payload,
+			&notificationRow.CreationTime,
+			&notificationRow.ReadTime,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		notificationRows = append(notificationRows, notificationRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return notificationRows, nil
+}
+
+func CountUnreadNotifications(recipientId int64) (int, error) {
+	sqlQuery := `
+		SELECT COUNT(*) FROM notification
+		WHERE recipient_id = $1
+			AND read_time IS NULL`
+
+	var unreadCount int
+	if err := db.QueryRow(sqlQuery, recipientId).Scan(&unreadCount); err != nil {
+		return 0, convertPostgresError(err)
+	}
+
+	return unreadCount, nil
+}
+
+// MarkNotificationsRead marks the given notifications of the user read, or all of them when notificationIds
+// is nil. Notifications that are already read, or that belong to someone else, are left as they are.
+func MarkNotificationsRead(recipientId int64, notificationIds []int64, readTime time.Time) error {
+	sqlQuery := `
+		UPDATE notification SET read_time = $3
+		WHERE recipient_id = $1
+			AND read_time IS NULL
+			AND ($2::bigint[] IS NULL OR id = ANY($2))`
+
+	if _, err := db.Exec(sqlQuery, recipientId, pq.Array(notificationIds), readTime); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// GetMentionsInPublication returns the mentions in the content of the notes of a live publication.
+func GetMentionsInPublication(publicationId int64) ([]*MentionRow, error) {
+	sqlQuery := `
+		SELECT
+			mention.note_id,
+			0,
+			note.author_id,
+			mention.mentioned_user_id,
+			GREATEST(mention.creation_time, publication.publication_time)
+		FROM mention
+		INNER JOIN note
+			ON note.id = mention.note_id
+		INNER JOIN note_to_publication_relationship
+			ON note_to_publication_relationship.note_id = note.id
+		INNER JOIN publication
+			ON publication.id = note_to_publication_relationship.publication_id
+		WHERE publication.id = $1
+			AND mention.comment_id IS NULL
+			AND note.deletion_time IS NULL
+		ORDER BY mention.note_id, mention.mentioned_user_id`
+
+	return queryMentionRows(sqlQuery, publicationId)
+}
+
+// UpsertDigestSubscription changes the frequency of the user's digest if the user already receives one,
+// in which case lastSentTime is ignored.
+func UpsertDigestSubscription(userId int64, frequency string, lastSentTime time.Time) error {
+	sqlQuery := `
+		INSERT INTO digest_subscription (user_id, frequency, last_sent_time)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET frequency = EXCLUDED.frequency`
+
+	if _, err := db.Exec(sqlQuery, userId, frequency, lastSentTime); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// DeleteDigestSubscription does nothing if the user receives no digest.
+func DeleteDigestSubscription(userId int64) error {
+	sqlQuery := `
+		DELETE FROM digest_subscription
+		WHERE user_id = $1`
+
+	if _, err := db.Exec(sqlQuery, userId); err != nil {
+		return convertPostgresError(err)
+	}
+
+	return nil
+}
+
+// DigestSubscriptionRow holds a digest subscription along with the address the digest is sent to.
+type DigestSubscriptionRow struct {
+	UserId       int64
+	DisplayName  string
+	EmailAddress string
+	Frequency    string
+	LastSentTime time.Time
+}
+
+func GetDigestSubscription(userId int64) (*DigestSubscriptionRow, error) {
+	sqlQuery := selectDigestSubscriptionRowsQuery + `
+		WHERE digest_subscription.user_id = $1`
+
+	subscriptionRows, err := queryDigestSubscriptionRows(sqlQuery, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subscriptionRows) == 0 {
+		return nil, QueryResultContainedNoRowsError
+	}
+
+	return subscriptionRows[0], nil
+}
+
+// GetDigestSubscriptionsDue returns the subscriptions with the given frequency whose last digest
+// was sent no later than cutoffTime, least recently sent first.
+func GetDigestSubscriptionsDue(frequency string, cutoffTime time.Time) ([]*DigestSubscriptionRow, error) {
+	sqlQuery := selectDigestSubscriptionRowsQuery + `
+		WHERE digest_subscription.frequency = $1
+			AND digest_subscription.last_sent_time <= $2
+		ORDER BY digest_subscription.last_sent_time, digest_subscription.user_id`
+
+	return queryDigestSubscriptionRows(sqlQuery, frequency, cutoffTime)
+}
+
+// UpdateDigestLastSentTime only updates the subscription while its last digest is still the one sent
+// at previousLastSentTime. It returns QueryResultContainedNoRowsError if the user unsubscribed
+// or the time was changed in the meantime.
+func UpdateDigestLastSentTime(userId int64, previousLastSentTime time.Time, lastSentTime time.Time) error {
+	sqlQuery := `
+		UPDATE digest_subscription SET last_sent_time = $3
+		WHERE user_id = $1
+			AND last_sent_time = $2`
+
+	return execExpectingOneRow(sqlQuery, userId, previousLastSentTime, lastSentTime)
+}
+
+func GetIdForUserWithEmailAddress(emailAddress string) (int64, error) {
+	sqlQuery := `
+		SELECT id FROM app_user
+		WHERE email_address = $1`
+
+	rows, err := db.Query(sqlQuery, emailAddress)
+	if err != nil {
+		return 0, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	var userId int64
+	for rows.Next() {
+		if userId != 0 {
+			return 0, QueryResultContainedMultipleRowsError
+		}
+
+		if err := rows.Scan(&userId); err != nil {
+			return 0, err
+		}
+	}
+
+	if userId == 0 {
+		return 0, QueryResultContainedNoRowsError
+	}
+
+	return userId, nil
+}
+
+// PRIVATE
+
+// queryNoteRows runs a query whose columns match the fields of NoteRow, in order.
+func queryNoteRows(sqlQuery string, args ...interface{}) ([]*NoteRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	noteRows := make([]*NoteRow, 0)
+	for rows.Next() {
+		noteRow := new(NoteRow)
+
+		if err := rows.Scan(
+			&noteRow.Id,
+			&noteRow.AuthorId,
+			&noteRow.Content,
+			&noteRow.CreationTime,
+			&noteRow.BookId,
+			&noteRow.CategoryId,
+			&noteRow.CategoryName,
+			&noteRow.CategorySortOrder,
+			&noteRow.PublicationId,
+			&noteRow.PublicationTime,
+			&noteRow.DeletionTime,
+			pq.Array(&noteRow.Tags),
+			&noteRow.LocationChapter,
+			&noteRow.LocationPage,
+			&noteRow.LocationPercent,
+			&noteRow.PredictionConfidence,
+			&noteRow.PredictionOutcome,
+			&noteRow.QuestionId,
+			&noteRow.AnswerCount,
+			&noteRow.AcceptedAnswerId,
+			&noteRow.CommentCount,
+			&noteRow.IsCommentingLocked,
+			&noteRow.IsPublic,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		noteRows = append(noteRows, noteRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return noteRows, nil
+}
+
+const selectPublicationRowsQuery = `
+		SELECT
+			publication.id,
+			publication.author_id,
+			app_user.display_name,
+			COALESCE(publication.book_id, 0),
+			COALESCE(book.title, ''),
+			COALESCE(publication.milestone_id, 0),
+			COALESCE(reading_milestone.title, ''),
+			publication.creation_time,
+			publication.publish_at,
+			publication.publication_time,
+			publication_retraction.retraction_time,
+			publication.title,
+			publication.intro_message
+		FROM publication
+		INNER JOIN app_user ON app_user.id = publication.author_id
+		LEFT JOIN book ON book.id = publication.book_id
+		LEFT JOIN reading_milestone ON reading_milestone.id = publication.milestone_id
+		LEFT JOIN publication_retraction ON publication_retraction.publication_id = publication.id`
+
+func queryPublicationRows(sqlQuery string, args ...interface{}) ([]*PublicationRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	publicationRows := make([]*PublicationRow, 0)
+	for rows.Next() {
+		publicationRow := new(PublicationRow)
+
+		if err := rows.Scan(
+			&publicationRow.Id,
+			&publicationRow.AuthorId,
+			&publicationRow.AuthorDisplayName,
+			&publicationRow.BookId,
+			&publicationRow.BookTitle,
+			&publicationRow.MilestoneId,
+			&publicationRow.MilestoneTitle,
+			&publicationRow.CreationTime,
+			&publicationRow.PublishAt,
+			&publicationRow.PublicationTime,
+			&publicationRow.RetractionTime,
+			&publicationRow.Title,
+			&publicationRow.IntroMessage,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		publicationRows = append(publicationRows, publicationRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return publicationRows, nil
+}
+
+// isCategoryAvailableCondition holds for the default categories and those of the clubs of the user
+// referred to by the placeholder.
+func isCategoryAvailableCondition(userIdPlaceholder string) string {
+	return `(
+			category.club_id IS NULL
+			OR category.club_id IN (
+				SELECT club_id FROM club_membership
+				WHERE user_id = ` + userIdPlaceholder + `
+			)
+		)`
+}
+
+const selectCategoryRowsQuery = `
+		SELECT id, COALESCE(club_id, 0), name, description, color, sort_order FROM category`
+
+func queryCategoryRows(sqlQuery string, args ...interface{}) ([]*CategoryRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	categoryRows := make([]*CategoryRow, 0)
+	for rows.Next() {
+		categoryRow := new(CategoryRow)
+
+		if err := rows.Scan(
+			&categoryRow.Id,
+			&categoryRow.ClubId,
+			&categoryRow.Name,
+			&categoryRow.Description,
+			&categoryRow.Color,
+			&categoryRow.SortOrder,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		categoryRows = append(categoryRows, categoryRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return categoryRows, nil
+}
+
+const selectBookRowsQuery = `
+		SELECT id, title, authors, isbn, edition, chapters, creator_id, creation_time FROM book`
+
+func queryBookRows(sqlQuery string, args ...interface{}) ([]*BookRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	bookRows := make([]*BookRow, 0)
+	for rows.Next() {
+		bookRow := new(BookRow)
+
+		if err := rows.Scan(
+			&bookRow.Id,
+			&bookRow.Title,
+			pq.Array(&bookRow.Authors),
+			&bookRow.Isbn,
+			&bookRow.Edition,
+			pq.Array(&bookRow.Chapters),
+			&bookRow.CreatorId,
+			&bookRow.CreationTime,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		bookRows = append(bookRows, bookRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return bookRows, nil
+}
+
+const selectReadingProgressRowsQuery = `
+		SELECT book_id, chapter, page, percent, record_time FROM reading_progress`
+
+func queryReadingProgressRows(sqlQuery string, args ...interface{}) ([]*ReadingProgressRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	progressRows := make([]*ReadingProgressRow, 0)
+	for rows.Next() {
+		progressRow := new(ReadingProgressRow)
+
+		if err := rows.Scan(
+			&progressRow.BookId,
+			&progressRow.Chapter,
+			&progressRow.Page,
+			&progressRow.Percent,
+			&progressRow.RecordTime,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		progressRows = append(progressRows, progressRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return progressRows, nil
+}
+
+const selectClubMembershipRowsQuery = `
+		SELECT club.id, club.name, club.creator_id, club.creation_time, club_membership.role::text
+		FROM club_membership
+		INNER JOIN club ON club.id = club_membership.club_id`
+
+func queryClubMembershipRows(sqlQuery string, args ...interface{}) ([]*ClubMembershipRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	membershipRows := make([]*ClubMembershipRow, 0)
+	for rows.Next() {
+		membershipRow := new(ClubMembershipRow)
+
+		if err := rows.Scan(
+			&membershipRow.ClubId,
+			&membershipRow.Name,
+			&membershipRow.CreatorId,
+			&membershipRow.CreationTime,
+			&membershipRow.Role,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		membershipRows = append(membershipRows, membershipRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return membershipRows, nil
+}
+
+const selectMilestoneRowsQuery = `
+		SELECT
+			id,
+			club_id,
+			book_id,
+			title,
+			first_chapter,
+			last_chapter,
+			due_time,
+			creator_id,
+			creation_time
+		FROM reading_milestone`
+
+func queryMilestoneRows(sqlQuery string, args ...interface{}) ([]*MilestoneRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	milestoneRows := make([]*MilestoneRow, 0)
+	for rows.Next() {
+		milestoneRow := new(MilestoneRow)
+
+		if err := rows.Scan(
+			&milestoneRow.Id,
+			&milestoneRow.ClubId,
+			&milestoneRow.BookId,
+			&milestoneRow.Title,
+			&milestoneRow.FirstChapter,
+			&milestoneRow.LastChapter,
+			&milestoneRow.DueTime,
+			&milestoneRow.CreatorId,
+			&milestoneRow.CreationTime,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		milestoneRows = append(milestoneRows, milestoneRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return milestoneRows, nil
+}
+
+const selectClubInviteRowsQuery = `
+		SELECT
+			id,
+			club_id,
+			creator_id,
+			max_uses,
+			use_count,
+			expiration_time,
+			revocation_time,
+			creation_time
+		FROM club_invite`
+
+// isClubInviteUsableCondition holds for invites that are neither revoked, expired nor used up
+// at the time given as the second query argument.
+const isClubInviteUsableCondition = `revocation_time IS NULL
+			AND expiration_time > $2
+			AND (max_uses IS NULL OR use_count < max_uses)`
+
+func queryClubInviteRows(sqlQuery string, args ...interface{}) ([]*ClubInviteRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	inviteRows := make([]*ClubInviteRow, 0)
+	for rows.Next() {
+		inviteRow := new(ClubInviteRow)
+
+		if err := rows.Scan(
+			&inviteRow.Id,
+			&inviteRow.ClubId,
+			&inviteRow.CreatorId,
+			&inviteRow.MaxUses,
+			&inviteRow.UseCount,
+			&inviteRow.ExpirationTime,
+			&inviteRow.RevocationTime,
+			&inviteRow.CreationTime,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		inviteRows = append(inviteRows, inviteRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return inviteRows, nil
+}
+
+// redeemClubInvite locks the invite so that concurrent redemptions cannot exceed its use limit.
+func redeemClubInvite(tx *sql.Tx, inviteId int64, userId int64, joinTime time.Time) error {
+	var clubId int64
+	{
+		sqlQuery := `
+			SELECT club_id FROM club_invite
+			WHERE id = $1
+			FOR UPDATE`
+
+		if err := tx.QueryRow(sqlQuery, inviteId).Scan(&clubId); err != nil {
+			if err == sql.ErrNoRows {
+				return ClubInviteNotUsableError
+			}
+
+			return err
+		}
+	}
+
+	{
+		sqlQuery := `
+			SELECT EXISTS (
+				SELECT 1 FROM club_membership
+				WHERE club_id = $1
+					AND user_id = $2
+			)`
+
+		var isMember bool
+		if err := tx.QueryRow(sqlQuery, clubId, userId).Scan(&isMember); err != nil {
+			return err
+		}
+
+		if isMember {
+			return nil
+		}
+	}
+
+	{
+		sqlQuery := `
+			UPDATE club_invite SET use_count = use_count + 1
+			WHERE id = $1
+				AND ` + isClubInviteUsableCondition
+
+		result, err := tx.Exec(sqlQuery, inviteId, joinTime)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ClubInviteNotUsableError
+		}
+	}
+
+	sqlQuery := `
+		INSERT INTO club_membership (club_id, user_id, role, join_time)
+		VALUES ($1, $2, 'member', $3)`
+
+	_, err := tx.Exec(sqlQuery, clubId, userId, joinTime)
+	return err
+}
+
+const selectNoteCommentRowsQuery = `
+		SELECT
+			id,
+			note_id,
+			COALESCE(parent_comment_id, 0),
+			author_id,
+			content,
+			creation_time,
+			edit_time,
+			deletion_time
+		FROM note_comment`
+
+func queryNoteCommentRows(sqlQuery string, args ...interface{}) ([]*NoteCommentRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	commentRows := make([]*NoteCommentRow, 0)
+	for rows.Next() {
+		commentRow := new(NoteCommentRow)
+
+		if err := rows.Scan(
+			&commentRow.Id,
+			&commentRow.NoteId,
+			&commentRow.ParentCommentId,
+			&commentRow.AuthorId,
+			&commentRow.Content,
+			&commentRow.CreationTime,
+			&commentRow.EditTime,
+			&commentRow.DeletionTime,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		commentRows = append(commentRows, commentRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return commentRows, nil
+}
+
+// queryMentionRows runs a query whose columns match the fields of MentionRow, in order.
+func queryMentionRows(sqlQuery string, args ...interface{}) ([]*MentionRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	mentionRows := make([]*MentionRow, 0)
+	for rows.Next() {
+		mentionRow := new(MentionRow)
+
+		if err := rows.Scan(
+			&mentionRow.NoteId,
+			&mentionRow.CommentId,
+			&mentionRow.MentionerId,
+			&mentionRow.MentionedUserId,
+			&mentionRow.MentionTime,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		mentionRows = append(mentionRows, mentionRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return mentionRows, nil
+}
+
+const selectDigestSubscriptionRowsQuery = `
+		SELECT
+			digest_subscription.user_id,
+			app_user.display_name,
+			app_user.email_address,
+			digest_subscription.frequency::text,
+			digest_subscription.last_sent_time
+		FROM digest_subscription
+		INNER JOIN app_user ON app_user.id = digest_subscription.user_id`
+
+func queryDigestSubscriptionRows(sqlQuery string, args ...interface{}) ([]*DigestSubscriptionRow, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, convertPostgresError(err)
+	}
+	defer rows.Close()
+
+	subscriptionRows := make([]*DigestSubscriptionRow, 0)
+	for rows.Next() {
+		subscriptionRow := new(DigestSubscriptionRow)
+
+		if err := rows.Scan(
+			&subscriptionRow.UserId,
+			&subscriptionRow.DisplayName,
+			&subscriptionRow.EmailAddress,
+			&subscriptionRow.Frequency,
+			&subscriptionRow.LastSentTime,
+		); err != nil {
+			return nil, convertPostgresError(err)
+		}
+
+		subscriptionRows = append(subscriptionRows, subscriptionRow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, convertPostgresError(err)
+	}
+
+	return subscriptionRows, nil
+}
+
+// sharesClubCondition holds when the user referred to by the placeholder belongs to a club
+// together with the user in otherUserColumn.
+func sharesClubCondition(userIdPlaceholder string, otherUserColumn string) string {
+	return `EXISTS (
+				SELECT 1 FROM club_membership AS viewer_membership
+				INNER JOIN club_membership AS other_membership
+					ON other_membership.club_id = viewer_membership.club_id
+				WHERE viewer_membership.user_id = ` + userIdPlaceholder + `
+					AND other_membership.user_id = ` + otherUserColumn + `
+			)`
+}
+
+// lockClubRow serializes changes to the membership of a club.
+// It returns QueryResultContainedNoRowsError if the club does not exist.
+func lockClubRow(tx *sql.Tx, clubId int64) error {
+	sqlQuery := `
+		SELECT id FROM club
+		WHERE id = $1
+		FOR UPDATE`
+
+	var lockedClubId int64
+	return tx.QueryRow(sqlQuery, clubId).Scan(&lockedClubId)
+}
+
+// checkClubHasOrganizer returns ClubLeftWithoutOrganizerError if the club has members but no organizer.
+func checkClubHasOrganizer(tx *sql.Tx, clubId int64) error {
+	sqlQuery := `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE role = 'organizer')
+		FROM club_membership
+		WHERE club_id = $1`
+
+	var memberCount, organizerCount int
+	if err := tx.QueryRow(sqlQuery, clubId).Scan(&memberCount, &organizerCount); err != nil {
+		return err
+	}
+
+	if memberCount > 0 && organizerCount == 0 {
+		return ClubLeftWithoutOrganizerError
+	}
+
+	return nil
+}
+
+// likePatternEscaper makes user input match literally inside a LIKE pattern that uses backslash as its escape.
+var likePatternEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// queryBuilder accumulates the conditions and positional arguments of a dynamically built query.
+type queryBuilder struct {
+	conditions []string
+	arguments  []interface{}
+}
+
+// addArgument returns the placeholder that refers to the argument.
+func (builder *queryBuilder) addArgument(argument interface{}) string {
+	builder.arguments = append(builder.arguments, argument)
+	return "$" + strconv.Itoa(len(builder.arguments))
+}
+
+func (builder *queryBuilder) addCondition(condition string) {
+	builder.conditions = append(builder.conditions, condition)
+}
+
+func (builder *queryBuilder) whereClause() string {
+	if len(builder.conditions) == 0 {
+		return ""
+	}
+
+	return "\n\t\tWHERE " + strings.Join(builder.conditions, "\n\t\t\tAND ")
+}
+
+// execExpectingOneRow returns QueryResultContainedNoRowsError if the statement affected no rows.
+func execExpectingOneRow(sqlQuery string, args ...interface{}) error {
+	result, err := db.Exec(sqlQuery, args...)
+	if err != nil {
+		return convertPostgresError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return QueryResultContainedNoRowsError
+	}
+
+	if rowsAffected > 1 {
+		return QueryResultContainedMultipleRowsError
+	}
+
+	return nil
+}
+
+// withTransaction commits if transactionFunc succeeds and rolls back otherwise.
+func withTransaction(transactionFunc func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return convertPostgresError(err)
+	}
+
+	if err := transactionFunc(tx); err != nil {
+		tx.Rollback()
+
+		if err == sql.ErrNoRows {
+			return QueryResultContainedNoRowsError
+		}
+
+		return convertPostgresError(err)
+	}
+
+	return convertPostgresError(tx.Commit())
+}
+
+// isNotePublishedCondition holds for notes that can no longer change: those that belong to a publication,
+// live or scheduled, and answers, which are read as soon as they are posted.
+const isNotePublishedCondition = `(
+	EXISTS (
+		SELECT 1 FROM note_to_publication_relationship AS published_note
+		WHERE published_note.note_id = note.id
+	)
+	OR EXISTS (
+		SELECT 1 FROM question_answer AS published_answer
+		WHERE published_answer.answer_note_id = note.id
+	)
+)`
+
+// lockNoteRowIfUnpublished returns QueryResultContainedNoRowsError if the note does not exist.
+// Answers count as published.
+func lockNoteRowIfUnpublished(tx *sql.Tx, noteId int64) error {
+	sqlQuery := `
+		SELECT ` + isNotePublishedCondition + `
+		FROM note
+		WHERE id = $1
+			AND deletion_time IS NULL
+		FOR UPDATE`
+
+	var isPublished bool
+	if err := tx.QueryRow(sqlQuery, noteId).Scan(&isPublished); err != nil {
+		return err
+	}
+
+	if isPublished {
+		return NoteAlreadyPublishedError
+	}
+
+	return nil
+}
+
+// insertNote also records the note's initial content as its first revision.
+func insertNote(
+	tx *sql.Tx,
+	authorId int64,
+	bookId *int64,
+	content string,
+	creationTime time.Time,
+) (int64, error) {
+	sqlQuery := `
+		INSERT INTO note (author_id, book_id, content, creation_time)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+
+	var noteId int64
+	if err := tx.QueryRow(sqlQuery, authorId, bookId, content, creationTime).Scan(&noteId); err != nil {
+		return 0, err
+	}
+
+	if err := insertNoteRevision(tx, noteId, content, creationTime); err != nil {
+		return 0, err
+	}
+
+	return noteId, nil
+}
+
+func insertNoteRevision(tx *sql.Tx, noteId int64, content string, creationTime time.Time) error {
+	sqlQuery := `
+		INSERT INTO note_revision (note_id, content, creation_time)
+		VALUES ($1, $2, $3)`
+
+	_, err := tx.Exec(sqlQuery, noteId, content, creationTime)
+	return err
+}
 
 func convertPostgresError(err error) error {
 	const uniqueConstraintErrorCode = "23505"
+	const foreignKeyConstraintErrorCode = "23503"
 
 	if postgresErr, ok := err.(*pq.Error); ok {
-		if postgresErr.Code == uniqueConstraintErrorCode {
+		switch postgresErr.Code {
+		case uniqueConstraintErrorCode:
 			return UniqueConstraintError
+		case foreignKeyConstraintErrorCode:
+			return ForeignKeyConstraintError
 		}
 	}
 
@@ -2,16 +2,28 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/atmiguel/cerealnotes/models"
 	"github.com/atmiguel/cerealnotes/paths"
+	"github.com/atmiguel/cerealnotes/services/agendaservice"
+	"github.com/atmiguel/cerealnotes/services/bookservice"
+	"github.com/atmiguel/cerealnotes/services/categoryservice"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+	"github.com/atmiguel/cerealnotes/services/digestservice"
 	"github.com/atmiguel/cerealnotes/services/noteservice"
+	"github.com/atmiguel/cerealnotes/services/notificationservice"
+	"github.com/atmiguel/cerealnotes/services/progressservice"
+	"github.com/atmiguel/cerealnotes/services/publicationservice"
+	"github.com/atmiguel/cerealnotes/services/scheduleservice"
+	"github.com/atmiguel/cerealnotes/services/scoringservice"
 	"github.com/atmiguel/cerealnotes/services/userservice"
 	"github.com/dgrijalva/jwt-go"
 )
@@ -30,6 +42,8 @@ type JwtTokenClaim struct {
 
 var tokenSigningKey []byte
 
+var NoteContentIsEmptyError = errors.New("Note content cannot be empty or just whitespace")
+
 func SetTokenSigningKey(key []byte) {
 	tokenSigningKey = key
 }
@@ -66,6 +80,8 @@ func HandleLoginOrSignupPageRequest(
 	}
 }
 
+// HandleUserApiRequest responds to POST requests by signing up a new user, who also joins a club
+// when the signup carries an invite token, and to GET requests with the members of the user's clubs.
 func HandleUserApiRequest(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
@@ -74,6 +90,7 @@ func HandleUserApiRequest(
 		DisplayName  string `json:"displayName"`
 		EmailAddress string `json:"emailAddress"`
 		Password     string `json:"password"`
+		InviteToken  string `json:"inviteToken"`
 	}
 
 	switch request.Method {
@@ -85,14 +102,33 @@ func HandleUserApiRequest(
 			return
 		}
 
+		var err error
+		if len(signupForm.InviteToken) > 0 {
+			inviteId, tokenErr := getInviteIdFromToken(signupForm.InviteToken)
+			if tokenErr != nil {
+				http.Error(responseWriter, clubservice.ClubInviteNotUsableError.Error(), http.StatusGone)
+				return
+			}
+
+			err = userservice.StoreNewUserJoiningClub(
+				signupForm.DisplayName,
+				models.NewEmailAddress(signupForm.EmailAddress),
+				signupForm.Password,
+				inviteId)
+		} else {
+			err = userservice.StoreNewUser(
+				signupForm.DisplayName,
+				models.NewEmailAddress(signupForm.EmailAddress),
+				signupForm.Password)
+		}
+
 		var statusCode int
-		if err := userservice.StoreNewUser(
-			signupForm.DisplayName,
-			models.NewEmailAddress(signupForm.EmailAddress),
-			signupForm.Password,
-		); err != nil {
+		if err != nil {
 			if err == userservice.EmailAddressAlreadyInUseError {
 				statusCode = http.StatusConflict
+			} else if err == clubservice.ClubInviteNotUsableError {
+				http.Error(responseWriter, err.Error(), http.StatusGone)
+				return
 			} else {
 				http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
 				return
@@ -105,17 +141,16 @@ func HandleUserApiRequest(
 
 	case http.MethodGet:
 
-		if _, err := getUserIdFromJwtToken(request); err != nil {
+		userId, err := getUserIdFromJwtToken(request)
+		if err != nil {
 			http.Error(responseWriter, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		user1 := models.User{"Adrian"}
-		user2 := models.User{"Evan"}
-
-		usersById := map[models.UserId]models.User{
-			1: user1,
-			2: user2,
+		usersById, err := clubservice.GetFellowMembers(userId)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
 		usersByIdJson, err := json.Marshal(usersById)
@@ -133,6 +168,95 @@ func HandleUserApiRequest(
 	}
 }
 
+// HandleJoinClubPageRequest is where invite links lead. It makes a logged in user a member of the invite's
+// club and redirects to the home page. Anyone else is sent to signup or log in with the invite kept along.
+func HandleJoinClubPageRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		inviteToken := request.URL.Query().Get("invite")
+
+		userId, err := getUserIdFromJwtToken(request)
+		if err != nil {
+			http.Redirect(
+				responseWriter,
+				request,
+				paths.LoginOrSignupPage+"?invite="+url.QueryEscape(inviteToken),
+				http.StatusTemporaryRedirect)
+			return
+		}
+
+		inviteId, err := getInviteIdFromToken(inviteToken)
+		if err != nil {
+			http.Error(responseWriter, clubservice.ClubInviteNotUsableError.Error(), http.StatusGone)
+			return
+		}
+
+		if _, err := clubservice.JoinClubByInvite(userId, inviteId); err != nil {
+			if err == clubservice.ClubInviteNotUsableError {
+				http.Error(responseWriter, err.Error(), http.StatusGone)
+				return
+			}
+
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(responseWriter, request, paths.HomePage, http.StatusSeeOther)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+	}
+}
+
+// HandleDigestUnsubscribePageRequest responds to GET requests carrying the token of an unsubscribe link
+// with a page asking to confirm, and to POST requests carrying the same token by no longer sending
+// that user digests. Mail clients that unsubscribe in one click POST to the link itself.
+func HandleDigestUnsubscribePageRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+) {
+	type UnsubscribePage struct {
+		Token          string
+		IsUnsubscribed bool
+	}
+
+	switch request.Method {
+	case http.MethodGet, http.MethodPost:
+		token := request.FormValue("token")
+
+		subscriberId, err := getSubscriberIdFromToken(token)
+		if err != nil {
+			http.Error(responseWriter, "The unsubscribe link is invalid", http.StatusBadRequest)
+			return
+		}
+
+		isUnsubscribed := request.Method == http.MethodPost
+		if isUnsubscribed {
+			if err := digestservice.Unsubscribe(subscriberId); err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		parsedTemplate, err := template.ParseFiles(baseTemplateFile, "templates/digest_unsubscribe.tmpl")
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		parsedTemplate.ExecuteTemplate(responseWriter, baseTemplateName, &UnsubscribePage{
+			Token:          token,
+			IsUnsubscribed: isUnsubscribed,
+		})
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPost)
+	}
+}
+
 // HandleSessionApiRequest responds to POST requests by authenticating and responding with a JWT.
 // It responds to DELETE requests by expiring the client's cookie.
 func HandleSessionApiRequest(
@@ -224,21 +348,36 @@ func HandleNoteApiRequest(
 	switch request.Method {
 	case http.MethodGet:
 
-		var notesById noteservice.NotesById = make(map[models.NoteId]*models.Note, 2)
+		filter, err := parseNoteFilterFromQuery(request, userId)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		notesById[models.NoteId(1)] = &models.Note{
-			AuthorId:     1,
-			Content:      "This is an example note.",
-			CreationTime: time.Now().Add(-oneWeek).UTC(),
+		pageSize := noteservice.DefaultNotePageSize
+		if pageSizeAsString := request.URL.Query().Get("pageSize"); len(pageSizeAsString) > 0 {
+			pageSize, err = strconv.Atoi(pageSizeAsString)
+			if err != nil || pageSize <= 0 {
+				http.Error(responseWriter, "query parameter pageSize must be a positive integer", http.StatusBadRequest)
+				return
+			}
 		}
 
-		notesById[models.NoteId(2)] = &models.Note{
-			AuthorId:     2,
-			Content:      "What is this site for?",
-			CreationTime: time.Now().Add(-60 * 12).UTC(),
+		notesPage, err := noteservice.GetNotesVisibleToUser(
+			userId,
+			filter,
+			request.URL.Query().Get("cursor"),
+			pageSize)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			if err == noteservice.InvalidNoteCursorError || err == noteservice.InvalidTagError {
+				statusCode = http.StatusBadRequest
+			}
+			http.Error(responseWriter, err.Error(), statusCode)
+			return
 		}
 
-		notesInJson, err := notesById.ToJson()
+		notesInJson, err := notesPage.ToJson()
 		if err != nil {
 			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
 			return
@@ -251,7 +390,8 @@ func HandleNoteApiRequest(
 
 	case http.MethodPost:
 		type NoteForm struct {
-			Content string `json:"content"`
+			Content string        `json:"content"`
+			BookId  models.BookId `json:"bookId"`
 		}
 
 		noteForm := new(NoteForm)
@@ -261,8 +401,8 @@ func HandleNoteApiRequest(
 			return
 		}
 
-		if len(strings.TrimSpace(noteForm.Content)) == 0 {
-			http.Error(responseWriter, "Note content cannot be empty or just whitespace", http.StatusBadRequest)
+		if err := validateNoteContent(noteForm.Content); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
 			return
 		}
 
@@ -270,10 +410,16 @@ func HandleNoteApiRequest(
 			AuthorId:     models.UserId(userId),
 			Content:      noteForm.Content,
 			CreationTime: time.Now().UTC(),
+			BookId:       noteForm.BookId,
 		}
 
 		noteId, err := noteservice.StoreNewNote(note)
 		if err != nil {
+			if err == bookservice.BookNotFoundError {
+				http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+				return
+			}
+
 			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -293,156 +439,2818 @@ func HandleNoteApiRequest(
 
 		fmt.Fprint(responseWriter, string(noteString))
 
-	default:
-		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPost)
-	}
-}
-
-func HandleNoteCateogryApiRequest(
-	responseWriter http.ResponseWriter,
-	request *http.Request,
-	userId models.UserId,
-) {
-	switch request.Method {
 	case http.MethodPut:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		id, err := strconv.ParseInt(request.URL.Query().Get("id"), 10, 64)
-		noteId := models.NoteId(id)
-
-		type CategoryForm struct {
-			Category string `json:"category"`
+		type NoteForm struct {
+			Content string `json:"content"`
 		}
 
-		categoryForm := new(CategoryForm)
+		noteForm := new(NoteForm)
 
-		if err := json.NewDecoder(request.Body).Decode(categoryForm); err != nil {
+		if err := json.NewDecoder(request.Body).Decode(noteForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := validateNoteContent(noteForm.Content); err != nil {
 			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		category, err := models.DeserializeCategory(categoryForm.Category)
+		if err := noteservice.UpdateNoteContent(userId, noteId, noteForm.Content); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
 
+	case http.MethodDelete:
+		noteId, err := parseNoteIdFromQuery(request)
 		if err != nil {
 			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		if err := noteservice.StoreNewNoteCategoryRelationship(models.NoteId(noteId), category); err != nil {
-			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+		if err := noteservice.DeleteNote(userId, noteId); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
 			return
 		}
 
-		responseWriter.WriteHeader(http.StatusCreated)
+		responseWriter.WriteHeader(http.StatusOK)
+		fmt.Fprint(responseWriter, "note moved to trash")
 
 	default:
-		respondWithMethodNotAllowed(responseWriter, http.MethodPut)
+		respondWithMethodNotAllowed(
+			responseWriter,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodDelete)
 	}
-
 }
 
-type AuthenticatedRequestHandlerType func(
-	http.ResponseWriter,
-	*http.Request,
-	models.UserId)
+// HandleNoteTrashApiRequest responds to GET requests with the user's deleted notes.
+func HandleNoteTrashApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		notesById, err := noteservice.GetDeletedNotesByAuthor(userId)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-func AuthenticateOrRedirect(
-	authenticatedHandlerFunc AuthenticatedRequestHandlerType,
-	redirectPath string,
-) http.HandlerFunc {
-	return func(responseWriter http.ResponseWriter, request *http.Request) {
-		if userId, err := getUserIdFromJwtToken(request); err != nil {
-			switch request.Method {
-			// If not logged in, redirect to login page
-			case http.MethodGet:
-				http.Redirect(
-					responseWriter,
-					request,
-					redirectPath,
-					http.StatusTemporaryRedirect)
-				return
-			default:
-				respondWithMethodNotAllowed(responseWriter, http.MethodGet)
-			}
-		} else {
-			authenticatedHandlerFunc(responseWriter, request, userId)
+		notesInJson, err := notesById.ToJson()
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
 		}
-	}
-}
 
-func AuthenticateOrReturnUnauthorized(
-	authenticatedHandlerFunc AuthenticatedRequestHandlerType,
-) http.HandlerFunc {
-	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
 
-		if userId, err := getUserIdFromJwtToken(request); err != nil {
-			responseWriter.Header().Set("WWW-Authenticate", `Bearer realm="`+request.URL.Path+`"`)
-			http.Error(responseWriter, err.Error(), http.StatusUnauthorized)
-		} else {
-			authenticatedHandlerFunc(responseWriter, request, userId)
-		}
+		fmt.Fprint(responseWriter, string(notesInJson))
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
 	}
 }
 
-func RedirectToPathHandler(
-	path string,
-) http.HandlerFunc {
-	return func(responseWriter http.ResponseWriter, request *http.Request) {
-		switch request.Method {
-		case http.MethodGet:
-			http.Redirect(
-				responseWriter,
-				request,
-				path,
-				http.StatusTemporaryRedirect)
+// HandleNoteRestoreApiRequest responds to POST requests by taking a note back out of the user's trash.
+func HandleNoteRestoreApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodPost:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.RestoreDeletedNote(userId, noteId); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
 			return
-		default:
-			respondWithMethodNotAllowed(responseWriter, http.MethodGet)
 		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodPost)
 	}
 }
 
-// AUTHENTICATED HANDLERS
-
-func HandleHomePageRequest(
+// HandleNoteRevisionApiRequest responds to GET requests with the edit history of a note.
+func HandleNoteRevisionApiRequest(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
 	userId models.UserId,
 ) {
 	switch request.Method {
 	case http.MethodGet:
-		parsedTemplate, err := template.ParseFiles(baseTemplateFile, "templates/home.tmpl")
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		revealSpoilers, err := parseRevealFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		revisions, err := noteservice.GetNoteRevisionsVisibleToUser(userId, noteId, revealSpoilers)
+		if err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		revisionsInJson, err := json.Marshal(revisions)
 		if err != nil {
 			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		parsedTemplate.ExecuteTemplate(responseWriter, baseTemplateName, userId)
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(revisionsInJson))
+
 	default:
 		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
 	}
 }
 
-func HandleNotesPageRequest(
+// HandleNoteCateogryApiRequest responds to PUT requests by setting or replacing the category of
+// one of the user's notes, and to DELETE requests by clearing it. The category is given either by
+// categoryId or by its name in category. Since the user's clubs may each define a category by the same name,
+// an optional clubId looks the name up among the default categories and those of that club only.
+func HandleNoteCateogryApiRequest(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
 	userId models.UserId,
 ) {
 	switch request.Method {
-	case http.MethodGet:
-		parsedTemplate, err := template.ParseFiles(baseTemplateFile, "templates/notes.tmpl")
+	case http.MethodPut:
+		noteId, err := parseNoteIdFromQuery(request)
 		if err != nil {
-			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		parsedTemplate.ExecuteTemplate(responseWriter, baseTemplateName, userId)
+		type CategoryForm struct {
+			CategoryId models.Category `json:"categoryId"`
+			Category   string          `json:"category"`
+			ClubId     models.ClubId   `json:"clubId"`
+		}
 
-	default:
-		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
-	}
-}
+		categoryForm := new(CategoryForm)
 
-// PRIVATE
+		if err := json.NewDecoder(request.Body).Decode(categoryForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		category := categoryForm.CategoryId
+		if category == 0 {
+			category, err = models.DeserializeCategory(userId, categoryForm.ClubId, categoryForm.Category)
+			if err != nil {
+				statusCode := http.StatusInternalServerError
+				if err == models.CannotDeserializeCategoryStringError || err == models.AmbiguousCategoryNameError {
+					statusCode = http.StatusBadRequest
+				}
+
+				http.Error(responseWriter, err.Error(), statusCode)
+				return
+			}
+		}
+
+		if err := noteservice.SetNoteCategory(userId, noteId, category); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.ClearNoteCategory(userId, noteId); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// HandleNoteBookApiRequest responds to PUT requests by setting which book a note is about
+// and to DELETE requests by detaching the note from its book.
+func HandleNoteBookApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodPut:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type BookForm struct {
+			BookId models.BookId `json:"bookId"`
+		}
+
+		bookForm := new(BookForm)
+
+		if err := json.NewDecoder(request.Body).Decode(bookForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if bookForm.BookId == 0 {
+			http.Error(responseWriter, "bookId must be a book id", http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.SetNoteBook(userId, noteId, bookForm.BookId); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.SetNoteBook(userId, noteId, 0); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// HandleNoteLocationApiRequest responds to PUT requests by anchoring a note to a chapter, page
+// or percentage of its book and to DELETE requests by clearing the note's location.
+func HandleNoteLocationApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodPut:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		location := new(models.Location)
+
+		if err := json.NewDecoder(request.Body).Decode(location); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.SetNoteLocation(userId, noteId, location); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.ClearNoteLocation(userId, noteId); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// HandleNoteTagApiRequest responds to GET requests with the tags of a note,
+// to PUT requests by attaching a tag and to DELETE requests by detaching one.
+func HandleNoteTagApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		revealSpoilers, err := parseRevealFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		note, err := noteservice.GetNoteVisibleToUser(userId, noteId, revealSpoilers)
+		if err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		tags := note.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+
+		tagsInJson, err := json.Marshal(tags)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(tagsInJson))
+
+	case http.MethodPut:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type TagForm struct {
+			Tag string `json:"tag"`
+		}
+
+		tagForm := new(TagForm)
+
+		if err := json.NewDecoder(request.Body).Decode(tagForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.AttachTagToNote(userId, noteId, tagForm.Tag); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.DetachTagFromNote(userId, noteId, request.URL.Query().Get("tag")); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// HandleTagApiRequest responds to GET requests by autocompleting the prefix query parameter
+// against the tags the user already uses.
+func HandleTagApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		tags, err := noteservice.SuggestTags(userId, request.URL.Query().Get("prefix"))
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		tagsInJson, err := json.Marshal(tags)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(tagsInJson))
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+	}
+}
+
+// HandlePublicationApiRequest responds to GET requests with every live publication, newest first,
+// optionally only those of one book or milestone, or with a single publication when an id is given.
+// It responds to POST requests by publishing either the listed notes or, when no note ids are given,
+// all of the user's unpublished notes about the book. An optional future publishAt schedules the publication,
+// and an optional milestoneId attaches it to a milestone of the reading schedule.
+func HandlePublicationApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		var publicationsInJson []byte
+
+		if len(request.URL.Query().Get("id")) > 0 {
+			id, err := strconv.ParseInt(request.URL.Query().Get("id"), 10, 64)
+			if err != nil {
+				http.Error(responseWriter, "query parameter id must be a publication id", http.StatusBadRequest)
+				return
+			}
+
+			revealSpoilers, err := parseRevealFromQuery(request)
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			publication, err := publicationservice.GetPublicationVisibleToUser(
+				userId,
+				models.PublicationId(id),
+				revealSpoilers)
+			if err != nil {
+				statusCode := http.StatusInternalServerError
+				if err == publicationservice.PublicationNotFoundError {
+					statusCode = http.StatusNotFound
+				}
+				http.Error(responseWriter, err.Error(), statusCode)
+				return
+			}
+
+			publicationsInJson, err = json.Marshal(publication)
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			bookId, err := parseOptionalBookIdFromQuery(request)
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			milestoneId, err := parseOptionalMilestoneIdFromQuery(request)
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			revealSpoilers, err := parseRevealFromQuery(request)
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			publications, err := publicationservice.GetLivePublications(userId, &publicationservice.PublicationFilter{
+				BookId:         bookId,
+				MilestoneId:    milestoneId,
+				RevealSpoilers: revealSpoilers,
+			})
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			publicationsInJson, err = json.Marshal(publications)
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(publicationsInJson))
+
+	case http.MethodPost:
+		type PublicationForm struct {
+			BookId       models.BookId       `json:"bookId"`
+			MilestoneId  *models.MilestoneId `json:"milestoneId"`
+			NoteIds      []models.NoteId     `json:"noteIds"`
+			Title        string              `json:"title"`
+			IntroMessage string              `json:"introMessage"`
+			PublishAt    *time.Time          `json:"publishAt"`
+		}
+
+		publicationForm := new(PublicationForm)
+
+		if err := json.NewDecoder(request.Body).Decode(publicationForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if publicationForm.BookId == 0 {
+			http.Error(responseWriter, "a publication must name the book it is about", http.StatusBadRequest)
+			return
+		}
+
+		publicationId, err := publicationservice.PublishNotes(
+			userId,
+			publicationForm.BookId,
+			publicationForm.MilestoneId,
+			strings.TrimSpace(publicationForm.Title),
+			strings.TrimSpace(publicationForm.IntroMessage),
+			publicationForm.NoteIds,
+			publicationForm.PublishAt)
+		if err != nil {
+			switch err {
+			case publicationservice.NoNotesToPublishError,
+				publicationservice.NoteNotAboutBookError,
+				publicationservice.MilestoneNotAboutBookError:
+				http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+				return
+			case scheduleservice.MilestoneNotFoundError:
+				http.Error(responseWriter, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		type PublicationResponse struct {
+			PublicationId models.PublicationId `json:"publicationId"`
+		}
+
+		publicationString, err := json.Marshal(&PublicationResponse{PublicationId: publicationId})
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusCreated)
+
+		fmt.Fprint(responseWriter, string(publicationString))
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPost)
+	}
+}
+
+// HandlePublicationRetractionApiRequest responds to POST requests by retracting one of the user's publications.
+func HandlePublicationRetractionApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodPost:
+		id, err := strconv.ParseInt(request.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(responseWriter, "query parameter id must be a publication id", http.StatusBadRequest)
+			return
+		}
+
+		if err := publicationservice.RetractPublication(userId, models.PublicationId(id)); err != nil {
+			statusCode := http.StatusInternalServerError
+
+			switch err {
+			case publicationservice.PublicationNotFoundError:
+				statusCode = http.StatusNotFound
+			case publicationservice.PublicationNotAuthoredByUserError:
+				statusCode = http.StatusForbidden
+			case publicationservice.PublicationAlreadyRetractedError,
+				publicationservice.RetractionWindowClosedError:
+				statusCode = http.StatusConflict
+			}
+
+			http.Error(responseWriter, err.Error(), statusCode)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusCreated)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodPost)
+	}
+}
+
+// HandlePredictionApiRequest responds to PUT requests by setting the confidence of one of the user's
+// predictions. A null confidence clears it.
+func HandlePredictionApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodPut:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type PredictionForm struct {
+			Confidence *int `json:"confidence"`
+		}
+
+		predictionForm := new(PredictionForm)
+
+		if err := json.NewDecoder(request.Body).Decode(predictionForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.SetPredictionConfidence(userId, noteId, predictionForm.Confidence); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodPut)
+	}
+}
+
+// HandlePredictionResolutionApiRequest responds to POST requests by resolving a prediction
+// as correct, incorrect or void. Only its author and the organizers of the author's clubs may resolve it.
+func HandlePredictionResolutionApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodPost:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type ResolutionForm struct {
+			Outcome string `json:"outcome"`
+		}
+
+		resolutionForm := new(ResolutionForm)
+
+		if err := json.NewDecoder(request.Body).Decode(resolutionForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		outcome, err := models.DeserializePredictionOutcome(resolutionForm.Outcome)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.ResolvePrediction(userId, noteId, outcome); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodPost)
+	}
+}
+
+// HandleQuestionAnswerApiRequest responds to GET requests with the answers to a question
+// and to POST requests by answering it.
+func HandleQuestionAnswerApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		questionId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		revealSpoilers, err := parseRevealFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		answers, err := noteservice.GetAnswersVisibleToUser(userId, questionId, revealSpoilers)
+		if err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		type AnswersResponse struct {
+			Answers       []*models.NoteWithId `json:"answers"`
+			WithheldCount int                  `json:"withheldCount"`
+		}
+
+		answersInJson, err := json.Marshal(&AnswersResponse{
+			Answers:       answers,
+			WithheldCount: noteservice.CountWithheldNotes(answers),
+		})
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(answersInJson))
+
+	case http.MethodPost:
+		questionId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type AnswerForm struct {
+			Content string `json:"content"`
+		}
+
+		answerForm := new(AnswerForm)
+
+		if err := json.NewDecoder(request.Body).Decode(answerForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := validateNoteContent(answerForm.Content); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		answerId, err := noteservice.StoreNewAnswer(userId, questionId, answerForm.Content)
+		if err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		type NoteResponse struct {
+			NoteId int64 `json:"noteId"`
+		}
+
+		noteString, err := json.Marshal(&NoteResponse{NoteId: int64(answerId)})
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusCreated)
+
+		fmt.Fprint(responseWriter, string(noteString))
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPost)
+	}
+}
+
+// HandleAcceptedAnswerApiRequest responds to PUT requests by accepting an answer to one of the
+// user's questions and to DELETE requests by clearing the accepted answer.
+func HandleAcceptedAnswerApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodPut:
+		questionId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type AcceptanceForm struct {
+			AnswerId int64 `json:"answerId"`
+		}
+
+		acceptanceForm := new(AcceptanceForm)
+
+		if err := json.NewDecoder(request.Body).Decode(acceptanceForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.AcceptAnswer(userId, questionId, models.NoteId(acceptanceForm.AnswerId)); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		questionId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.ClearAcceptedAnswer(userId, questionId); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// HandleNoteReactionApiRequest responds to GET requests with who reacted to a note and how,
+// to POST requests by adding one of the user's reactions and to DELETE requests by removing one.
+func HandleNoteReactionApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		reactions, err := noteservice.GetReactionsVisibleToUser(userId, noteId)
+		if err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		reactionsInJson, err := json.Marshal(reactions)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(reactionsInJson))
+
+	case http.MethodPost:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type ReactionForm struct {
+			Reaction models.Reaction `json:"reaction"`
+		}
+
+		reactionForm := new(ReactionForm)
+
+		if err := json.NewDecoder(request.Body).Decode(reactionForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.AddReaction(userId, noteId, reactionForm.Reaction); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusCreated)
+
+	case http.MethodDelete:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		reaction, err := models.DeserializeReaction(request.URL.Query().Get("reaction"))
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.RemoveReaction(userId, noteId, reaction); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// HandleNoteCommentApiRequest responds to GET requests with the discussion of a note and to POST requests
+// by commenting on it. PUT and DELETE requests edit and delete one of the user's comments,
+// named by the commentId query parameter.
+func HandleNoteCommentApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		revealSpoilers, err := parseRevealFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		thread, err := noteservice.GetCommentThreadVisibleToUser(userId, noteId, revealSpoilers)
+		if err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		threadInJson, err := json.Marshal(thread)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(threadInJson))
+
+	case http.MethodPost:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type CommentForm struct {
+			Content  string `json:"content"`
+			ParentId int64  `json:"parentId"`
+		}
+
+		commentForm := new(CommentForm)
+
+		if err := json.NewDecoder(request.Body).Decode(commentForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := validateNoteContent(commentForm.Content); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		commentId, err := noteservice.StoreNewComment(
+			userId,
+			noteId,
+			models.CommentId(commentForm.ParentId),
+			commentForm.Content)
+		if err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		type CommentResponse struct {
+			CommentId int64 `json:"commentId"`
+		}
+
+		commentString, err := json.Marshal(&CommentResponse{CommentId: int64(commentId)})
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusCreated)
+
+		fmt.Fprint(responseWriter, string(commentString))
+
+	case http.MethodPut:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		commentId, err := parseCommentIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type CommentForm struct {
+			Content string `json:"content"`
+		}
+
+		commentForm := new(CommentForm)
+
+		if err := json.NewDecoder(request.Body).Decode(commentForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := validateNoteContent(commentForm.Content); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.UpdateCommentContent(userId, noteId, commentId, commentForm.Content); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		commentId, err := parseCommentIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.DeleteComment(userId, noteId, commentId); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(
+			responseWriter,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodDelete)
+	}
+}
+
+// HandleNoteCommentLockApiRequest responds to PUT requests by locking the comments of one of the user's notes
+// and to DELETE requests by unlocking them.
+func HandleNoteCommentLockApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodPut:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.LockComments(userId, noteId); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		noteId, err := parseNoteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := noteservice.UnlockComments(userId, noteId); err != nil {
+			respondWithNoteServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// HandleMentionApiRequest responds to GET requests with the most recent mentions of the user
+// in the notes and comments the user can read.
+func HandleMentionApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		revealSpoilers, err := parseRevealFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mentionsPage, err := noteservice.GetMentionsOfUser(userId, revealSpoilers)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		mentionsInJson, err := mentionsPage.ToJson()
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(mentionsInJson))
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+	}
+}
+
+// HandleNotificationApiRequest responds to GET requests with a page of the user's notifications along with
+// their unread count, and to PUT requests by marking the notifications listed in the body read,
+// or all of them when the body lists none. Optional unread, cursor and pageSize query parameters
+// narrow down and page the listing.
+func HandleNotificationApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		isUnreadOnly := false
+		if unreadAsString := request.URL.Query().Get("unread"); len(unreadAsString) > 0 {
+			var err error
+			isUnreadOnly, err = strconv.ParseBool(unreadAsString)
+			if err != nil {
+				http.Error(responseWriter, "query parameter unread must be true or false", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var cursor int64
+		if cursorAsString := request.URL.Query().Get("cursor"); len(cursorAsString) > 0 {
+			var err error
+			cursor, err = strconv.ParseInt(cursorAsString, 10, 64)
+			if err != nil {
+				http.Error(responseWriter, "query parameter cursor must be a notification id", http.StatusBadRequest)
+				return
+			}
+		}
+
+		pageSize := notificationservice.DefaultNotificationPageSize
+		if pageSizeAsString := request.URL.Query().Get("pageSize"); len(pageSizeAsString) > 0 {
+			var err error
+			pageSize, err = strconv.Atoi(pageSizeAsString)
+			if err != nil || pageSize <= 0 {
+				http.Error(responseWriter, "query parameter pageSize must be a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+
+		inbox, err := notificationservice.GetInbox(
+			userId,
+			isUnreadOnly,
+			models.NotificationId(cursor),
+			pageSize)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		inboxInJson, err := json.Marshal(inbox)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(inboxInJson))
+
+	case http.MethodPut:
+		type ReadForm struct {
+			NotificationIds []models.NotificationId `json:"notificationIds"`
+		}
+
+		readForm := new(ReadForm)
+
+		if err := json.NewDecoder(request.Body).Decode(readForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := notificationservice.MarkNotificationsRead(userId, readForm.NotificationIds); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPut)
+	}
+}
+
+// HandleDigestSubscriptionApiRequest responds to GET requests with how often the user receives
+// the email digest, or null if the user receives none. PUT requests set the frequency,
+// and DELETE requests stop the digest.
+func HandleDigestSubscriptionApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		subscription, err := digestservice.GetSubscription(userId)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		subscriptionInJson, err := json.Marshal(subscription)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(subscriptionInJson))
+
+	case http.MethodPut:
+		type SubscriptionForm struct {
+			Frequency *models.DigestFrequency `json:"frequency"`
+		}
+
+		subscriptionForm := new(SubscriptionForm)
+
+		if err := json.NewDecoder(request.Body).Decode(subscriptionForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if subscriptionForm.Frequency == nil {
+			http.Error(responseWriter, "frequency must be daily or weekly", http.StatusBadRequest)
+			return
+		}
+
+		if err := digestservice.Subscribe(userId, *subscriptionForm.Frequency); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		if err := digestservice.Unsubscribe(userId); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// HandlePredictionLeaderboardApiRequest responds to GET requests with the prediction score of every member
+// of the user's clubs, best first. Optional clubId and bookId query parameters score the members of one club
+// or the predictions about one book only.
+func HandlePredictionLeaderboardApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		bookId, err := parseOptionalBookIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		clubId, err := parseOptionalClubIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		leaderboard, err := scoringservice.GetLeaderboard(userId, clubId, bookId)
+		if err != nil {
+			respondWithClubServiceError(responseWriter, err)
+			return
+		}
+
+		leaderboardInJson, err := json.Marshal(leaderboard)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(leaderboardInJson))
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+	}
+}
+
+// HandleBookApiRequest responds to GET requests with the book catalog, or with a single book
+// when an id is given, to POST requests by adding a book, and to PUT and DELETE requests
+// by changing or removing a book the user added.
+func HandleBookApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	type BookForm struct {
+		Title    string   `json:"title"`
+		Authors  []string `json:"authors"`
+		Isbn     string   `json:"isbn"`
+		Edition  string   `json:"edition"`
+		Chapters []string `json:"chapters"`
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		var booksInJson []byte
+
+		if len(request.URL.Query().Get("id")) > 0 {
+			bookId, err := parseBookIdFromQuery(request)
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			book, err := bookservice.GetBookById(bookId)
+			if err != nil {
+				respondWithBookServiceError(responseWriter, err)
+				return
+			}
+
+			booksInJson, err = json.Marshal(&models.BookWithId{Id: bookId, Book: book})
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			books, err := bookservice.GetBooks()
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			booksInJson, err = json.Marshal(books)
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(booksInJson))
+
+	case http.MethodPost:
+		bookForm := new(BookForm)
+
+		if err := json.NewDecoder(request.Body).Decode(bookForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bookId, err := bookservice.StoreNewBook(userId, &models.Book{
+			Title:    bookForm.Title,
+			Authors:  bookForm.Authors,
+			Isbn:     bookForm.Isbn,
+			Edition:  bookForm.Edition,
+			Chapters: bookForm.Chapters,
+		})
+		if err != nil {
+			respondWithBookServiceError(responseWriter, err)
+			return
+		}
+
+		type BookResponse struct {
+			BookId models.BookId `json:"bookId"`
+		}
+
+		bookString, err := json.Marshal(&BookResponse{BookId: bookId})
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusCreated)
+
+		fmt.Fprint(responseWriter, string(bookString))
+
+	case http.MethodPut:
+		bookId, err := parseBookIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bookForm := new(BookForm)
+
+		if err := json.NewDecoder(request.Body).Decode(bookForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := bookservice.UpdateBook(userId, bookId, &models.Book{
+			Title:    bookForm.Title,
+			Authors:  bookForm.Authors,
+			Isbn:     bookForm.Isbn,
+			Edition:  bookForm.Edition,
+			Chapters: bookForm.Chapters,
+		}); err != nil {
+			respondWithBookServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		bookId, err := parseBookIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := bookservice.DeleteBook(userId, bookId); err != nil {
+			respondWithBookServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(
+			responseWriter,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodDelete)
+	}
+}
+
+// HandleReadingProgressApiRequest responds to GET requests with the user's current progress in every book,
+// or with their whole history in one book when a bookId is given, newest first.
+// It responds to POST requests by recording how far the user has read into the book.
+func HandleReadingProgressApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	bookId, err := parseOptionalBookIdFromQuery(request)
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		var progresses []*models.ReadingProgress
+
+		if bookId != nil {
+			progresses, err = progressservice.GetReadingProgressHistory(userId, *bookId)
+		} else {
+			progresses, err = progressservice.GetCurrentReadingProgress(userId)
+		}
+
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		progressesInJson, err := json.Marshal(progresses)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(progressesInJson))
+
+	case http.MethodPost:
+		if bookId == nil {
+			http.Error(responseWriter, "query parameter bookId is required", http.StatusBadRequest)
+			return
+		}
+
+		location := new(models.Location)
+
+		if err := json.NewDecoder(request.Body).Decode(location); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := progressservice.RecordReadingProgress(userId, *bookId, location); err != nil {
+			if err == progressservice.InvalidReadingProgressError {
+				http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			respondWithBookServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusCreated)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPost)
+	}
+}
+
+// HandleCategoryApiRequest responds to GET requests with the default categories and those of
+// the user's clubs in sort order, each with its id and club, and to POST requests by defining
+// a new category for the club given by the clubId query parameter.
+func HandleCategoryApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		categoryDefinitions, err := categoryservice.GetCategoryDefinitions(userId)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		categoriesInJson, err := json.Marshal(categoryDefinitions)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(categoriesInJson))
+
+	case http.MethodPost:
+		clubId, err := parseClubIdFromQuery(request, "clubId")
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		categoryDefinition := new(models.CategoryDefinition)
+
+		if err := json.NewDecoder(request.Body).Decode(categoryDefinition); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, err := categoryservice.StoreNewCategory(userId, clubId, categoryDefinition); err != nil {
+			statusCode := http.StatusInternalServerError
+
+			switch err {
+			case categoryservice.InvalidCategoryNameError, categoryservice.InvalidCategoryColorError:
+				statusCode = http.StatusBadRequest
+			case categoryservice.CategoryNameAlreadyInUseError:
+				statusCode = http.StatusConflict
+			case clubservice.ClubNotFoundError:
+				statusCode = http.StatusNotFound
+			case clubservice.NotClubOrganizerError:
+				statusCode = http.StatusForbidden
+			}
+
+			http.Error(responseWriter, err.Error(), statusCode)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusCreated)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPost)
+	}
+}
+
+// HandleClubApiRequest responds to GET requests with the clubs the user belongs to and the user's role
+// in each, and to POST requests by starting a new club with the user as its organizer.
+func HandleClubApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	type ClubForm struct {
+		Name string `json:"name"`
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		clubs, err := clubservice.GetClubsOfUser(userId)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		clubsInJson, err := json.Marshal(clubs)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(clubsInJson))
+
+	case http.MethodPost:
+		clubForm := new(ClubForm)
+
+		if err := json.NewDecoder(request.Body).Decode(clubForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		clubId, err := clubservice.CreateClub(userId, clubForm.Name)
+		if err != nil {
+			respondWithClubServiceError(responseWriter, err)
+			return
+		}
+
+		type ClubResponse struct {
+			ClubId models.ClubId `json:"clubId"`
+		}
+
+		clubString, err := json.Marshal(&ClubResponse{ClubId: clubId})
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusCreated)
+
+		fmt.Fprint(responseWriter, string(clubString))
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPost)
+	}
+}
+
+// HandleClubMemberApiRequest responds to GET requests with the members of the club given by the id
+// query parameter, to PUT requests by changing the role of one of its members, and to DELETE requests
+// by taking the user out of the club.
+func HandleClubMemberApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	type RoleForm struct {
+		UserId models.UserId   `json:"userId"`
+		Role   models.ClubRole `json:"role"`
+	}
+
+	clubId, err := parseClubIdFromQuery(request, "id")
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		members, err := clubservice.GetClubMembersVisibleToUser(userId, clubId)
+		if err != nil {
+			respondWithClubServiceError(responseWriter, err)
+			return
+		}
+
+		membersInJson, err := json.Marshal(members)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(membersInJson))
+
+	case http.MethodPut:
+		roleForm := new(RoleForm)
+
+		if err := json.NewDecoder(request.Body).Decode(roleForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := clubservice.ChangeMemberRole(userId, clubId, roleForm.UserId, roleForm.Role); err != nil {
+			respondWithClubServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		if err := clubservice.LeaveClub(userId, clubId); err != nil {
+			respondWithClubServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// HandleClubInviteApiRequest lets organizers manage the invites of a club. It responds to GET requests
+// with the outstanding invites of the club given by the clubId query parameter, each with its link,
+// and to POST requests by creating an invite to that club. PUT requests change the use limit of the invite
+// given by the id query parameter, and DELETE requests revoke it.
+func HandleClubInviteApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	const defaultInviteLifetimeInDays = 7
+
+	type InviteForm struct {
+		MaxUses        *int `json:"maxUses"`
+		LifetimeInDays int  `json:"lifetimeInDays"`
+	}
+
+	type InviteWithLink struct {
+		*models.ClubInviteWithId
+		Link string `json:"link"`
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		clubId, err := parseClubIdFromQuery(request, "clubId")
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		invites, err := clubservice.GetOutstandingInvites(userId, clubId)
+		if err != nil {
+			respondWithClubServiceError(responseWriter, err)
+			return
+		}
+
+		invitesWithLinks := make([]*InviteWithLink, 0, len(invites))
+		for _, invite := range invites {
+			link, err := createInviteLink(invite.Id, invite.ExpirationTime)
+			if err != nil {
+				http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			invitesWithLinks = append(invitesWithLinks, &InviteWithLink{ClubInviteWithId: invite, Link: link})
+		}
+
+		invitesInJson, err := json.Marshal(invitesWithLinks)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(invitesInJson))
+
+	case http.MethodPost:
+		clubId, err := parseClubIdFromQuery(request, "clubId")
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		inviteForm := &InviteForm{LifetimeInDays: defaultInviteLifetimeInDays}
+
+		if err := json.NewDecoder(request.Body).Decode(inviteForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		inviteId, invite, err := clubservice.CreateInvite(
+			userId,
+			clubId,
+			inviteForm.MaxUses,
+			time.Duration(inviteForm.LifetimeInDays)*24*time.Hour)
+		if err != nil {
+			respondWithClubServiceError(responseWriter, err)
+			return
+		}
+
+		link, err := createInviteLink(inviteId, invite.ExpirationTime)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		inviteString, err := json.Marshal(&InviteWithLink{
+			ClubInviteWithId: &models.ClubInviteWithId{Id: inviteId, ClubInvite: invite},
+			Link:             link,
+		})
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusCreated)
+
+		fmt.Fprint(responseWriter, string(inviteString))
+
+	case http.MethodPut:
+		inviteId, err := parseClubInviteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		inviteForm := new(InviteForm)
+
+		if err := json.NewDecoder(request.Body).Decode(inviteForm); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := clubservice.SetInviteMaxUses(userId, inviteId, inviteForm.MaxUses); err != nil {
+			respondWithClubServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		inviteId, err := parseClubInviteIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := clubservice.RevokeInvite(userId, inviteId); err != nil {
+			respondWithClubServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(
+			responseWriter,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodDelete)
+	}
+}
+
+// HandleReadingScheduleApiRequest responds to GET requests with the reading schedule of the club
+// given by the clubId query parameter for the book given by the bookId query parameter,
+// along with the milestone that is current.
+func HandleReadingScheduleApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		clubId, err := parseClubIdFromQuery(request, "clubId")
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bookId, err := parseOptionalBookIdFromQuery(request)
+		if err != nil || bookId == nil {
+			http.Error(responseWriter, "query parameter bookId must be a book id", http.StatusBadRequest)
+			return
+		}
+
+		schedule, err := scheduleservice.GetSchedule(userId, clubId, *bookId)
+		if err != nil {
+			respondWithScheduleServiceError(responseWriter, err)
+			return
+		}
+
+		scheduleInJson, err := json.Marshal(schedule)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(responseWriter, string(scheduleInJson))
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+	}
+}
+
+// HandleMilestoneApiRequest lets organizers edit the reading schedule of their club. It responds to POST
+// requests by adding a milestone, and to PUT and DELETE requests by changing or removing the milestone
+// given by the id query parameter.
+func HandleMilestoneApiRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodPost:
+		milestone := new(models.Milestone)
+
+		if err := json.NewDecoder(request.Body).Decode(milestone); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		milestoneId, err := scheduleservice.CreateMilestone(userId, milestone)
+		if err != nil {
+			respondWithScheduleServiceError(responseWriter, err)
+			return
+		}
+
+		type MilestoneResponse struct {
+			MilestoneId models.MilestoneId `json:"milestoneId"`
+		}
+
+		milestoneString, err := json.Marshal(&MilestoneResponse{MilestoneId: milestoneId})
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusCreated)
+
+		fmt.Fprint(responseWriter, string(milestoneString))
+
+	case http.MethodPut:
+		milestoneId, err := parseMilestoneIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		milestone := new(models.Milestone)
+
+		if err := json.NewDecoder(request.Body).Decode(milestone); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := scheduleservice.UpdateMilestone(userId, milestoneId, milestone); err != nil {
+			respondWithScheduleServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		milestoneId, err := parseMilestoneIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := scheduleservice.DeleteMilestone(userId, milestoneId); err != nil {
+			respondWithScheduleServiceError(responseWriter, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusOK)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodPost, http.MethodPut, http.MethodDelete)
+	}
+}
+
+type AuthenticatedRequestHandlerType func(
+	http.ResponseWriter,
+	*http.Request,
+	models.UserId)
+
+func AuthenticateOrRedirect(
+	authenticatedHandlerFunc AuthenticatedRequestHandlerType,
+	redirectPath string,
+) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		if userId, err := getUserIdFromJwtToken(request); err != nil {
+			switch request.Method {
+			// If not logged in, redirect to login page
+			case http.MethodGet:
+				http.Redirect(
+					responseWriter,
+					request,
+					redirectPath,
+					http.StatusTemporaryRedirect)
+				return
+			default:
+				respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+			}
+		} else {
+			authenticatedHandlerFunc(responseWriter, request, userId)
+		}
+	}
+}
+
+func AuthenticateOrReturnUnauthorized(
+	authenticatedHandlerFunc AuthenticatedRequestHandlerType,
+) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+
+		if userId, err := getUserIdFromJwtToken(request); err != nil {
+			responseWriter.Header().Set("WWW-Authenticate", `Bearer realm="`+request.URL.Path+`"`)
+			http.Error(responseWriter, err.Error(), http.StatusUnauthorized)
+		} else {
+			authenticatedHandlerFunc(responseWriter, request, userId)
+		}
+	}
+}
+
+func RedirectToPathHandler(
+	path string,
+) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+			http.Redirect(
+				responseWriter,
+				request,
+				path,
+				http.StatusTemporaryRedirect)
+			return
+		default:
+			respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+		}
+	}
+}
+
+// AUTHENTICATED HANDLERS
+
+func HandleHomePageRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		unreadCount, err := notificationservice.CountUnreadNotifications(userId)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		parsedTemplate, err := template.ParseFiles(baseTemplateFile, "templates/home.tmpl")
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		type HomePage struct {
+			UserId                  models.UserId
+			UnreadNotificationCount int
+		}
+
+		parsedTemplate.ExecuteTemplate(responseWriter, baseTemplateName, &HomePage{
+			UserId:                  userId,
+			UnreadNotificationCount: unreadCount,
+		})
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+	}
+}
+
+func HandleNotesPageRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		parsedTemplate, err := template.ParseFiles(baseTemplateFile, "templates/notes.tmpl")
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		parsedTemplate.ExecuteTemplate(responseWriter, baseTemplateName, userId)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+	}
+}
+
+// HandlePublicationsPageRequest responds with every live publication rendered server side, newest first.
+// Optional bookId and milestoneId query parameters show the publications of one book or milestone only,
+// and the latter also links to the milestones before and after it.
+func HandlePublicationsPageRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		bookId, err := parseOptionalBookIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		milestoneId, err := parseOptionalMilestoneIdFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		revealSpoilers, err := parseRevealFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		publications, err := publicationservice.GetLivePublications(userId, &publicationservice.PublicationFilter{
+			BookId:         bookId,
+			MilestoneId:    milestoneId,
+			RevealSpoilers: revealSpoilers,
+		})
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		type PublicationsPage struct {
+			Publications []*publicationservice.PublicationWithNotes
+			// the current query with reveal=true added, to show withheld notes
+			RevealQuery string
+			// set when browsing the publications of one milestone, along with its neighbours in the schedule
+			Milestone           *models.MilestoneWithId
+			PreviousMilestoneId models.MilestoneId
+			NextMilestoneId     models.MilestoneId
+		}
+
+		publicationsPage := &PublicationsPage{Publications: publications}
+
+		if milestoneId != nil {
+			milestone, err := scheduleservice.GetMilestoneVisibleToUser(userId, *milestoneId)
+			if err != nil {
+				respondWithScheduleServiceError(responseWriter, err)
+				return
+			}
+
+			schedule, err := scheduleservice.GetSchedule(userId, milestone.ClubId, milestone.BookId)
+			if err != nil {
+				respondWithScheduleServiceError(responseWriter, err)
+				return
+			}
+
+			publicationsPage.Milestone = &models.MilestoneWithId{Id: *milestoneId, Milestone: milestone}
+
+			for i, scheduledMilestone := range schedule.Milestones {
+				if scheduledMilestone.Id != *milestoneId {
+					continue
+				}
+
+				if i > 0 {
+					publicationsPage.PreviousMilestoneId = schedule.Milestones[i-1].Id
+				}
+
+				if i+1 < len(schedule.Milestones) {
+					publicationsPage.NextMilestoneId = schedule.Milestones[i+1].Id
+				}
+			}
+		}
+
+		revealQuery := request.URL.Query()
+		revealQuery.Set("reveal", "true")
+
+		parsedTemplate, err := template.ParseFiles(baseTemplateFile, "templates/publications.tmpl")
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		publicationsPage.RevealQuery = revealQuery.Encode()
+
+		parsedTemplate.ExecuteTemplate(responseWriter, baseTemplateName, publicationsPage)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+	}
+}
+
+// HandleAgendaPageRequest responds with a print-friendly meeting agenda of the open questions published
+// for the milestone given by the milestoneId query parameter, or within the dates given by the from and to
+// query parameters (YYYY-MM-DD, both included). An optional bookId narrows it to one book, predictions=true
+// adds the predictions, and groupBy=chapter groups items by chapter instead of by author.
+// With format=markdown the agenda is downloaded as a Markdown file instead.
+func HandleAgendaPageRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	const agendaQueryDateFormat = "2006-01-02"
+
+	switch request.Method {
+	case http.MethodGet:
+		query := request.URL.Query()
+		filter := new(agendaservice.AgendaFilter)
+
+		var err error
+		if filter.BookId, err = parseOptionalBookIdFromQuery(request); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if filter.MilestoneId, err = parseOptionalMilestoneIdFromQuery(request); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if from := query.Get("from"); len(from) > 0 {
+			publishedAfter, err := time.Parse(agendaQueryDateFormat, from)
+			if err != nil {
+				http.Error(responseWriter, "query parameter from must be a date such as 2018-07-31", http.StatusBadRequest)
+				return
+			}
+
+			filter.PublishedAfter = &publishedAfter
+		}
+
+		if to := query.Get("to"); len(to) > 0 {
+			lastDay, err := time.Parse(agendaQueryDateFormat, to)
+			if err != nil {
+				http.Error(responseWriter, "query parameter to must be a date such as 2018-07-31", http.StatusBadRequest)
+				return
+			}
+
+			publishedBefore := lastDay.AddDate(0, 0, 1)
+			filter.PublishedBefore = &publishedBefore
+		}
+
+		if predictions := query.Get("predictions"); len(predictions) > 0 {
+			if filter.IncludePredictions, err = strconv.ParseBool(predictions); err != nil {
+				http.Error(responseWriter, "query parameter predictions must be true or false", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if groupBy := query.Get("groupBy"); len(groupBy) > 0 {
+			if filter.GroupBy, err = models.DeserializeAgendaGrouping(groupBy); err != nil {
+				http.Error(responseWriter, "query parameter groupBy must be author or chapter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if filter.RevealSpoilers, err = parseRevealFromQuery(request); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		agenda, err := agendaservice.CompileAgenda(userId, filter)
+		if err != nil {
+			respondWithScheduleServiceError(responseWriter, err)
+			return
+		}
+
+		switch query.Get("format") {
+		case "", "html":
+		case "markdown":
+			responseWriter.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			responseWriter.Header().Set("Content-Disposition", `attachment; filename="agenda.md"`)
+			responseWriter.WriteHeader(http.StatusOK)
+
+			fmt.Fprint(responseWriter, agendaservice.RenderMarkdown(agenda))
+			return
+		default:
+			http.Error(responseWriter, "query parameter format must be html or markdown", http.StatusBadRequest)
+			return
+		}
+
+		type AgendaPage struct {
+			Agenda              *agendaservice.Agenda
+			IncludesPredictions bool
+			// the current query with format=markdown added, to download the agenda
+			MarkdownQuery string
+			// the current query with reveal=true added, to show withheld items
+			RevealQuery string
+		}
+
+		markdownQuery := request.URL.Query()
+		markdownQuery.Set("format", "markdown")
+
+		revealQuery := request.URL.Query()
+		revealQuery.Set("reveal", "true")
+
+		parsedTemplate, err := template.ParseFiles(baseTemplateFile, "templates/agenda.tmpl")
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		parsedTemplate.ExecuteTemplate(responseWriter, baseTemplateName, &AgendaPage{
+			Agenda:              agenda,
+			IncludesPredictions: filter.IncludePredictions,
+			MarkdownQuery:       markdownQuery.Encode(),
+			RevealQuery:         revealQuery.Encode(),
+		})
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+	}
+}
+
+// HandleChapterPageRequest responds with the notes about one chapter of a book rendered server side,
+// in the order they come up in the book. It expects the bookId and chapter query parameters.
+func HandleChapterPageRequest(
+	responseWriter http.ResponseWriter,
+	request *http.Request,
+	userId models.UserId,
+) {
+	switch request.Method {
+	case http.MethodGet:
+		bookId, err := parseOptionalBookIdFromQuery(request)
+		if err != nil || bookId == nil {
+			http.Error(responseWriter, "query parameter bookId must be a book id", http.StatusBadRequest)
+			return
+		}
+
+		chapter, err := strconv.Atoi(request.URL.Query().Get("chapter"))
+		if err != nil || chapter < 1 {
+			http.Error(responseWriter, "query parameter chapter must be a positive integer", http.StatusBadRequest)
+			return
+		}
+
+		book, err := bookservice.GetBookById(*bookId)
+		if err != nil {
+			respondWithBookServiceError(responseWriter, err)
+			return
+		}
+
+		revealSpoilers, err := parseRevealFromQuery(request)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		notes, err := noteservice.GetChapterNotesVisibleToUser(userId, *bookId, chapter, revealSpoilers)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		type ChapterPage struct {
+			Book          *models.Book
+			BookId        models.BookId
+			Chapter       int
+			ChapterTitle  string
+			Notes         []*models.NoteWithId
+			WithheldCount int
+		}
+
+		chapterPage := &ChapterPage{
+			Book:          book,
+			BookId:        *bookId,
+			Chapter:       chapter,
+			Notes:         notes,
+			WithheldCount: noteservice.CountWithheldNotes(notes),
+		}
+		if chapter <= len(book.Chapters) {
+			chapterPage.ChapterTitle = book.Chapters[chapter-1]
+		}
+
+		parsedTemplate, err := template.ParseFiles(baseTemplateFile, "templates/chapter.tmpl")
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		parsedTemplate.ExecuteTemplate(responseWriter, baseTemplateName, chapterPage)
+
+	default:
+		respondWithMethodNotAllowed(responseWriter, http.MethodGet)
+	}
+}
+
+// PRIVATE
+
+func validateNoteContent(content string) error {
+	if len(strings.TrimSpace(content)) == 0 {
+		return NoteContentIsEmptyError
+	}
+
+	return nil
+}
+
+func parseNoteIdFromQuery(request *http.Request) (models.NoteId, error) {
+	id, err := strconv.ParseInt(request.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("query parameter id must be a note id: %s", err)
+	}
+
+	return models.NoteId(id), nil
+}
+
+func parseCommentIdFromQuery(request *http.Request) (models.CommentId, error) {
+	id, err := strconv.ParseInt(request.URL.Query().Get("commentId"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("query parameter commentId must be a comment id: %s", err)
+	}
+
+	return models.CommentId(id), nil
+}
+
+func parseBookIdFromQuery(request *http.Request) (models.BookId, error) {
+	id, err := strconv.ParseInt(request.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("query parameter id must be a book id: %s", err)
+	}
+
+	return models.BookId(id), nil
+}
+
+// parseOptionalBookIdFromQuery returns nil when the bookId query parameter is absent.
+func parseOptionalBookIdFromQuery(request *http.Request) (*models.BookId, error) {
+	bookIdAsString := request.URL.Query().Get("bookId")
+	if len(bookIdAsString) == 0 {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseInt(bookIdAsString, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("query parameter bookId must be a book id: %s", err)
+	}
+
+	bookId := models.BookId(id)
+	return &bookId, nil
+}
+
+func parseClubIdFromQuery(request *http.Request, parameterName string) (models.ClubId, error) {
+	id, err := strconv.ParseInt(request.URL.Query().Get(parameterName), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("query parameter %s must be a club id: %s", parameterName, err)
+	}
+
+	return models.ClubId(id), nil
+}
+
+func parseClubInviteIdFromQuery(request *http.Request) (models.ClubInviteId, error) {
+	id, err := strconv.ParseInt(request.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("query parameter id must be an invite id: %s", err)
+	}
+
+	return models.ClubInviteId(id), nil
+}
+
+// createInviteLink returns the path, relative to the site, that an invite link leads to.
+// CreateDigestUnsubscribeLink returns the path, with its query, of the page that stops sending the user digests.
+func CreateDigestUnsubscribeLink(userId models.UserId) (string, error) {
+	token, err := createDigestUnsubscribeTokenAsString(userId)
+	if err != nil {
+		return "", err
+	}
+
+	return paths.UnsubscribePage + "?token=" + url.QueryEscape(token), nil
+}
+
+func createInviteLink(inviteId models.ClubInviteId, expirationTime time.Time) (string, error) {
+	token, err := createInviteTokenAsString(inviteId, expirationTime)
+	if err != nil {
+		return "", err
+	}
+
+	return paths.JoinClubPage + "?invite=" + url.QueryEscape(token), nil
+}
+
+func parseMilestoneIdFromQuery(request *http.Request) (models.MilestoneId, error) {
+	id, err := strconv.ParseInt(request.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("query parameter id must be a milestone id: %s", err)
+	}
+
+	return models.MilestoneId(id), nil
+}
+
+// parseOptionalMilestoneIdFromQuery returns nil when the milestoneId query parameter is absent.
+func parseOptionalMilestoneIdFromQuery(request *http.Request) (*models.MilestoneId, error) {
+	milestoneIdAsString := request.URL.Query().Get("milestoneId")
+	if len(milestoneIdAsString) == 0 {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseInt(milestoneIdAsString, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("query parameter milestoneId must be a milestone id: %s", err)
+	}
+
+	milestoneId := models.MilestoneId(id)
+	return &milestoneId, nil
+}
+
+// parseOptionalClubIdFromQuery returns nil when the clubId query parameter is absent.
+func parseOptionalClubIdFromQuery(request *http.Request) (*models.ClubId, error) {
+	if len(request.URL.Query().Get("clubId")) == 0 {
+		return nil, nil
+	}
+
+	clubId, err := parseClubIdFromQuery(request, "clubId")
+	if err != nil {
+		return nil, err
+	}
+
+	return &clubId, nil
+}
+
+// parseRevealFromQuery reads the optional reveal query parameter, which asks for notes beyond
+// the user's reading progress to be shown in full.
+func parseRevealFromQuery(request *http.Request) (bool, error) {
+	revealAsString := request.URL.Query().Get("reveal")
+	if len(revealAsString) == 0 {
+		return false, nil
+	}
+
+	reveal, err := strconv.ParseBool(revealAsString)
+	if err != nil {
+		return false, fmt.Errorf("query parameter reveal must be true or false: %s", err)
+	}
+
+	return reveal, nil
+}
+
+// parseNoteFilterFromQuery reads the optional authorId, bookId, categoryId or category, createdAfter,
+// createdBefore, tag, published and answered query parameters, the location ranges minChapter, maxChapter,
+// minPage, maxPage, minPercent and maxPercent, order, which is either newest or reading, and reveal.
+// A category name is looked up among those the user may see. Times are expected in RFC 3339 format.
+func parseNoteFilterFromQuery(request *http.Request, userId models.UserId) (*noteservice.NoteFilter, error) {
+	query := request.URL.Query()
+	filter := new(noteservice.NoteFilter)
+
+	if authorIdAsString := query.Get("authorId"); len(authorIdAsString) > 0 {
+		id, err := strconv.ParseInt(authorIdAsString, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("query parameter authorId must be a user id: %s", err)
+		}
+
+		authorId := models.UserId(id)
+		filter.AuthorId = &authorId
+	}
+
+	bookId, err := parseOptionalBookIdFromQuery(request)
+	if err != nil {
+		return nil, err
+	}
+	filter.BookId = bookId
+
+	if categoryIdAsString := query.Get("categoryId"); len(categoryIdAsString) > 0 {
+		id, err := strconv.ParseInt(categoryIdAsString, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("query parameter categoryId must be a category id: %s", err)
+		}
+
+		category := models.Category(id)
+		filter.Category = &category
+	} else if categoryAsString := query.Get("category"); len(categoryAsString) > 0 {
+		category, err := models.DeserializeCategory(userId, 0, categoryAsString)
+		if err != nil {
+			return nil, err
+		}
+
+		filter.Category = &category
+	}
+
+	for parameterName, destination := range map[string]**time.Time{
+		"createdAfter":  &filter.CreatedAfter,
+		"createdBefore": &filter.CreatedBefore,
+	} {
+		if timeAsString := query.Get(parameterName); len(timeAsString) > 0 {
+			parsedTime, err := time.Parse(time.RFC3339, timeAsString)
+			if err != nil {
+				return nil, fmt.Errorf("query parameter %s must be an RFC 3339 time: %s", parameterName, err)
+			}
+
+			parsedTime = parsedTime.UTC()
+			*destination = &parsedTime
+		}
+	}
+
+	if tag := query.Get("tag"); len(tag) > 0 {
+		filter.Tag = &tag
+	}
+
+	if isPublishedAsString := query.Get("published"); len(isPublishedAsString) > 0 {
+		isPublished, err := strconv.ParseBool(isPublishedAsString)
+		if err != nil {
+			return nil, fmt.Errorf("query parameter published must be true or false: %s", err)
+		}
+
+		filter.IsPublished = &isPublished
+	}
+
+	if isAnsweredAsString := query.Get("answered"); len(isAnsweredAsString) > 0 {
+		isAnswered, err := strconv.ParseBool(isAnsweredAsString)
+		if err != nil {
+			return nil, fmt.Errorf("query parameter answered must be true or false: %s", err)
+		}
+
+		filter.IsAnswered = &isAnswered
+	}
+
+	for parameterName, destination := range map[string]**int{
+		"minChapter": &filter.MinChapter,
+		"maxChapter": &filter.MaxChapter,
+		"minPage":    &filter.MinPage,
+		"maxPage":    &filter.MaxPage,
+	} {
+		if valueAsString := query.Get(parameterName); len(valueAsString) > 0 {
+			value, err := strconv.Atoi(valueAsString)
+			if err != nil {
+				return nil, fmt.Errorf("query parameter %s must be an integer: %s", parameterName, err)
+			}
+
+			*destination = &value
+		}
+	}
+
+	for parameterName, destination := range map[string]**float64{
+		"minPercent": &filter.MinPercent,
+		"maxPercent": &filter.MaxPercent,
+	} {
+		if valueAsString := query.Get(parameterName); len(valueAsString) > 0 {
+			value, err := strconv.ParseFloat(valueAsString, 64)
+			if err != nil {
+				return nil, fmt.Errorf("query parameter %s must be a number: %s", parameterName, err)
+			}
+
+			*destination = &value
+		}
+	}
+
+	revealSpoilers, err := parseRevealFromQuery(request)
+	if err != nil {
+		return nil, err
+	}
+	filter.RevealSpoilers = revealSpoilers
+
+	switch query.Get("order") {
+	case "", "newest":
+	case "reading":
+		filter.InReadingOrder = true
+	default:
+		return nil, errors.New("query parameter order must be newest or reading")
+	}
+
+	return filter, nil
+}
+
+// respondWithNoteServiceError maps the errors returned by noteservice onto status codes.
+func respondWithNoteServiceError(responseWriter http.ResponseWriter, err error) {
+	statusCode := http.StatusInternalServerError
+
+	switch err {
+	case noteservice.NoteNotFoundError, noteservice.CommentNotFoundError, bookservice.BookNotFoundError:
+		statusCode = http.StatusNotFound
+	case noteservice.NoteNotAuthoredByUserError,
+		noteservice.CommentNotAuthoredByUserError,
+		noteservice.NoteWithheldAsSpoilerError,
+		noteservice.NotPredictionResolverError:
+		statusCode = http.StatusForbidden
+	case noteservice.NoteAlreadyPublishedError,
+		noteservice.NoteNotPublishedError,
+		noteservice.NoteCommentingLockedError:
+		statusCode = http.StatusConflict
+	case noteservice.NoteIsNotAPredictionError,
+		noteservice.NoteIsNotAQuestionError,
+		noteservice.NoteHasNoBookError:
+		statusCode = http.StatusConflict
+	case noteservice.NoteDoesNotAnswerQuestionError, noteservice.InvalidNoteLocationError:
+		statusCode = http.StatusBadRequest
+	case noteservice.InvalidTagError,
+		noteservice.InvalidPredictionConfidenceError,
+		noteservice.CategoryNotAvailableError:
+		statusCode = http.StatusBadRequest
+	}
+
+	http.Error(responseWriter, err.Error(), statusCode)
+}
+
+// respondWithBookServiceError maps the errors returned by bookservice onto status codes.
+func respondWithBookServiceError(responseWriter http.ResponseWriter, err error) {
+	statusCode := http.StatusInternalServerError
+
+	switch err {
+	case bookservice.BookNotFoundError:
+		statusCode = http.StatusNotFound
+	case bookservice.BookNotCreatedByUserError:
+		statusCode = http.StatusForbidden
+	case bookservice.BookStillInUseError:
+		statusCode = http.StatusConflict
+	case bookservice.InvalidBookTitleError, bookservice.InvalidIsbnError:
+		statusCode = http.StatusBadRequest
+	}
+
+	http.Error(responseWriter, err.Error(), statusCode)
+}
+
+func respondWithClubServiceError(responseWriter http.ResponseWriter, err error) {
+	statusCode := http.StatusInternalServerError
+
+	switch err {
+	case clubservice.ClubNotFoundError, clubservice.ClubMemberNotFoundError, clubservice.ClubInviteNotFoundError:
+		statusCode = http.StatusNotFound
+	case clubservice.NotClubOrganizerError:
+		statusCode = http.StatusForbidden
+	case clubservice.ClubNeedsAnOrganizerError:
+		statusCode = http.StatusConflict
+	case clubservice.ClubInviteNotUsableError:
+		statusCode = http.StatusGone
+	case clubservice.InvalidClubNameError,
+		clubservice.InvalidInviteLifetimeError,
+		clubservice.InvalidInviteMaxUsesError:
+		statusCode = http.StatusBadRequest
+	}
+
+	http.Error(responseWriter, err.Error(), statusCode)
+}
+
+func respondWithScheduleServiceError(responseWriter http.ResponseWriter, err error) {
+	switch err {
+	case scheduleservice.MilestoneNotFoundError:
+		http.Error(responseWriter, err.Error(), http.StatusNotFound)
+	case scheduleservice.MilestoneStillInUseError:
+		http.Error(responseWriter, err.Error(), http.StatusConflict)
+	case scheduleservice.InvalidChapterRangeError:
+		http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+	case bookservice.BookNotFoundError:
+		respondWithBookServiceError(responseWriter, err)
+	default:
+		respondWithClubServiceError(responseWriter, err)
+	}
+}
 
 func respondWithMethodNotAllowed(
 	responseWriter http.ResponseWriter,
@@ -14,6 +14,24 @@ import (
 
 var InvalidJWTokenError = errors.New("Token was invalid or unreadable")
 
+// clubInviteTokenSubject keeps invite tokens from being mistaken for other tokens signed with the same key.
+const clubInviteTokenSubject = "club-invite"
+
+// digestUnsubscribeTokenSubject keeps unsubscribe tokens from being mistaken for session tokens.
+const digestUnsubscribeTokenSubject = "digest-unsubscribe"
+
+// DigestUnsubscribeTokenClaim names the user whom an unsubscribe link stops sending digests to.
+type DigestUnsubscribeTokenClaim struct {
+	SubscriberId models.UserId `json:"subscriberId"`
+	jwt.StandardClaims
+}
+
+// ClubInviteTokenClaim names the invite that an invite link stands for.
+type ClubInviteTokenClaim struct {
+	models.ClubInviteId `json:"clubInviteId"`
+	jwt.StandardClaims
+}
+
 func parseTokenFromString(tokenAsString string) (*jwt.Token, error) {
 	return jwt.ParseWithClaims(
 		strings.TrimSpace(tokenAsString),
@@ -39,6 +57,77 @@ func createTokenAsString(
 	return token.SignedString(tokenSigningKey)
 }
 
+// createInviteTokenAsString signs a token that expires along with the invite.
+func createInviteTokenAsString(
+	inviteId models.ClubInviteId,
+	expirationTime time.Time,
+) (string, error) {
+	claims := ClubInviteTokenClaim{
+		inviteId,
+		jwt.StandardClaims{
+			ExpiresAt: expirationTime.Unix(),
+			Issuer:    "CerealNotes",
+			Subject:   clubInviteTokenSubject,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(tokenSigningKey)
+}
+
+func getInviteIdFromToken(tokenAsString string) (models.ClubInviteId, error) {
+	token, err := jwt.ParseWithClaims(
+		strings.TrimSpace(tokenAsString),
+		&ClubInviteTokenClaim{},
+		func(*jwt.Token) (interface{}, error) {
+			return tokenSigningKey, nil
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	if claims, ok := token.Claims.(*ClubInviteTokenClaim); ok && token.Valid &&
+		claims.Subject == clubInviteTokenSubject {
+		return claims.ClubInviteId, nil
+	}
+
+	return 0, InvalidJWTokenError
+}
+
+// createDigestUnsubscribeTokenAsString signs a token that never expires, so that the link
+// in an old digest still works.
+func createDigestUnsubscribeTokenAsString(userId models.UserId) (string, error) {
+	claims := DigestUnsubscribeTokenClaim{
+		userId,
+		jwt.StandardClaims{
+			Issuer:  "CerealNotes",
+			Subject: digestUnsubscribeTokenSubject,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(tokenSigningKey)
+}
+
+func getSubscriberIdFromToken(tokenAsString string) (models.UserId, error) {
+	token, err := jwt.ParseWithClaims(
+		strings.TrimSpace(tokenAsString),
+		&DigestUnsubscribeTokenClaim{},
+		func(*jwt.Token) (interface{}, error) {
+			return tokenSigningKey, nil
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	if claims, ok := token.Claims.(*DigestUnsubscribeTokenClaim); ok && token.Valid &&
+		claims.Subject == digestUnsubscribeTokenSubject && claims.SubscriberId != 0 {
+		return claims.SubscriberId, nil
+	}
+
+	return 0, InvalidJWTokenError
+}
+
 func getUserIdFromJwtToken(request *http.Request) (models.UserId, error) {
 	cookie, err := request.Cookie(cerealNotesCookieName)
 	if err != nil {
@@ -50,7 +139,8 @@ func getUserIdFromJwtToken(request *http.Request) (models.UserId, error) {
 		return 0, err
 	}
 
-	if claims, ok := token.Claims.(*JwtTokenClaim); ok && token.Valid {
+	// only session tokens lack a subject; other tokens signed with the same key must not log anyone in
+	if claims, ok := token.Claims.(*JwtTokenClaim); ok && token.Valid && len(claims.Subject) == 0 {
 		return claims.UserId, nil
 	}
 
@@ -3,14 +3,28 @@ package main
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/atmiguel/cerealnotes/databaseutil"
 	"github.com/atmiguel/cerealnotes/handlers"
+	"github.com/atmiguel/cerealnotes/models"
 	"github.com/atmiguel/cerealnotes/routers"
+	"github.com/atmiguel/cerealnotes/services/categoryservice"
+	"github.com/atmiguel/cerealnotes/services/digestservice"
+	"github.com/atmiguel/cerealnotes/services/noteservice"
+	"github.com/atmiguel/cerealnotes/services/publicationservice"
 )
 
+const defaultDeletedNoteRetentionPeriod = time.Hour * 24 * 30
+const defaultPublicationRetractionWindow = time.Hour
+const deletedNotePurgeInterval = time.Hour
+const scheduledPublicationCheckInterval = time.Minute
+const digestCheckInterval = time.Minute * 15
+
 // Get the current listening address
 func determineListenPort() (string, error) {
 	portEnvironmentVariableName := "PORT"
@@ -51,6 +65,108 @@ func determineTokenSigningKey() ([]byte, error) {
 	return []byte(tokenSigningKey), nil
 }
 
+// Deleted notes are purged once they have been in the trash for this long.
+// Falls back to a default when the environment variable is not set.
+func determineDeletedNoteRetentionPeriod() (time.Duration, error) {
+	environmentVariableName := "DELETED_NOTE_RETENTION_PERIOD"
+	retentionPeriodAsString := os.Getenv(environmentVariableName)
+
+	if len(retentionPeriodAsString) == 0 {
+		return defaultDeletedNoteRetentionPeriod, nil
+	}
+
+	retentionPeriod, err := time.ParseDuration(retentionPeriodAsString)
+	if err != nil {
+		return 0, fmt.Errorf(
+			"environment variable %s is not a valid duration: %s",
+			environmentVariableName,
+			err)
+	}
+
+	return retentionPeriod, nil
+}
+
+// Authors may retract a publication for this long after it goes live.
+// Falls back to a default when the environment variable is not set.
+func determinePublicationRetractionWindow() (time.Duration, error) {
+	environmentVariableName := "PUBLICATION_RETRACTION_WINDOW"
+	retractionWindowAsString := os.Getenv(environmentVariableName)
+
+	if len(retractionWindowAsString) == 0 {
+		return defaultPublicationRetractionWindow, nil
+	}
+
+	retractionWindow, err := time.ParseDuration(retractionWindowAsString)
+	if err != nil {
+		return 0, fmt.Errorf(
+			"environment variable %s is not a valid duration: %s",
+			environmentVariableName,
+			err)
+	}
+
+	return retractionWindow, nil
+}
+
+// Digests are sent through the SMTP server at SMTP_ADDRESS, given as host:port, which may be a local
+// stand-in for testing. Digests are not sent when it is not set.
+// SMTP_USERNAME and SMTP_PASSWORD are only needed by servers that require authentication.
+func determineDigestMailer() (*digestservice.Mailer, error) {
+	serverAddressVariableName := "SMTP_ADDRESS"
+	serverAddress := os.Getenv(serverAddressVariableName)
+
+	if len(serverAddress) == 0 {
+		return nil, nil
+	}
+
+	if _, _, err := net.SplitHostPort(serverAddress); err != nil {
+		return nil, fmt.Errorf(
+			"environment variable %s is not a valid host:port: %s",
+			serverAddressVariableName,
+			err)
+	}
+
+	senderAddressVariableName := "DIGEST_SENDER_ADDRESS"
+	senderAddress := os.Getenv(senderAddressVariableName)
+
+	if len(senderAddress) == 0 {
+		return nil, fmt.Errorf(
+			"environment variable %s not set, though %s is",
+			senderAddressVariableName,
+			serverAddressVariableName)
+	}
+
+	// links in a digest must be absolute
+	siteUrlVariableName := "SITE_URL"
+	siteUrl := os.Getenv(siteUrlVariableName)
+
+	if len(siteUrl) == 0 {
+		return nil, fmt.Errorf(
+			"environment variable %s not set, though %s is",
+			siteUrlVariableName,
+			serverAddressVariableName)
+	}
+
+	return &digestservice.Mailer{
+		ServerAddress:         serverAddress,
+		Username:              os.Getenv("SMTP_USERNAME"),
+		Password:              os.Getenv("SMTP_PASSWORD"),
+		SenderAddress:         senderAddress,
+		SiteUrl:               strings.TrimSuffix(siteUrl, "/"),
+		CreateUnsubscribeLink: handlers.CreateDigestUnsubscribeLink,
+	}, nil
+}
+
+// runPeriodically runs the task now and then once per interval, logging any errors.
+func runPeriodically(taskName string, interval time.Duration, task func() error) {
+	for {
+		if err := task(); err != nil {
+			log.Printf("%s failed: %s\n", taskName, err)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
 func main() {
 	// Set up db
 	{
@@ -62,6 +178,8 @@ func main() {
 		if err := databaseutil.ConnectToDatabase(databaseUrl); err != nil {
 			log.Fatal(err)
 		}
+
+		models.SetCategoryStore(categoryservice.NewDatabaseCategoryStore())
 	}
 
 	// Set up token signing key
@@ -74,6 +192,75 @@ func main() {
 		handlers.SetTokenSigningKey(tokenSigningKey)
 	}
 
+	// Set up publication retraction window
+	{
+		retractionWindow, err := determinePublicationRetractionWindow()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		publicationservice.SetRetractionWindow(retractionWindow)
+	}
+
+	// Set up digest mailer
+	var digestMailer *digestservice.Mailer
+	{
+		var err error
+		digestMailer, err = determineDigestMailer()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if digestMailer != nil {
+			digestservice.SetMailer(digestMailer)
+		} else {
+			log.Println("SMTP_ADDRESS not set, so no digests will be sent")
+		}
+	}
+
+	// Start background tasks
+	{
+		retentionPeriod, err := determineDeletedNoteRetentionPeriod()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go runPeriodically("purging deleted notes", deletedNotePurgeInterval, func() error {
+			purgedNoteCount, err := noteservice.PurgeNotesDeletedBefore(time.Now().UTC().Add(-retentionPeriod))
+			if err != nil {
+				return err
+			}
+
+			if purgedNoteCount > 0 {
+				log.Printf("Purged %d deleted notes\n", purgedNoteCount)
+			}
+
+			return nil
+		})
+
+		go runPeriodically("publishing scheduled publications", scheduledPublicationCheckInterval, func() error {
+			publicationIds, err := publicationservice.PublishDuePublications()
+
+			if len(publicationIds) > 0 {
+				log.Printf("Published %d scheduled publications\n", len(publicationIds))
+			}
+
+			return err
+		})
+
+		if digestMailer != nil {
+			go runPeriodically("sending digests", digestCheckInterval, func() error {
+				sentCount, err := digestservice.SendDueDigests()
+
+				if sentCount > 0 {
+					log.Printf("Sent %d digests\n", sentCount)
+				}
+
+				return err
+			})
+		}
+	}
+
 	// Start server
 	{
 		port, err := determineListenPort()
@@ -0,0 +1,11 @@
+-- Tables
+CREATE TABLE IF NOT EXISTS note_revision (
+	id bigserial PRIMARY KEY,
+	note_id bigint references note(id) NOT NULL,
+	content text NOT NULL,
+	creation_time timestamp NOT NULL
+);
+
+-- Every existing note starts its history with its current content
+INSERT INTO note_revision (note_id, content, creation_time)
+SELECT id, content, creation_time FROM note;
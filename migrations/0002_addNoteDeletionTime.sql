@@ -0,0 +1,2 @@
+-- A note with a deletion time is in its author's trash until it gets purged
+ALTER TABLE note ADD COLUMN IF NOT EXISTS deletion_time timestamp;
@@ -0,0 +1,3 @@
+-- Indexes
+-- Supports paging through notes newest first with a (creation_time, id) cursor
+CREATE INDEX IF NOT EXISTS note_creation_time_id_index ON note (creation_time DESC, id DESC);
@@ -0,0 +1,35 @@
+-- Tables
+CREATE TABLE IF NOT EXISTS category (
+	id bigserial PRIMARY KEY,
+	name text UNIQUE NOT NULL,
+	description text NOT NULL,
+	color text NOT NULL,
+	sort_order integer NOT NULL,
+	-- NULL for the default categories
+	creator_id bigint references app_user(id),
+	creation_time timestamp NOT NULL
+);
+
+-- The default categories keep the ids that models.Category declares for them
+INSERT INTO category (id, name, description, color, sort_order, creation_time) VALUES
+	(1, 'marginalia', 'Thoughts about a specific passage of the book', '#4caf50', 0, now() at time zone 'utc'),
+	(2, 'meta', 'Thoughts about the book as a whole or about the reading itself', '#9e9e9e', 1, now() at time zone 'utc'),
+	(3, 'questions', 'Questions to bring up with the club', '#2196f3', 2, now() at time zone 'utc'),
+	(4, 'predictions', 'Guesses about what will happen next', '#ff9800', 3, now() at time zone 'utc')
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval('category_id_seq', (SELECT MAX(id) FROM category));
+
+-- Notes now refer to a category row instead of the category_type enum
+ALTER TABLE note_to_category_relationship ADD COLUMN category_id bigint references category(id);
+
+UPDATE note_to_category_relationship
+SET category_id = category.id
+FROM category
+WHERE category.name = note_to_category_relationship.category::text;
+
+ALTER TABLE note_to_category_relationship ALTER COLUMN category_id SET NOT NULL;
+
+ALTER TABLE note_to_category_relationship DROP COLUMN category;
+
+DROP TYPE category_type;
@@ -0,0 +1,14 @@
+-- Tables
+CREATE TABLE IF NOT EXISTS tag (
+	id bigserial PRIMARY KEY,
+	name text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS note_to_tag_relationship (
+	note_id bigint references note(id) NOT NULL,
+	tag_id bigint references tag(id) NOT NULL,
+	PRIMARY KEY (note_id, tag_id)
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS note_to_tag_relationship_tag_id_index ON note_to_tag_relationship (tag_id);
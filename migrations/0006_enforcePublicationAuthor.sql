@@ -0,0 +1,25 @@
+-- Optional text shown above the notes of a publication
+ALTER TABLE publication ADD COLUMN IF NOT EXISTS title text NOT NULL DEFAULT '';
+ALTER TABLE publication ADD COLUMN IF NOT EXISTS intro_message text NOT NULL DEFAULT '';
+
+-- Every note in a publication must belong to the publication's author.
+-- Carrying the author on the relationship lets two foreign keys enforce this.
+ALTER TABLE note ADD CONSTRAINT note_id_author_id_unique UNIQUE (id, author_id);
+ALTER TABLE publication ADD CONSTRAINT publication_id_author_id_unique UNIQUE (id, author_id);
+
+ALTER TABLE note_to_publication_relationship ADD COLUMN author_id bigint;
+
+UPDATE note_to_publication_relationship
+SET author_id = note.author_id
+FROM note
+WHERE note.id = note_to_publication_relationship.note_id;
+
+ALTER TABLE note_to_publication_relationship ALTER COLUMN author_id SET NOT NULL;
+
+ALTER TABLE note_to_publication_relationship
+	ADD CONSTRAINT note_to_publication_relationship_note_author_fkey
+	FOREIGN KEY (note_id, author_id) REFERENCES note(id, author_id);
+
+ALTER TABLE note_to_publication_relationship
+	ADD CONSTRAINT note_to_publication_relationship_publication_author_fkey
+	FOREIGN KEY (publication_id, author_id) REFERENCES publication(id, author_id);
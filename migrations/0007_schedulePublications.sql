@@ -0,0 +1,16 @@
+-- creation_time is when the author created the publication, publish_at is when it is meant to go live,
+-- and publication_time is when it actually went live. publication_time is NULL while scheduled.
+ALTER TABLE publication ADD COLUMN IF NOT EXISTS publish_at timestamp;
+ALTER TABLE publication ADD COLUMN IF NOT EXISTS publication_time timestamp;
+
+-- Every existing publication went live as soon as it was created
+UPDATE publication
+SET publish_at = creation_time, publication_time = creation_time
+WHERE publish_at IS NULL;
+
+ALTER TABLE publication ALTER COLUMN publish_at SET NOT NULL;
+
+-- Indexes
+-- Lets the background publisher find scheduled publications that are due
+CREATE INDEX IF NOT EXISTS publication_publish_at_scheduled_index ON publication (publish_at)
+	WHERE publication_time IS NULL;
@@ -0,0 +1,10 @@
+-- Tables
+-- Audit trail of retracted publications. The publication row itself is kept so that readers
+-- can see that it was retracted, while its notes go back to being unpublished.
+CREATE TABLE IF NOT EXISTS publication_retraction (
+	publication_id bigint PRIMARY KEY references publication(id),
+	retractor_id bigint references app_user(id) NOT NULL,
+	retraction_time timestamp NOT NULL,
+	-- the notes the publication held when it was retracted
+	note_ids bigint[] NOT NULL
+);
@@ -0,0 +1,13 @@
+-- Types
+CREATE TYPE prediction_outcome_type AS ENUM ('correct', 'incorrect', 'void');
+
+-- Tables
+-- Extra details of notes in the predictions category
+CREATE TABLE IF NOT EXISTS prediction (
+	note_id bigint PRIMARY KEY references note(id),
+	-- percentage chance the author gives the prediction of coming true
+	confidence integer CHECK (confidence BETWEEN 0 AND 100),
+	outcome prediction_outcome_type,
+	resolver_id bigint references app_user(id),
+	resolution_time timestamp
+);
@@ -0,0 +1,18 @@
+-- Tables
+-- Links an answer note to the note in the questions category it answers
+CREATE TABLE IF NOT EXISTS question_answer (
+	answer_note_id bigint PRIMARY KEY references note(id),
+	question_note_id bigint references note(id) NOT NULL,
+	UNIQUE (answer_note_id, question_note_id)
+);
+
+-- The answer the asker accepted. The composite foreign key ensures it answers this very question.
+CREATE TABLE IF NOT EXISTS question_accepted_answer (
+	question_note_id bigint PRIMARY KEY references note(id),
+	answer_note_id bigint NOT NULL,
+	FOREIGN KEY (answer_note_id, question_note_id)
+		REFERENCES question_answer(answer_note_id, question_note_id)
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS question_answer_question_note_id_index ON question_answer (question_note_id);
@@ -0,0 +1,37 @@
+-- Tables
+CREATE TABLE IF NOT EXISTS book (
+	id bigserial PRIMARY KEY,
+	title text NOT NULL,
+	authors text[] NOT NULL DEFAULT '{}',
+	-- digits only, either 10 or 13 of them, or empty when unknown
+	isbn text NOT NULL DEFAULT '',
+	edition text NOT NULL DEFAULT '',
+	-- chapter titles in reading order
+	chapters text[] NOT NULL DEFAULT '{}',
+	creator_id bigint references app_user(id) NOT NULL,
+	creation_time timestamp NOT NULL
+);
+
+-- Notes written before books existed are not about any book
+ALTER TABLE note ADD COLUMN IF NOT EXISTS book_id bigint references book(id);
+
+-- Publications created before books existed are not scoped to any book
+ALTER TABLE publication ADD COLUMN IF NOT EXISTS book_id bigint references book(id);
+
+-- Every note in a publication must be about the publication's book.
+-- As with the author, carrying the book on the relationship lets two foreign keys enforce this.
+ALTER TABLE note ADD CONSTRAINT note_id_book_id_unique UNIQUE (id, book_id);
+ALTER TABLE publication ADD CONSTRAINT publication_id_book_id_unique UNIQUE (id, book_id);
+
+ALTER TABLE note_to_publication_relationship ADD COLUMN book_id bigint;
+
+ALTER TABLE note_to_publication_relationship
+	ADD CONSTRAINT note_to_publication_relationship_note_book_fkey
+	FOREIGN KEY (note_id, book_id) REFERENCES note(id, book_id);
+
+ALTER TABLE note_to_publication_relationship
+	ADD CONSTRAINT note_to_publication_relationship_publication_book_fkey
+	FOREIGN KEY (publication_id, book_id) REFERENCES publication(id, book_id);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS note_book_id_index ON note (book_id);
@@ -0,0 +1,14 @@
+-- Tables
+-- Where in its book a note is anchored. Any of the three may be unknown, but not all of them.
+CREATE TABLE IF NOT EXISTS note_location (
+	note_id bigint PRIMARY KEY references note(id),
+	-- 1-based index into the chapters of the note's book
+	chapter integer CHECK (chapter >= 1),
+	page integer CHECK (page >= 1),
+	percent double precision CHECK (percent BETWEEN 0 AND 100),
+	CHECK (chapter IS NOT NULL OR page IS NOT NULL OR percent IS NOT NULL)
+);
+
+-- Indexes
+-- Lets a chapter's notes be read in order
+CREATE INDEX IF NOT EXISTS note_location_reading_order_index ON note_location (chapter, page, percent);
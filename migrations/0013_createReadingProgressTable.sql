@@ -0,0 +1,17 @@
+-- Tables
+-- Every update of a member's progress through a book is kept; the latest one is their current progress.
+CREATE TABLE IF NOT EXISTS reading_progress (
+	id bigserial PRIMARY KEY,
+	user_id bigint references app_user(id) NOT NULL,
+	book_id bigint references book(id) NOT NULL,
+	-- 1-based index into the chapters of the book
+	chapter integer CHECK (chapter >= 1),
+	page integer CHECK (page >= 1),
+	percent double precision CHECK (percent BETWEEN 0 AND 100),
+	record_time timestamp NOT NULL,
+	CHECK (chapter IS NOT NULL OR page IS NOT NULL OR percent IS NOT NULL)
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS reading_progress_user_id_book_id_record_time_index
+	ON reading_progress (user_id, book_id, record_time DESC);
@@ -0,0 +1,33 @@
+-- Types
+CREATE TYPE club_role_type AS ENUM ('organizer', 'member');
+
+-- Tables
+CREATE TABLE IF NOT EXISTS club (
+	id bigserial PRIMARY KEY,
+	name text NOT NULL,
+	creator_id bigint references app_user(id) NOT NULL,
+	creation_time timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS club_membership (
+	club_id bigint references club(id) NOT NULL,
+	user_id bigint references app_user(id) NOT NULL,
+	role club_role_type NOT NULL,
+	join_time timestamp NOT NULL,
+	PRIMARY KEY (club_id, user_id)
+);
+
+-- Custom categories belong to the club whose organizer defined them; the defaults belong to no club
+ALTER TABLE category ADD COLUMN IF NOT EXISTS club_id bigint references club(id);
+
+-- Category names only need to be unique within a club, so that every club may define its own
+ALTER TABLE category DROP CONSTRAINT IF EXISTS category_name_key;
+
+ALTER TABLE category ADD CONSTRAINT category_club_id_name_key UNIQUE (club_id, name);
+
+-- Indexes
+-- Lets the clubs of a user, and so their fellow members, be found quickly
+CREATE INDEX IF NOT EXISTS club_membership_user_id_index ON club_membership (user_id);
+
+-- UNIQUE (club_id, name) does not apply to the default categories, whose club_id is NULL
+CREATE UNIQUE INDEX IF NOT EXISTS category_default_name_index ON category (name) WHERE club_id IS NULL;
@@ -0,0 +1,16 @@
+-- Tables
+-- The signed token in an invite link only names its invite; whether it can still be used is decided here.
+CREATE TABLE IF NOT EXISTS club_invite (
+	id bigserial PRIMARY KEY,
+	club_id bigint references club(id) NOT NULL,
+	creator_id bigint references app_user(id) NOT NULL,
+	-- NULL lets the invite be used any number of times until it expires
+	max_uses integer CHECK (max_uses >= 1),
+	use_count integer NOT NULL DEFAULT 0 CHECK (use_count >= 0),
+	expiration_time timestamp NOT NULL,
+	revocation_time timestamp,
+	creation_time timestamp NOT NULL
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS club_invite_club_id_index ON club_invite (club_id);
@@ -0,0 +1,30 @@
+-- Tables
+-- A club's reading schedule for a book is the list of its milestones ordered by due time.
+CREATE TABLE IF NOT EXISTS reading_milestone (
+	id bigserial PRIMARY KEY,
+	club_id bigint references club(id) NOT NULL,
+	book_id bigint references book(id) NOT NULL,
+	title text NOT NULL DEFAULT '',
+	-- 1-based indexes into the chapters of the book, both included
+	first_chapter integer NOT NULL CHECK (first_chapter >= 1),
+	last_chapter integer NOT NULL,
+	due_time timestamp NOT NULL,
+	creator_id bigint references app_user(id) NOT NULL,
+	creation_time timestamp NOT NULL,
+	CHECK (last_chapter >= first_chapter)
+);
+
+-- A publication attached to a milestone must be about the milestone's book.
+ALTER TABLE reading_milestone ADD CONSTRAINT reading_milestone_id_book_id_unique UNIQUE (id, book_id);
+
+ALTER TABLE publication ADD COLUMN IF NOT EXISTS milestone_id bigint;
+
+ALTER TABLE publication
+	ADD CONSTRAINT publication_milestone_book_fkey
+	FOREIGN KEY (milestone_id, book_id) REFERENCES reading_milestone(id, book_id);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS reading_milestone_club_id_book_id_due_time_index
+	ON reading_milestone (club_id, book_id, due_time);
+
+CREATE INDEX IF NOT EXISTS publication_milestone_id_index ON publication (milestone_id);
@@ -0,0 +1,12 @@
+-- Types
+CREATE TYPE reaction_type AS ENUM ('thumbs_up', 'heart', 'laughing', 'surprised', 'thinking', 'sad');
+
+-- Tables
+-- Each user may react to a note once with each reaction.
+CREATE TABLE IF NOT EXISTS note_reaction (
+	note_id bigint references note(id) NOT NULL,
+	user_id bigint references app_user(id) NOT NULL,
+	reaction reaction_type NOT NULL,
+	creation_time timestamp NOT NULL,
+	PRIMARY KEY (note_id, user_id, reaction)
+);
@@ -0,0 +1,24 @@
+-- Tables
+-- Comments on published notes. A reply names the comment it answers, which must be on the same note.
+CREATE TABLE IF NOT EXISTS note_comment (
+	id bigserial PRIMARY KEY,
+	note_id bigint references note(id) NOT NULL,
+	parent_comment_id bigint,
+	author_id bigint references app_user(id) NOT NULL,
+	content text NOT NULL,
+	creation_time timestamp NOT NULL,
+	edit_time timestamp,
+	deletion_time timestamp,
+	UNIQUE (id, note_id),
+	FOREIGN KEY (parent_comment_id, note_id) REFERENCES note_comment(id, note_id)
+);
+
+-- Notes whose author stopped further comments
+CREATE TABLE IF NOT EXISTS note_comment_lock (
+	note_id bigint PRIMARY KEY references note(id),
+	lock_time timestamp NOT NULL
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS note_comment_note_id_creation_time_index
+	ON note_comment (note_id, creation_time);
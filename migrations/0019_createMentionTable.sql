@@ -0,0 +1,18 @@
+-- Tables
+-- Users named with an @ in the content of a note, or of a comment on it
+CREATE TABLE IF NOT EXISTS mention (
+	note_id bigint references note(id) NOT NULL,
+	-- null for mentions in the content of the note itself
+	comment_id bigint references note_comment(id),
+	mentioned_user_id bigint references app_user(id) NOT NULL,
+	creation_time timestamp NOT NULL
+);
+
+-- Indexes
+CREATE UNIQUE INDEX IF NOT EXISTS mention_note_id_mentioned_user_id_unique
+	ON mention (note_id, mentioned_user_id) WHERE comment_id IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS mention_comment_id_mentioned_user_id_unique
+	ON mention (comment_id, mentioned_user_id) WHERE comment_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS mention_mentioned_user_id_index ON mention (mentioned_user_id);
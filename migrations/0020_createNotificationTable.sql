@@ -0,0 +1,26 @@
+-- Types
+CREATE TYPE notification_type AS ENUM (
+	'new_publication',
+	'publication_live',
+	'note_comment',
+	'comment_reply',
+	'question_answer',
+	'mention'
+);
+
+-- Tables
+CREATE TABLE IF NOT EXISTS notification (
+	id bigserial PRIMARY KEY,
+	recipient_id bigint references app_user(id) NOT NULL,
+	type notification_type NOT NULL,
+	-- the fields of the payload that goes with the type
+	payload jsonb NOT NULL,
+	creation_time timestamp NOT NULL,
+	read_time timestamp
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS notification_recipient_id_id_index ON notification (recipient_id, id);
+
+CREATE INDEX IF NOT EXISTS notification_unread_recipient_id_index
+	ON notification (recipient_id) WHERE read_time IS NULL;
@@ -0,0 +1,18 @@
+-- Types
+CREATE TYPE digest_frequency_type AS ENUM (
+	'daily',
+	'weekly'
+);
+
+-- Tables
+-- Users without a row here receive no digest.
+CREATE TABLE IF NOT EXISTS digest_subscription (
+	user_id bigint PRIMARY KEY references app_user(id),
+	frequency digest_frequency_type NOT NULL,
+	-- the next digest covers what was published since this time
+	last_sent_time timestamp NOT NULL
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS digest_subscription_frequency_last_sent_time_index
+	ON digest_subscription (frequency, last_sent_time);
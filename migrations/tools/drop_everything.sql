@@ -1,5 +1,3 @@
-DROP TYPE category_type CASCADE;
-
 DROP TABLE app_user CASCADE;
 
 DROP TABLE publication CASCADE;
@@ -8,4 +6,56 @@ DROP TABLE note CASCADE;
 
 DROP TABLE note_to_type_relationship CASCADE;
 
-DROP TABLE note_to_publication_relationship CASCADE;
\ No newline at end of file
+DROP TABLE note_to_publication_relationship CASCADE;
+
+DROP TABLE note_revision CASCADE;
+
+DROP TABLE category CASCADE;
+
+DROP TABLE tag CASCADE;
+
+DROP TABLE note_to_tag_relationship CASCADE;
+
+DROP TABLE publication_retraction CASCADE;
+
+DROP TYPE prediction_outcome_type CASCADE;
+
+DROP TABLE prediction CASCADE;
+
+DROP TABLE question_answer CASCADE;
+
+DROP TABLE question_accepted_answer CASCADE;
+
+DROP TABLE book CASCADE;
+
+DROP TABLE note_location CASCADE;
+
+DROP TABLE reading_progress CASCADE;
+
+DROP TYPE club_role_type CASCADE;
+
+DROP TABLE club CASCADE;
+
+DROP TABLE club_membership CASCADE;
+
+DROP TABLE club_invite CASCADE;
+
+DROP TABLE reading_milestone CASCADE;
+
+DROP TYPE reaction_type CASCADE;
+
+DROP TABLE note_reaction CASCADE;
+
+DROP TABLE note_comment CASCADE;
+
+DROP TABLE note_comment_lock CASCADE;
+
+DROP TABLE mention CASCADE;
+
+DROP TYPE notification_type CASCADE;
+
+DROP TABLE notification CASCADE;
+
+DROP TYPE digest_frequency_type CASCADE;
+
+DROP TABLE digest_subscription CASCADE;
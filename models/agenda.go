@@ -0,0 +1,50 @@
+package models
+
+import "errors"
+
+// AgendaGrouping is how the items of a meeting agenda are gathered under headings.
+type AgendaGrouping int
+
+const (
+	BY_AUTHOR AgendaGrouping = iota
+	BY_CHAPTER
+)
+
+var agendaGroupingStrings = [...]string{
+	"author",
+	"chapter",
+}
+
+var CannotDeserializeAgendaGroupingStringError = errors.New("String does not correspond to an Agenda Grouping")
+
+func DeserializeAgendaGrouping(input string) (AgendaGrouping, error) {
+	for i := 0; i < len(agendaGroupingStrings); i++ {
+		if input == agendaGroupingStrings[i] {
+			return AgendaGrouping(i), nil
+		}
+	}
+	return 0, CannotDeserializeAgendaGroupingStringError
+}
+
+func (grouping AgendaGrouping) String() string {
+
+	if grouping < BY_AUTHOR || grouping > BY_CHAPTER {
+		return "Unknown"
+	}
+
+	return agendaGroupingStrings[grouping]
+}
+
+func (grouping AgendaGrouping) MarshalText() ([]byte, error) {
+	return []byte(grouping.String()), nil
+}
+
+func (grouping *AgendaGrouping) UnmarshalText(text []byte) error {
+	deserializedGrouping, err := DeserializeAgendaGrouping(string(text))
+	if err != nil {
+		return err
+	}
+
+	*grouping = deserializedGrouping
+	return nil
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type BookId int64
+
+// Book is a title the club reads. Chapters holds the chapter titles in reading order.
+// Isbn holds digits only, or is empty when unknown.
+type Book struct {
+	Title        string    `json:"title"`
+	Authors      []string  `json:"authors"`
+	Isbn         string    `json:"isbn,omitempty"`
+	Edition      string    `json:"edition,omitempty"`
+	Chapters     []string  `json:"chapters"`
+	CreatorId    UserId    `json:"creatorId"`
+	CreationTime time.Time `json:"creationTime"`
+}
+
+// BookWithId is used wherever books are listed in order rather than keyed by id.
+type BookWithId struct {
+	Id BookId `json:"id"`
+	*Book
+}
@@ -0,0 +1,69 @@
+package models
+
+import "errors"
+
+// Category is the id of a category definition in the store.
+type Category int64
+
+// The default categories are seeded with these ids and are available to every club.
+const (
+	MARGINALIA Category = iota + 1
+	META
+	QUESTIONS
+	PREDICTIONS
+)
+
+// ClubId is 0 for the default categories.
+type CategoryDefinition struct {
+	Id          Category `json:"id"`
+	ClubId      ClubId   `json:"clubId,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Color       string   `json:"color"`
+	SortOrder   int      `json:"sortOrder"`
+}
+
+// NoteCategory is the category of a note as loaded along with the note. It is serialized by its name.
+type NoteCategory struct {
+	Id        Category
+	Name      string
+	SortOrder int
+}
+
+func (category NoteCategory) String() string {
+	return category.Name
+}
+
+// MarshalText lets categories appear in json by name rather than by number.
+func (category NoteCategory) MarshalText() ([]byte, error) {
+	return []byte(category.Name), nil
+}
+
+// CategoryStore looks up category definitions in persistent storage.
+// GetCategoryByName only looks among the default categories and those of the viewer's clubs,
+// or of the given club when clubId is not 0.
+// It returns CannotDeserializeCategoryStringError when none of them has the name,
+// and AmbiguousCategoryNameError when several of the viewer's clubs do.
+type CategoryStore interface {
+	GetCategoryByName(viewerId UserId, clubId ClubId, name string) (Category, error)
+}
+
+var categoryStore CategoryStore
+
+// SetCategoryStore must be called before any category is deserialized.
+func SetCategoryStore(store CategoryStore) {
+	categoryStore = store
+}
+
+var CannotDeserializeCategoryStringError = errors.New("String does not correspond to a Note Category")
+
+var AmbiguousCategoryNameError = errors.New("Several of the user's clubs define a category with this name")
+
+// DeserializeCategory resolves a category name as the viewer knows it, within the club when clubId is not 0.
+func DeserializeCategory(viewerId UserId, clubId ClubId, input string) (Category, error) {
+	if categoryStore == nil {
+		return 0, CannotDeserializeCategoryStringError
+	}
+
+	return categoryStore.GetCategoryByName(viewerId, clubId, input)
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type ClubId int64
+
+type Club struct {
+	Name         string    `json:"name"`
+	CreatorId    UserId    `json:"creatorId"`
+	CreationTime time.Time `json:"creationTime"`
+}
+
+// ClubRole is what a member may do within a club. Organizers manage the club and its members.
+type ClubRole int
+
+const (
+	ORGANIZER ClubRole = iota
+	MEMBER
+)
+
+var clubRoleStrings = [...]string{
+	"organizer",
+	"member",
+}
+
+var CannotDeserializeClubRoleStringError = errors.New("String does not correspond to a Club Role")
+
+func DeserializeClubRole(input string) (ClubRole, error) {
+	for i := 0; i < len(clubRoleStrings); i++ {
+		if input == clubRoleStrings[i] {
+			return ClubRole(i), nil
+		}
+	}
+	return 0, CannotDeserializeClubRoleStringError
+}
+
+func (role ClubRole) String() string {
+
+	if role < ORGANIZER || role > MEMBER {
+		return "Unknown"
+	}
+
+	return clubRoleStrings[role]
+}
+
+func (role ClubRole) MarshalText() ([]byte, error) {
+	return []byte(role.String()), nil
+}
+
+func (role *ClubRole) UnmarshalText(text []byte) error {
+	deserializedRole, err := DeserializeClubRole(string(text))
+	if err != nil {
+		return err
+	}
+
+	*role = deserializedRole
+	return nil
+}
+
+// ClubMembership is a club as one of its members sees it, along with that member's role.
+type ClubMembership struct {
+	Id ClubId `json:"id"`
+	Club
+	Role ClubRole `json:"role"`
+}
+
+// ClubMember is one member of a club as the other members see them.
+type ClubMember struct {
+	UserId   UserId    `json:"userId"`
+	User     *User     `json:"user"`
+	Role     ClubRole  `json:"role"`
+	JoinTime time.Time `json:"joinTime"`
+}
+
+type ClubInviteId int64
+
+// ClubInvite lets whoever holds its link join a club until it expires, is revoked or runs out of uses.
+// A nil MaxUses allows any number of uses.
+type ClubInvite struct {
+	ClubId         ClubId    `json:"clubId"`
+	CreatorId      UserId    `json:"creatorId"`
+	MaxUses        *int      `json:"maxUses"`
+	UseCount       int       `json:"useCount"`
+	ExpirationTime time.Time `json:"expirationTime"`
+	CreationTime   time.Time `json:"creationTime"`
+}
+
+type ClubInviteWithId struct {
+	Id ClubInviteId `json:"id"`
+	*ClubInvite
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type CommentId int64
+
+// Comment is part of the discussion of a published note. ParentId is the comment it replies to, or 0.
+// A removed comment was deleted, or written by someone who shares no club with the reader;
+// it keeps its place in the thread so that its replies still make sense, but loses its author and content.
+type Comment struct {
+	NoteId       NoteId           `json:"noteId"`
+	ParentId     CommentId        `json:"parentId,omitempty"`
+	AuthorId     UserId           `json:"authorId,omitempty"`
+	Content      string           `json:"content"`
+	CreationTime time.Time        `json:"creationTime"`
+	EditTime     *time.Time       `json:"editTime,omitempty"`
+	IsRemoved    bool             `json:"isRemoved,omitempty"`
+	Replies      []*CommentWithId `json:"replies"`
+}
+
+type CommentWithId struct {
+	Id CommentId `json:"id"`
+	*Comment
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// DigestFrequency is how often a user receives the email digest of what their clubs published.
+type DigestFrequency int
+
+const (
+	DAILY DigestFrequency = iota
+	WEEKLY
+)
+
+var digestFrequencyStrings = [...]string{
+	"daily",
+	"weekly",
+}
+
+var digestFrequencyPeriods = [...]time.Duration{
+	time.Hour * 24,
+	time.Hour * 24 * 7,
+}
+
+var CannotDeserializeDigestFrequencyStringError = errors.New("String does not correspond to a Digest Frequency")
+
+func DeserializeDigestFrequency(input string) (DigestFrequency, error) {
+	for i := 0; i < len(digestFrequencyStrings); i++ {
+		if input == digestFrequencyStrings[i] {
+			return DigestFrequency(i), nil
+		}
+	}
+	return 0, CannotDeserializeDigestFrequencyStringError
+}
+
+func (frequency DigestFrequency) String() string {
+
+	if frequency < DAILY || frequency > WEEKLY {
+		return "Unknown"
+	}
+
+	return digestFrequencyStrings[frequency]
+}
+
+// Period returns how long a user waits between two digests.
+func (frequency DigestFrequency) Period() time.Duration {
+	if frequency < DAILY || frequency > WEEKLY {
+		return 0
+	}
+
+	return digestFrequencyPeriods[frequency]
+}
+
+func (frequency DigestFrequency) MarshalText() ([]byte, error) {
+	return []byte(frequency.String()), nil
+}
+
+func (frequency *DigestFrequency) UnmarshalText(text []byte) error {
+	deserializedFrequency, err := DeserializeDigestFrequency(string(text))
+	if err != nil {
+		return err
+	}
+
+	*frequency = deserializedFrequency
+	return nil
+}
+
+// DigestSubscription is a user's choice to receive the digest. The next digest covers
+// what was published since LastSentTime.
+type DigestSubscription struct {
+	Frequency    DigestFrequency `json:"frequency"`
+	LastSentTime time.Time       `json:"lastSentTime"`
+}
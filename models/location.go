@@ -0,0 +1,46 @@
+package models
+
+// Location anchors a note to a place in its book. Chapter is a 1-based index into the book's chapters.
+// Any of the fields may be unknown, but not all of them.
+type Location struct {
+	Chapter *int     `json:"chapter,omitempty"`
+	Page    *int     `json:"page,omitempty"`
+	Percent *float64 `json:"percent,omitempty"`
+}
+
+// IsBeyond tells whether a reader who has reached progress may come across this location later.
+// Chapters are compared first, then pages, then percentages, skipping any that either side lacks.
+// When nothing can be compared, or there is no progress at all, the location counts as beyond it.
+func (location *Location) IsBeyond(progress *Location) bool {
+	if progress == nil {
+		return true
+	}
+
+	isCompared := false
+
+	if location.Chapter != nil && progress.Chapter != nil {
+		if *location.Chapter != *progress.Chapter {
+			return *location.Chapter > *progress.Chapter
+		}
+
+		isCompared = true
+	}
+
+	if location.Page != nil && progress.Page != nil {
+		if *location.Page != *progress.Page {
+			return *location.Page > *progress.Page
+		}
+
+		isCompared = true
+	}
+
+	if location.Percent != nil && progress.Percent != nil {
+		if *location.Percent != *progress.Percent {
+			return *location.Percent > *progress.Percent
+		}
+
+		isCompared = true
+	}
+
+	return !isCompared
+}
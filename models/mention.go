@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Mention tells that a user was named with an @ in a note, or in a comment on it when CommentId is not 0.
+// MentionTime is when the mention could first be read, which for a note is no earlier than its publication.
+type Mention struct {
+	NoteId      NoteId    `json:"noteId"`
+	CommentId   CommentId `json:"commentId,omitempty"`
+	MentionerId UserId    `json:"mentionerId"`
+	MentionTime time.Time `json:"mentionTime"`
+}
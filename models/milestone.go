@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type MilestoneId int64
+
+// Milestone is one step of a club's reading schedule for a book: the chapters to have read by DueTime.
+// Chapters are 1-based indexes into the chapters of the book, both included.
+type Milestone struct {
+	ClubId       ClubId    `json:"clubId"`
+	BookId       BookId    `json:"bookId"`
+	Title        string    `json:"title,omitempty"`
+	FirstChapter int       `json:"firstChapter"`
+	LastChapter  int       `json:"lastChapter"`
+	DueTime      time.Time `json:"dueTime"`
+}
+
+type MilestoneWithId struct {
+	Id MilestoneId `json:"id"`
+	*Milestone
+}
@@ -1,50 +1,41 @@
 package models
 
-import (
-	"errors"
-	"time"
-)
+import "time"
 
 type NoteId int64
 
-type Category int
-
-const (
-	MARGINALIA Category = iota
-	META
-	QUESTIONS
-	PREDICTIONS
-)
-
-var categoryStrings = [...]string{
-	"marginalia",
-	"meta",
-	"questions",
-	"predictions",
-}
-
-var CannotDeserializeCategoryStringError = errors.New("String does not correspond to a Note Category")
-
-func DeserializeCategory(input string) (Category, error) {
-	for i := 0; i < len(categoryStrings); i++ {
-		if input == categoryStrings[i] {
-			return Category(i), nil
-		}
-	}
-	return 0, CannotDeserializeCategoryStringError
+type Note struct {
+	AuthorId        UserId        `json:"authorId"`
+	Content         string        `json:"content"`
+	CreationTime    time.Time     `json:"creationTime"`
+	BookId          BookId        `json:"bookId,omitempty"`
+	Location        *Location     `json:"location,omitempty"`
+	Category        *NoteCategory `json:"category,omitempty"`
+	PublicationId   PublicationId `json:"publicationId,omitempty"`
+	PublicationTime *time.Time    `json:"publicationTime,omitempty"`
+	DeletionTime    *time.Time    `json:"deletionTime,omitempty"`
+	Tags            []string      `json:"tags,omitempty"`
+	Prediction      *Prediction   `json:"prediction,omitempty"`
+	QuestionId      NoteId        `json:"questionId,omitempty"`
+	Question        *Question     `json:"question,omitempty"`
+	// Reactions lists only the reactions the note received, in the order of the fixed reaction set.
+	Reactions []*ReactionCount `json:"reactions,omitempty"`
+	// CommentCount leaves out deleted comments.
+	CommentCount       int  `json:"commentCount"`
+	IsCommentingLocked bool `json:"isCommentingLocked,omitempty"`
+	// IsWithheld marks a note whose content was redacted because it is beyond the reader's progress.
+	IsWithheld bool `json:"isWithheld,omitempty"`
 }
 
-func (category Category) String() string {
-
-	if category < MARGINALIA || category > PREDICTIONS {
-		return "Unknown"
-	}
-
-	return categoryStrings[category]
+// Question holds the details of a note in the questions category.
+// AcceptedAnswerId is 0 until the asker accepts an answer.
+type Question struct {
+	AnswerCount      int    `json:"answerCount"`
+	AcceptedAnswerId NoteId `json:"acceptedAnswerId,omitempty"`
 }
 
-type Note struct {
-	AuthorId     UserId    `json:"authorId"`
-	Content      string    `json:"content"`
-	CreationTime time.Time `json:"creationTime"`
+// NoteWithId is used wherever notes are listed in order rather than keyed by id.
+type NoteWithId struct {
+	Id NoteId `json:"id"`
+	*Note
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type DiffOperation string
+
+const (
+	DIFF_EQUAL  DiffOperation = "equal"
+	DIFF_INSERT DiffOperation = "insert"
+	DIFF_DELETE DiffOperation = "delete"
+)
+
+// DiffLine is a single line of a line-by-line diff between two revisions.
+type DiffLine struct {
+	Operation DiffOperation `json:"operation"`
+	Text      string        `json:"text"`
+}
+
+// NoteRevision is one version of a note's content.
+// Diff compares it to the previous revision and is empty for the first one.
+type NoteRevision struct {
+	Content      string     `json:"content"`
+	CreationTime time.Time  `json:"creationTime"`
+	Diff         []DiffLine `json:"diff,omitempty"`
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type NotificationId int64
+
+// NotificationType tells what happened, and so which payload a notification carries.
+type NotificationType int
+
+const (
+	NEW_PUBLICATION NotificationType = iota
+	PUBLICATION_LIVE
+	NOTE_COMMENT
+	COMMENT_REPLY
+	QUESTION_ANSWER
+	MENTION
+)
+
+var notificationTypeStrings = [...]string{
+	"new_publication",
+	"publication_live",
+	"note_comment",
+	"comment_reply",
+	"question_answer",
+	"mention",
+}
+
+var CannotDeserializeNotificationTypeStringError = errors.New("String does not correspond to a Notification Type")
+
+func DeserializeNotificationType(input string) (NotificationType, error) {
+	for i := 0; i < len(notificationTypeStrings); i++ {
+		if input == notificationTypeStrings[i] {
+			return NotificationType(i), nil
+		}
+	}
+	return 0, CannotDeserializeNotificationTypeStringError
+}
+
+func (notificationType NotificationType) String() string {
+
+	if notificationType < NEW_PUBLICATION || notificationType > MENTION {
+		return "Unknown"
+	}
+
+	return notificationTypeStrings[notificationType]
+}
+
+func (notificationType NotificationType) MarshalText() ([]byte, error) {
+	return []byte(notificationType.String()), nil
+}
+
+func (notificationType *NotificationType) UnmarshalText(text []byte) error {
+	deserializedNotificationType, err := DeserializeNotificationType(string(text))
+	if err != nil {
+		return err
+	}
+
+	*notificationType = deserializedNotificationType
+	return nil
+}
+
+// NotificationPayload holds the details of a notification. Each type of notification has its own payload.
+type NotificationPayload interface {
+	NotificationType() NotificationType
+}
+
+// PublicationNotification tells members that a fellow member's publication went live,
+// or, as a PUBLICATION_LIVE notification, tells an author that their scheduled publication did.
+type PublicationNotification struct {
+	Type          NotificationType `json:"-"`
+	PublicationId PublicationId    `json:"publicationId"`
+	AuthorId      UserId           `json:"authorId"`
+	BookId        BookId           `json:"bookId"`
+	Title         string           `json:"title,omitempty"`
+}
+
+func (notification *PublicationNotification) NotificationType() NotificationType {
+	return notification.Type
+}
+
+// CommentNotification tells the author of a note about a comment on it, or, as a COMMENT_REPLY
+// notification, tells the author of a comment about a reply to it.
+type CommentNotification struct {
+	Type      NotificationType `json:"-"`
+	NoteId    NoteId           `json:"noteId"`
+	CommentId CommentId        `json:"commentId"`
+	AuthorId  UserId           `json:"authorId"`
+}
+
+func (notification *CommentNotification) NotificationType() NotificationType {
+	return notification.Type
+}
+
+// AnswerNotification tells the asker of a question about a new answer to it.
+type AnswerNotification struct {
+	QuestionId NoteId `json:"questionId"`
+	AnswerId   NoteId `json:"answerId"`
+	AuthorId   UserId `json:"authorId"`
+}
+
+func (notification *AnswerNotification) NotificationType() NotificationType {
+	return QUESTION_ANSWER
+}
+
+// MentionNotification tells a user they were mentioned, once they can read the mention.
+type MentionNotification struct {
+	Mention
+}
+
+func (notification *MentionNotification) NotificationType() NotificationType {
+	return MENTION
+}
+
+// Notification is one entry of a user's inbox. ReadTime stays nil until the user marks it read.
+type Notification struct {
+	Type         NotificationType    `json:"type"`
+	Payload      NotificationPayload `json:"payload"`
+	CreationTime time.Time           `json:"creationTime"`
+	ReadTime     *time.Time          `json:"readTime,omitempty"`
+}
+
+type NotificationWithId struct {
+	Id NotificationId `json:"id"`
+	*Notification
+}
@@ -0,0 +1,58 @@
+package models
+
+import "errors"
+
+type PredictionOutcome int
+
+const (
+	CORRECT PredictionOutcome = iota
+	INCORRECT
+	VOID
+)
+
+var predictionOutcomeStrings = [...]string{
+	"correct",
+	"incorrect",
+	"void",
+}
+
+var CannotDeserializePredictionOutcomeStringError = errors.New("String does not correspond to a Prediction Outcome")
+
+func DeserializePredictionOutcome(input string) (PredictionOutcome, error) {
+	for i := 0; i < len(predictionOutcomeStrings); i++ {
+		if input == predictionOutcomeStrings[i] {
+			return PredictionOutcome(i), nil
+		}
+	}
+	return 0, CannotDeserializePredictionOutcomeStringError
+}
+
+func (outcome PredictionOutcome) String() string {
+
+	if outcome < CORRECT || outcome > VOID {
+		return "Unknown"
+	}
+
+	return predictionOutcomeStrings[outcome]
+}
+
+func (outcome PredictionOutcome) MarshalText() ([]byte, error) {
+	return []byte(outcome.String()), nil
+}
+
+func (outcome *PredictionOutcome) UnmarshalText(text []byte) error {
+	deserializedOutcome, err := DeserializePredictionOutcome(string(text))
+	if err != nil {
+		return err
+	}
+
+	*outcome = deserializedOutcome
+	return nil
+}
+
+// Prediction holds the details of a note in the predictions category.
+// Confidence is the percentage chance the author gave it, and Outcome is nil until it is resolved.
+type Prediction struct {
+	Confidence *int               `json:"confidence,omitempty"`
+	Outcome    *PredictionOutcome `json:"outcome,omitempty"`
+}
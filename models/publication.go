@@ -4,7 +4,17 @@ import "time"
 
 type PublicationId int64
 
+// Publication goes live at PublishAt. PublicationTime is nil until it has gone live.
+// A retracted publication keeps its details but no longer holds any notes.
+// MilestoneId is 0 unless the publication belongs to a milestone of a club's reading schedule.
 type Publication struct {
-	AuthorId     UserId    `json:"authorId"`
-	CreationTime time.Time `json:"creationTime"`
+	AuthorId        UserId      `json:"authorId"`
+	BookId          BookId      `json:"bookId,omitempty"`
+	MilestoneId     MilestoneId `json:"milestoneId,omitempty"`
+	CreationTime    time.Time   `json:"creationTime"`
+	PublishAt       time.Time   `json:"publishAt"`
+	PublicationTime *time.Time  `json:"publicationTime,omitempty"`
+	RetractionTime  *time.Time  `json:"retractionTime,omitempty"`
+	Title           string      `json:"title,omitempty"`
+	IntroMessage    string      `json:"introMessage,omitempty"`
 }
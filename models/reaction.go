@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Reaction is one of the fixed set of emoji that users may react to a note with.
+type Reaction int
+
+const (
+	THUMBS_UP Reaction = iota
+	HEART
+	LAUGHING
+	SURPRISED
+	THINKING
+	SAD
+)
+
+var reactionStrings = [...]string{
+	"thumbs_up",
+	"heart",
+	"laughing",
+	"surprised",
+	"thinking",
+	"sad",
+}
+
+var reactionEmoji = [...]string{
+	"\U0001F44D",
+	"\u2764\uFE0F",
+	"\U0001F602",
+	"\U0001F62E",
+	"\U0001F914",
+	"\U0001F622",
+}
+
+var CannotDeserializeReactionStringError = errors.New("String does not correspond to a Reaction")
+
+func DeserializeReaction(input string) (Reaction, error) {
+	for i := 0; i < len(reactionStrings); i++ {
+		if input == reactionStrings[i] {
+			return Reaction(i), nil
+		}
+	}
+	return 0, CannotDeserializeReactionStringError
+}
+
+func (reaction Reaction) String() string {
+
+	if reaction < THUMBS_UP || reaction > SAD {
+		return "Unknown"
+	}
+
+	return reactionStrings[reaction]
+}
+
+// Emoji returns the character the reaction is displayed as.
+func (reaction Reaction) Emoji() string {
+	if reaction < THUMBS_UP || reaction > SAD {
+		return ""
+	}
+
+	return reactionEmoji[reaction]
+}
+
+func (reaction Reaction) MarshalText() ([]byte, error) {
+	return []byte(reaction.String()), nil
+}
+
+func (reaction *Reaction) UnmarshalText(text []byte) error {
+	deserializedReaction, err := DeserializeReaction(string(text))
+	if err != nil {
+		return err
+	}
+
+	*reaction = deserializedReaction
+	return nil
+}
+
+// ReactionCount tells how many users reacted to a note with a reaction, and whether the viewer is one of them.
+type ReactionCount struct {
+	Reaction   Reaction `json:"reaction"`
+	Count      int      `json:"count"`
+	HasReacted bool     `json:"hasReacted"`
+}
+
+// NoteReaction is one user's reaction to a note.
+type NoteReaction struct {
+	UserId       UserId    `json:"userId"`
+	Reaction     Reaction  `json:"reaction"`
+	CreationTime time.Time `json:"creationTime"`
+}
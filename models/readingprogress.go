@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// ReadingProgress records how far a member had read into a book at RecordTime.
+type ReadingProgress struct {
+	BookId     BookId    `json:"bookId"`
+	Location   *Location `json:"location"`
+	RecordTime time.Time `json:"recordTime"`
+}
@@ -7,9 +7,43 @@ const (
 	LoginOrSignupPage = "/login-or-signup"
 	HomePage          = "/home"
 	NotesPage         = "/notes"
+	PublicationsPage  = "/publications"
+	ChapterPage       = "/chapter"
+	JoinClubPage      = "/join-club"
+	AgendaPage        = "/agenda"
+	UnsubscribePage   = "/digest-unsubscribe"
 
-	UserApi     = "/api/user"
-	SessionApi  = "/api/session"
-	NoteApi     = "/api/note"
-	CategoryApi = "/api/note-category"
+	UserApi         = "/api/user"
+	SessionApi      = "/api/session"
+	NoteApi         = "/api/note"
+	CategoryApi     = "/api/note-category"
+	NoteRevisionApi = "/api/note-revision"
+	NoteTrashApi    = "/api/note-trash"
+	NoteRestoreApi  = "/api/note-restore"
+	NoteTagApi      = "/api/note-tag"
+	NoteBookApi     = "/api/note-book"
+	NoteLocationApi = "/api/note-location"
+	PredictionApi   = "/api/prediction"
+	ResolutionApi   = "/api/prediction-resolution"
+	AnswerApi       = "/api/question-answer"
+	AcceptanceApi   = "/api/accepted-answer"
+	ReactionApi     = "/api/note-reaction"
+	CommentApi      = "/api/note-comment"
+	CommentLockApi  = "/api/note-comment-lock"
+	MentionApi      = "/api/mention"
+
+	CategoryDefinitionApi = "/api/category"
+	TagApi                = "/api/tag"
+	BookApi               = "/api/book"
+	ReadingProgressApi    = "/api/reading-progress"
+	ClubApi               = "/api/club"
+	ClubMemberApi         = "/api/club-member"
+	ClubInviteApi         = "/api/club-invite"
+	ReadingScheduleApi    = "/api/reading-schedule"
+	MilestoneApi          = "/api/milestone"
+	PublicationApi        = "/api/publication"
+	RetractionApi         = "/api/publication-retraction"
+	LeaderboardApi        = "/api/prediction-leaderboard"
+	NotificationApi       = "/api/notification"
+	DigestApi             = "/api/digest-subscription"
 )
@@ -50,9 +50,14 @@ func DefineRoutes() http.Handler {
 
 	// pages
 	mux.HandleFunc(paths.LoginOrSignupPage, handlers.HandleLoginOrSignupPageRequest)
+	mux.HandleFunc(paths.JoinClubPage, handlers.HandleJoinClubPageRequest)
+	mux.HandleFunc(paths.UnsubscribePage, handlers.HandleDigestUnsubscribePageRequest)
 
 	mux.handleAuthenticatedPage(paths.HomePage, handlers.HandleHomePageRequest)
 	mux.handleAuthenticatedPage(paths.NotesPage, handlers.HandleNotesPageRequest)
+	mux.handleAuthenticatedPage(paths.PublicationsPage, handlers.HandlePublicationsPageRequest)
+	mux.handleAuthenticatedPage(paths.ChapterPage, handlers.HandleChapterPageRequest)
+	mux.handleAuthenticatedPage(paths.AgendaPage, handlers.HandleAgendaPageRequest)
 
 	// api
 
@@ -61,6 +66,34 @@ func DefineRoutes() http.Handler {
 
 	mux.handleAuthenticatedApi(paths.NoteApi, handlers.HandleNoteApiRequest)
 	mux.handleAuthenticatedApi(paths.CategoryApi, handlers.HandleNoteCateogryApiRequest)
+	mux.handleAuthenticatedApi(paths.NoteRevisionApi, handlers.HandleNoteRevisionApiRequest)
+	mux.handleAuthenticatedApi(paths.NoteTrashApi, handlers.HandleNoteTrashApiRequest)
+	mux.handleAuthenticatedApi(paths.NoteRestoreApi, handlers.HandleNoteRestoreApiRequest)
+	mux.handleAuthenticatedApi(paths.NoteTagApi, handlers.HandleNoteTagApiRequest)
+	mux.handleAuthenticatedApi(paths.NoteBookApi, handlers.HandleNoteBookApiRequest)
+	mux.handleAuthenticatedApi(paths.NoteLocationApi, handlers.HandleNoteLocationApiRequest)
+	mux.handleAuthenticatedApi(paths.PredictionApi, handlers.HandlePredictionApiRequest)
+	mux.handleAuthenticatedApi(paths.ResolutionApi, handlers.HandlePredictionResolutionApiRequest)
+	mux.handleAuthenticatedApi(paths.AnswerApi, handlers.HandleQuestionAnswerApiRequest)
+	mux.handleAuthenticatedApi(paths.AcceptanceApi, handlers.HandleAcceptedAnswerApiRequest)
+	mux.handleAuthenticatedApi(paths.ReactionApi, handlers.HandleNoteReactionApiRequest)
+	mux.handleAuthenticatedApi(paths.CommentApi, handlers.HandleNoteCommentApiRequest)
+	mux.handleAuthenticatedApi(paths.CommentLockApi, handlers.HandleNoteCommentLockApiRequest)
+	mux.handleAuthenticatedApi(paths.MentionApi, handlers.HandleMentionApiRequest)
+	mux.handleAuthenticatedApi(paths.CategoryDefinitionApi, handlers.HandleCategoryApiRequest)
+	mux.handleAuthenticatedApi(paths.TagApi, handlers.HandleTagApiRequest)
+	mux.handleAuthenticatedApi(paths.BookApi, handlers.HandleBookApiRequest)
+	mux.handleAuthenticatedApi(paths.ReadingProgressApi, handlers.HandleReadingProgressApiRequest)
+	mux.handleAuthenticatedApi(paths.ClubApi, handlers.HandleClubApiRequest)
+	mux.handleAuthenticatedApi(paths.ClubMemberApi, handlers.HandleClubMemberApiRequest)
+	mux.handleAuthenticatedApi(paths.ClubInviteApi, handlers.HandleClubInviteApiRequest)
+	mux.handleAuthenticatedApi(paths.ReadingScheduleApi, handlers.HandleReadingScheduleApiRequest)
+	mux.handleAuthenticatedApi(paths.MilestoneApi, handlers.HandleMilestoneApiRequest)
+	mux.handleAuthenticatedApi(paths.PublicationApi, handlers.HandlePublicationApiRequest)
+	mux.handleAuthenticatedApi(paths.RetractionApi, handlers.HandlePublicationRetractionApiRequest)
+	mux.handleAuthenticatedApi(paths.LeaderboardApi, handlers.HandlePredictionLeaderboardApiRequest)
+	mux.handleAuthenticatedApi(paths.NotificationApi, handlers.HandleNotificationApiRequest)
+	mux.handleAuthenticatedApi(paths.DigestApi, handlers.HandleDigestSubscriptionApiRequest)
 
 	return mux
 }
@@ -0,0 +1,311 @@
+/*
+Package agendaservice compiles the questions, and optionally the predictions, that members published
+into an agenda for a club meeting.
+*/
+package agendaservice
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/bookservice"
+	"github.com/atmiguel/cerealnotes/services/publicationservice"
+	"github.com/atmiguel/cerealnotes/services/scheduleservice"
+)
+
+const agendaDateFormat = "January 2, 2006"
+
+// AgendaFilter picks the publications an agenda is compiled from. Nil fields do not filter anything.
+// PublishedAfter is inclusive and PublishedBefore exclusive.
+type AgendaFilter struct {
+	BookId          *models.BookId
+	MilestoneId     *models.MilestoneId
+	PublishedAfter  *time.Time
+	PublishedBefore *time.Time
+
+	IncludePredictions bool
+	GroupBy            models.AgendaGrouping
+	RevealSpoilers     bool
+}
+
+// AgendaItem is one question or prediction on an agenda. Content is empty when IsWithheld is set.
+type AgendaItem struct {
+	NoteId      models.NoteId      `json:"noteId"`
+	Author      *models.User       `json:"author"`
+	BookTitle   string             `json:"bookTitle,omitempty"`
+	Location    *models.Location   `json:"location,omitempty"`
+	Content     string             `json:"content"`
+	AnswerCount int                `json:"answerCount"`
+	Prediction  *models.Prediction `json:"prediction,omitempty"`
+	IsWithheld  bool               `json:"isWithheld,omitempty"`
+
+	publicationTime time.Time
+	chapterTitle    string
+}
+
+// AgendaSection gathers the items of one author or one chapter.
+type AgendaSection struct {
+	Heading string        `json:"heading"`
+	Items   []*AgendaItem `json:"items"`
+}
+
+// Agenda lists the open questions, and optionally the predictions, to discuss at a meeting.
+// WithheldCount counts the items redacted because they are beyond the reader's progress.
+type Agenda struct {
+	Title         string           `json:"title"`
+	Questions     []*AgendaSection `json:"questions"`
+	Predictions   []*AgendaSection `json:"predictions,omitempty"`
+	WithheldCount int              `json:"withheldCount"`
+}
+
+// CompileAgenda gathers the open questions from the live publications the viewer can read,
+// leaving out questions whose asker already accepted an answer. Predictions are included when asked for.
+func CompileAgenda(viewerId models.UserId, filter *AgendaFilter) (*Agenda, error) {
+	agenda := &Agenda{Title: "Open questions"}
+
+	if filter.MilestoneId != nil {
+		milestone, err := scheduleservice.GetMilestoneVisibleToUser(viewerId, *filter.MilestoneId)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(milestone.Title) > 0 {
+			agenda.Title = milestone.Title
+		} else {
+			agenda.Title = fmt.Sprintf("Chapters %d to %d", milestone.FirstChapter, milestone.LastChapter)
+		}
+	} else if filter.PublishedAfter != nil || filter.PublishedBefore != nil {
+		agenda.Title = "Open questions published " + describeDateRange(filter.PublishedAfter, filter.PublishedBefore)
+	}
+
+	publications, err := publicationservice.GetLivePublications(viewerId, &publicationservice.PublicationFilter{
+		BookId:          filter.BookId,
+		MilestoneId:     filter.MilestoneId,
+		PublishedAfter:  filter.PublishedAfter,
+		PublishedBefore: filter.PublishedBefore,
+		RevealSpoilers:  filter.RevealSpoilers,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	chapterTitles := newChapterTitleCache()
+
+	questions := make([]*AgendaItem, 0)
+	predictions := make([]*AgendaItem, 0)
+
+	for _, publication := range publications {
+		for _, noteGroup := range publication.NoteGroups {
+			if noteGroup.Category == nil {
+				continue
+			}
+
+			category := noteGroup.Category.Id
+			if category != models.QUESTIONS && !(category == models.PREDICTIONS && filter.IncludePredictions) {
+				continue
+			}
+
+			for _, note := range noteGroup.Notes {
+				if note.Question != nil && note.Question.AcceptedAnswerId != 0 {
+					continue
+				}
+
+				item := &AgendaItem{
+					NoteId:          note.Id,
+					Author:          publication.Author,
+					BookTitle:       publication.BookTitle,
+					Location:        note.Location,
+					Content:         note.Content,
+					Prediction:      note.Prediction,
+					IsWithheld:      note.IsWithheld,
+					publicationTime: *publication.PublicationTime,
+				}
+
+				if note.Question != nil {
+					item.AnswerCount = note.Question.AnswerCount
+				}
+
+				if note.Location != nil && note.Location.Chapter != nil {
+					chapterTitle, err := chapterTitles.get(note.BookId, *note.Location.Chapter)
+					if err != nil {
+						return nil, err
+					}
+
+					item.chapterTitle = chapterTitle
+				}
+
+				if item.IsWithheld {
+					agenda.WithheldCount++
+				}
+
+				if category == models.QUESTIONS {
+					questions = append(questions, item)
+				} else {
+					predictions = append(predictions, item)
+				}
+			}
+		}
+	}
+
+	agenda.Questions = groupItems(questions, filter.GroupBy)
+
+	if filter.IncludePredictions {
+		agenda.Predictions = groupItems(predictions, filter.GroupBy)
+	}
+
+	return agenda, nil
+}
+
+// Details summarizes what is known about an item besides its content and author,
+// such as where it is in the book and how many answers it has.
+func (item *AgendaItem) Details() string {
+	details := make([]string, 0)
+
+	if item.Location != nil {
+		if item.Location.Chapter != nil {
+			details = append(details, fmt.Sprintf("chapter %d", *item.Location.Chapter))
+		}
+
+		if item.Location.Page != nil {
+			details = append(details, fmt.Sprintf("p. %d", *item.Location.Page))
+		}
+
+		if item.Location.Percent != nil {
+			details = append(details, fmt.Sprintf("%g%%", *item.Location.Percent))
+		}
+	}
+
+	if item.Prediction != nil {
+		if item.Prediction.Confidence != nil {
+			details = append(details, fmt.Sprintf("%d%% confident", *item.Prediction.Confidence))
+		}
+
+		if item.Prediction.Outcome != nil {
+			details = append(details, "resolved "+item.Prediction.Outcome.String())
+		}
+	} else if item.AnswerCount == 1 {
+		details = append(details, "1 answer")
+	} else {
+		details = append(details, fmt.Sprintf("%d answers", item.AnswerCount))
+	}
+
+	return strings.Join(details, ", ")
+}
+
+// PRIVATE
+
+// groupItems sorts sections by author name, or by book and then chapter with notes lacking a chapter last.
+// Within a section, items come in the order they appear in the book, oldest publication first.
+func groupItems(items []*AgendaItem, grouping models.AgendaGrouping) []*AgendaSection {
+	sort.SliceStable(items, func(i, j int) bool {
+		if grouping == models.BY_AUTHOR && items[i].Author.DisplayName != items[j].Author.DisplayName {
+			return items[i].Author.DisplayName < items[j].Author.DisplayName
+		}
+
+		if items[i].BookTitle != items[j].BookTitle {
+			return items[i].BookTitle < items[j].BookTitle
+		}
+
+		if chapterI, chapterJ := chapterOf(items[i]), chapterOf(items[j]); chapterI != chapterJ {
+			return chapterI < chapterJ
+		}
+
+		return items[i].publicationTime.Before(items[j].publicationTime)
+	})
+
+	sections := make([]*AgendaSection, 0)
+	for _, item := range items {
+		heading := headingOf(item, grouping)
+
+		if len(sections) == 0 || sections[len(sections)-1].Heading != heading {
+			sections = append(sections, &AgendaSection{Heading: heading, Items: make([]*AgendaItem, 0)})
+		}
+
+		section := sections[len(sections)-1]
+		section.Items = append(section.Items, item)
+	}
+
+	return sections
+}
+
+// chapterOf sorts items without a chapter after every chapter.
+func chapterOf(item *AgendaItem) int {
+	if item.Location == nil || item.Location.Chapter == nil {
+		return int(^uint(0) >> 1)
+	}
+
+	return *item.Location.Chapter
+}
+
+func headingOf(item *AgendaItem, grouping models.AgendaGrouping) string {
+	if grouping == models.BY_AUTHOR {
+		return item.Author.DisplayName
+	}
+
+	heading := "No chapter"
+	if item.Location != nil && item.Location.Chapter != nil {
+		heading = fmt.Sprintf("Chapter %d", *item.Location.Chapter)
+
+		if len(item.chapterTitle) > 0 {
+			heading += ": " + item.chapterTitle
+		}
+	}
+
+	if len(item.BookTitle) > 0 {
+		heading = item.BookTitle + " - " + heading
+	}
+
+	return heading
+}
+
+func describeDateRange(publishedAfter *time.Time, publishedBefore *time.Time) string {
+	switch {
+	case publishedAfter != nil && publishedBefore != nil:
+		return "from " + publishedAfter.Format(agendaDateFormat) +
+			" through " + lastDayBefore(*publishedBefore).Format(agendaDateFormat)
+	case publishedAfter != nil:
+		return "since " + publishedAfter.Format(agendaDateFormat)
+	default:
+		return "through " + lastDayBefore(*publishedBefore).Format(agendaDateFormat)
+	}
+}
+
+// lastDayBefore turns an exclusive end of a date range into the last day within it.
+func lastDayBefore(publishedBefore time.Time) time.Time {
+	return publishedBefore.Add(-time.Nanosecond)
+}
+
+// chapterTitleCache looks each book up once while an agenda is compiled.
+type chapterTitleCache struct {
+	chaptersByBookId map[models.BookId][]string
+}
+
+func newChapterTitleCache() *chapterTitleCache {
+	return &chapterTitleCache{chaptersByBookId: make(map[models.BookId][]string)}
+}
+
+// get returns an empty title for chapters the book does not list.
+func (cache *chapterTitleCache) get(bookId models.BookId, chapter int) (string, error) {
+	chapters, ok := cache.chaptersByBookId[bookId]
+	if !ok {
+		if bookId != 0 {
+			book, err := bookservice.GetBookById(bookId)
+			if err != nil {
+				return "", err
+			}
+
+			chapters = book.Chapters
+		}
+
+		cache.chaptersByBookId[bookId] = chapters
+	}
+
+	if chapter < 1 || chapter > len(chapters) {
+		return "", nil
+	}
+
+	return chapters[chapter-1], nil
+}
@@ -0,0 +1,61 @@
+package agendaservice
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenderMarkdown writes the agenda as a Markdown document to be downloaded and shared.
+func RenderMarkdown(agenda *Agenda) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "# %s\n", agenda.Title)
+
+	if agenda.WithheldCount > 0 {
+		fmt.Fprintf(
+			&builder,
+			"\n_%d item(s) about parts of the book you have not reached yet are hidden._\n",
+			agenda.WithheldCount)
+	}
+
+	builder.WriteString("\n## Questions\n")
+	writeMarkdownSections(&builder, agenda.Questions, "No open questions.")
+
+	if agenda.Predictions != nil {
+		builder.WriteString("\n## Predictions\n")
+		writeMarkdownSections(&builder, agenda.Predictions, "No predictions.")
+	}
+
+	return builder.String()
+}
+
+// PRIVATE
+
+func writeMarkdownSections(builder *strings.Builder, sections []*AgendaSection, emptyMessage string) {
+	if len(sections) == 0 {
+		fmt.Fprintf(builder, "\n%s\n", emptyMessage)
+		return
+	}
+
+	for _, section := range sections {
+		fmt.Fprintf(builder, "\n### %s\n\n", section.Heading)
+
+		for _, item := range section.Items {
+			content := item.Content
+			if item.IsWithheld {
+				content = "_Hidden to avoid spoilers_"
+			}
+
+			// indent continuation lines so that multi-line notes stay within their list item
+			content = strings.Replace(strings.TrimSpace(content), "\n", "\n  ", -1)
+
+			fmt.Fprintf(builder, "- %s", content)
+
+			if details := item.Details(); len(details) > 0 {
+				fmt.Fprintf(builder, " (*%s*, %s)\n", item.Author.DisplayName, details)
+			} else {
+				fmt.Fprintf(builder, " (*%s*)\n", item.Author.DisplayName)
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Package bookservice handles interactions with database layer.
+*/
+package bookservice
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+)
+
+var BookNotFoundError = errors.New("No book exists with the given id")
+
+var BookNotCreatedByUserError = errors.New("The book was not added by this user")
+
+var BookStillInUseError = errors.New("Notes or publications are still about this book")
+
+var InvalidBookTitleError = errors.New("Book title cannot be empty")
+
+var InvalidIsbnError = errors.New("ISBN must be a valid ISBN-10 or ISBN-13")
+
+// StoreNewBook adds a book to the catalog. The ISBN may be empty, and is stored without hyphens or spaces.
+func StoreNewBook(creatorId models.UserId, book *models.Book) (models.BookId, error) {
+	isbn, err := validateBook(book)
+	if err != nil {
+		return 0, err
+	}
+
+	bookId, err := databaseutil.InsertBook(
+		strings.TrimSpace(book.Title),
+		nonNilStrings(book.Authors),
+		isbn,
+		book.Edition,
+		nonNilStrings(book.Chapters),
+		int64(creatorId),
+		time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return models.BookId(bookId), nil
+}
+
+// GetBooks returns every book in the catalog, most recently added first.
+func GetBooks() ([]*models.BookWithId, error) {
+	bookRows, err := databaseutil.GetBooks()
+	if err != nil {
+		return nil, err
+	}
+
+	books := make([]*models.BookWithId, 0, len(bookRows))
+	for _, bookRow := range bookRows {
+		books = append(books, &models.BookWithId{
+			Id:   models.BookId(bookRow.Id),
+			Book: convertBookRowToBook(bookRow),
+		})
+	}
+
+	return books, nil
+}
+
+// GetBookById returns BookNotFoundError if no such book exists.
+func GetBookById(bookId models.BookId) (*models.Book, error) {
+	bookRow, err := databaseutil.GetBookById(int64(bookId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return nil, BookNotFoundError
+		}
+
+		return nil, err
+	}
+
+	return convertBookRowToBook(bookRow), nil
+}
+
+// UpdateBook replaces the details of a book. Only the member who added the book may change it.
+func UpdateBook(userId models.UserId, bookId models.BookId, book *models.Book) error {
+	if _, err := getBookCreatedByUser(userId, bookId); err != nil {
+		return err
+	}
+
+	isbn, err := validateBook(book)
+	if err != nil {
+		return err
+	}
+
+	if err := databaseutil.UpdateBook(
+		int64(bookId),
+		strings.TrimSpace(book.Title),
+		nonNilStrings(book.Authors),
+		isbn,
+		book.Edition,
+		nonNilStrings(book.Chapters),
+	); err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return BookNotFoundError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// DeleteBook removes a book from the catalog. Only the member who added the book may delete it,
+// and only once no note or publication is about it anymore.
+func DeleteBook(userId models.UserId, bookId models.BookId) error {
+	if _, err := getBookCreatedByUser(userId, bookId); err != nil {
+		return err
+	}
+
+	if err := databaseutil.DeleteBook(int64(bookId)); err != nil {
+		switch err {
+		case databaseutil.QueryResultContainedNoRowsError:
+			return BookNotFoundError
+		case databaseutil.ForeignKeyConstraintError:
+			return BookStillInUseError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// IsValidLocation tells whether the location points somewhere in the book. At least one of chapter,
+// page and percent must be set. Books without a chapter list accept any chapter.
+func IsValidLocation(book *models.Book, location *models.Location) bool {
+	if location.Chapter == nil && location.Page == nil && location.Percent == nil {
+		return false
+	}
+
+	if location.Chapter != nil &&
+		(*location.Chapter < 1 || (len(book.Chapters) > 0 && *location.Chapter > len(book.Chapters))) {
+		return false
+	}
+
+	if location.Page != nil && *location.Page < 1 {
+		return false
+	}
+
+	if location.Percent != nil && (*location.Percent < 0 || *location.Percent > 100) {
+		return false
+	}
+
+	return true
+}
+
+// PRIVATE
+
+func getBookCreatedByUser(userId models.UserId, bookId models.BookId) (*models.Book, error) {
+	book, err := GetBookById(bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	if book.CreatorId != userId {
+		return nil, BookNotCreatedByUserError
+	}
+
+	return book, nil
+}
+
+// validateBook returns the book's ISBN without hyphens or spaces.
+func validateBook(book *models.Book) (string, error) {
+	if len(strings.TrimSpace(book.Title)) == 0 {
+		return "", InvalidBookTitleError
+	}
+
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(book.Isbn))
+	if len(isbn) > 0 && !isValidIsbn(isbn) {
+		return "", InvalidIsbnError
+	}
+
+	return isbn, nil
+}
+
+// isValidIsbn checks the length and check digit of an ISBN-10 or ISBN-13.
+func isValidIsbn(isbn string) bool {
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, r := range isbn {
+			var digit int
+			switch {
+			case r >= '0' && r <= '9':
+				digit = int(r - '0')
+			case r == 'X' && i == 9:
+				digit = 10
+			default:
+				return false
+			}
+
+			sum += (10 - i) * digit
+		}
+
+		return sum%11 == 0
+
+	case 13:
+		sum := 0
+		for i, r := range isbn {
+			if r < '0' || r > '9' {
+				return false
+			}
+
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+
+			sum += weight * int(r-'0')
+		}
+
+		return sum%10 == 0
+	}
+
+	return false
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
+
+func convertBookRowToBook(bookRow *databaseutil.BookRow) *models.Book {
+	return &models.Book{
+		Title:        bookRow.Title,
+		Authors:      nonNilStrings(bookRow.Authors),
+		Isbn:         bookRow.Isbn,
+		Edition:      bookRow.Edition,
+		Chapters:     nonNilStrings(bookRow.Chapters),
+		CreatorId:    models.UserId(bookRow.CreatorId),
+		CreationTime: bookRow.CreationTime,
+	}
+}
@@ -0,0 +1,87 @@
+package bookservice
+
+import (
+	"testing"
+
+	"github.com/atmiguel/cerealnotes/models"
+)
+
+func TestValidateBookStripsHyphensAndSpacesFromTheIsbn(t *testing.T) {
+	isbn, err := validateBook(&models.Book{Title: "Dune", Isbn: " 978-0-306 40615-7 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isbn != "9780306406157" {
+		t.Errorf("stored the ISBN as %q, expected 9780306406157", isbn)
+	}
+}
+
+func TestValidateBookAcceptsALowercaseCheckDigitX(t *testing.T) {
+	isbn, err := validateBook(&models.Book{Title: "Dune", Isbn: "0-8044-2957-x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isbn != "080442957X" {
+		t.Errorf("stored the ISBN as %q, expected 080442957X", isbn)
+	}
+}
+
+func TestValidateBookLeavesTheIsbnOptional(t *testing.T) {
+	if isbn, err := validateBook(&models.Book{Title: "Dune"}); err != nil || isbn != "" {
+		t.Errorf("validateBook without an ISBN returned (%q, %v), expected no ISBN and no error", isbn, err)
+	}
+
+	// only separators is no ISBN at all
+	if isbn, err := validateBook(&models.Book{Title: "Dune", Isbn: " - "}); err != nil || isbn != "" {
+		t.Errorf("validateBook with a blank ISBN returned (%q, %v), expected no ISBN and no error", isbn, err)
+	}
+}
+
+func TestValidateBookChecksTheTitleBeforeTheIsbn(t *testing.T) {
+	if _, err := validateBook(&models.Book{Title: " \t", Isbn: "not an isbn"}); err != InvalidBookTitleError {
+		t.Errorf("validateBook returned %v, expected InvalidBookTitleError", err)
+	}
+}
+
+func TestIsValidIsbnAcceptsBothFormats(t *testing.T) {
+	for _, isbn := range []string{"0306406152", "080442957X", "9780306406157", "9783161484100"} {
+		if !isValidIsbn(isbn) {
+			t.Errorf("rejected %s", isbn)
+		}
+	}
+}
+
+func TestIsValidIsbnRejectsWrongCheckDigits(t *testing.T) {
+	// each differs from a valid ISBN in its last digit only
+	for _, isbn := range []string{"0306406151", "0804429570", "9780306406158", "9783161484109"} {
+		if isValidIsbn(isbn) {
+			t.Errorf("accepted %s", isbn)
+		}
+	}
+}
+
+func TestIsValidIsbnOnlyAllowsXAsTheLastDigitOfAnIsbn10(t *testing.T) {
+	if isValidIsbn("03064X6152") {
+		t.Error("accepted an X before the check digit")
+	}
+
+	if isValidIsbn("978030640615X") {
+		t.Error("accepted an X in an ISBN-13")
+	}
+}
+
+func TestIsValidIsbnRejectsOtherLengths(t *testing.T) {
+	// all zeros passes both checksums, so only the length can reject these
+	for length := 0; length <= 14; length++ {
+		isbn := ""
+		for i := 0; i < length; i++ {
+			isbn += "0"
+		}
+
+		if expected := length == 10 || length == 13; isValidIsbn(isbn) != expected {
+			t.Errorf("isValidIsbn(%q) = %v, expected %v", isbn, !expected, expected)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Package categoryservice handles interactions with database layer.
+*/
+package categoryservice
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+)
+
+var CategoryNameAlreadyInUseError = errors.New("Category name already in use")
+
+var InvalidCategoryNameError = errors.New("Category name cannot be empty or contain whitespace")
+
+var InvalidCategoryColorError = errors.New("Category color must be a hex color such as #1a2b3c")
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// StoreNewCategory makes a new category available to the members of a club.
+// Only organizers of the club may define categories for it. The name may be in use by other clubs,
+// but not by the club itself or by a default category.
+func StoreNewCategory(
+	creatorId models.UserId,
+	clubId models.ClubId,
+	categoryDefinition *models.CategoryDefinition,
+) (models.Category, error) {
+	if err := clubservice.CheckUserOrganizesClub(creatorId, clubId); err != nil {
+		return 0, err
+	}
+
+	if len(categoryDefinition.Name) == 0 || strings.ContainsAny(categoryDefinition.Name, " \t\r\n") {
+		return 0, InvalidCategoryNameError
+	}
+
+	if !colorPattern.MatchString(categoryDefinition.Color) {
+		return 0, InvalidCategoryColorError
+	}
+
+	categoryId, err := databaseutil.InsertCategory(
+		int64(clubId),
+		categoryDefinition.Name,
+		categoryDefinition.Description,
+		categoryDefinition.Color,
+		categoryDefinition.SortOrder,
+		int64(creatorId),
+		time.Now().UTC())
+	if err != nil {
+		if err == databaseutil.UniqueConstraintError {
+			return 0, CategoryNameAlreadyInUseError
+		}
+
+		return 0, err
+	}
+
+	return models.Category(categoryId), nil
+}
+
+// GetCategoryDefinitions returns the default categories along with those of the user's clubs,
+// ordered by sort order.
+func GetCategoryDefinitions(userId models.UserId) ([]*models.CategoryDefinition, error) {
+	categoryRows, err := databaseutil.GetCategoriesAvailableToUser(int64(userId))
+	if err != nil {
+		return nil, err
+	}
+
+	categoryDefinitions := make([]*models.CategoryDefinition, 0, len(categoryRows))
+	for _, categoryRow := range categoryRows {
+		categoryDefinitions = append(categoryDefinitions, convertCategoryRowToCategoryDefinition(categoryRow))
+	}
+
+	return categoryDefinitions, nil
+}
+
+// DatabaseCategoryStore implements models.CategoryStore on top of the database.
+// Names are not cached, since which categories a user may see changes as the user joins and leaves clubs.
+type DatabaseCategoryStore struct{}
+
+func NewDatabaseCategoryStore() *DatabaseCategoryStore {
+	return &DatabaseCategoryStore{}
+}
+
+func (store *DatabaseCategoryStore) GetCategoryByName(
+	viewerId models.UserId,
+	clubId models.ClubId,
+	name string,
+) (models.Category, error) {
+	categoryRows, err := databaseutil.GetCategoriesAvailableToUserByName(
+		int64(viewerId),
+		convertClubIdToNullableInt(clubId),
+		name)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(categoryRows) == 0 {
+		return 0, models.CannotDeserializeCategoryStringError
+	}
+
+	if len(categoryRows) > 1 {
+		return 0, models.AmbiguousCategoryNameError
+	}
+
+	return models.Category(categoryRows[0].Id), nil
+}
+
+// PRIVATE
+
+func convertCategoryRowToCategoryDefinition(categoryRow *databaseutil.CategoryRow) *models.CategoryDefinition {
+	return &models.CategoryDefinition{
+		Id:          models.Category(categoryRow.Id),
+		ClubId:      models.ClubId(categoryRow.ClubId),
+		Name:        categoryRow.Name,
+		Description: categoryRow.Description,
+		Color:       categoryRow.Color,
+		SortOrder:   categoryRow.SortOrder,
+	}
+}
+
+func convertClubIdToNullableInt(clubId models.ClubId) *int64 {
+	if clubId == 0 {
+		return nil
+	}
+
+	clubIdAsInt := int64(clubId)
+	return &clubIdAsInt
+}
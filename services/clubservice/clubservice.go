@@ -0,0 +1,206 @@
+/*
+Package clubservice handles interactions with database layer.
+*/
+package clubservice
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+)
+
+var ClubNotFoundError = errors.New("No club with the given id includes this user")
+
+var NotClubOrganizerError = errors.New("Only an organizer of the club may do this")
+
+var ClubMemberNotFoundError = errors.New("The user is not a member of the club")
+
+var ClubNeedsAnOrganizerError = errors.New("A club with members must keep at least one organizer")
+
+var InvalidClubNameError = errors.New("Club name cannot be empty")
+
+// CreateClub starts a new club with its creator as its first organizer.
+func CreateClub(creatorId models.UserId, name string) (models.ClubId, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return 0, InvalidClubNameError
+	}
+
+	clubId, err := databaseutil.InsertClub(name, int64(creatorId), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return models.ClubId(clubId), nil
+}
+
+// GetClubsOfUser returns the clubs the user belongs to along with the user's role in each, oldest first.
+func GetClubsOfUser(userId models.UserId) ([]*models.ClubMembership, error) {
+	membershipRows, err := databaseutil.GetClubMembershipsOfUser(int64(userId))
+	if err != nil {
+		return nil, err
+	}
+
+	memberships := make([]*models.ClubMembership, 0, len(membershipRows))
+	for _, membershipRow := range membershipRows {
+		membership, err := convertClubMembershipRowToClubMembership(membershipRow)
+		if err != nil {
+			return nil, err
+		}
+
+		memberships = append(memberships, membership)
+	}
+
+	return memberships, nil
+}
+
+// GetRoleOfUser returns ClubNotFoundError if the user does not belong to the club.
+func GetRoleOfUser(userId models.UserId, clubId models.ClubId) (models.ClubRole, error) {
+	membershipRow, err := databaseutil.GetClubMembershipOfUser(int64(clubId), int64(userId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return 0, ClubNotFoundError
+		}
+
+		return 0, err
+	}
+
+	return models.DeserializeClubRole(membershipRow.Role)
+}
+
+// CheckUserOrganizesClub returns ClubNotFoundError if the user does not belong to the club,
+// and NotClubOrganizerError if the user is a plain member of it.
+func CheckUserOrganizesClub(userId models.UserId, clubId models.ClubId) error {
+	role, err := GetRoleOfUser(userId, clubId)
+	if err != nil {
+		return err
+	}
+
+	if role != models.ORGANIZER {
+		return NotClubOrganizerError
+	}
+
+	return nil
+}
+
+// GetClubMembersVisibleToUser returns the members of the club, organizers first.
+// Only members of the club may list its members; anyone else gets ClubNotFoundError.
+func GetClubMembersVisibleToUser(userId models.UserId, clubId models.ClubId) ([]*models.ClubMember, error) {
+	if _, err := GetRoleOfUser(userId, clubId); err != nil {
+		return nil, err
+	}
+
+	memberRows, err := databaseutil.GetClubMembers(int64(clubId))
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*models.ClubMember, 0, len(memberRows))
+	for _, memberRow := range memberRows {
+		role, err := models.DeserializeClubRole(memberRow.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, &models.ClubMember{
+			UserId:   models.UserId(memberRow.UserId),
+			User:     &models.User{DisplayName: memberRow.DisplayName},
+			Role:     role,
+			JoinTime: memberRow.JoinTime,
+		})
+	}
+
+	return members, nil
+}
+
+// ChangeMemberRole promotes a member to organizer or steps an organizer down.
+// Only organizers may change roles, and the last organizer cannot step down while others remain.
+func ChangeMemberRole(
+	organizerId models.UserId,
+	clubId models.ClubId,
+	memberId models.UserId,
+	role models.ClubRole,
+) error {
+	if err := CheckUserOrganizesClub(organizerId, clubId); err != nil {
+		return err
+	}
+
+	if err := databaseutil.UpdateClubMemberRole(int64(clubId), int64(memberId), role.String()); err != nil {
+		switch err {
+		case databaseutil.QueryResultContainedNoRowsError:
+			return ClubMemberNotFoundError
+		case databaseutil.ClubLeftWithoutOrganizerError:
+			return ClubNeedsAnOrganizerError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// LeaveClub removes the user from the club. The last organizer must hand over the club first,
+// unless they are its last member.
+func LeaveClub(userId models.UserId, clubId models.ClubId) error {
+	if err := databaseutil.DeleteClubMembership(int64(clubId), int64(userId)); err != nil {
+		switch err {
+		case databaseutil.QueryResultContainedNoRowsError:
+			return ClubNotFoundError
+		case databaseutil.ClubLeftWithoutOrganizerError:
+			return ClubNeedsAnOrganizerError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetFellowMembers returns the user along with every member of the user's clubs.
+func GetFellowMembers(userId models.UserId) (map[models.UserId]*models.User, error) {
+	userRows, err := databaseutil.GetUsersSharingClubWith(int64(userId))
+	if err != nil {
+		return nil, err
+	}
+
+	usersById := make(map[models.UserId]*models.User, len(userRows))
+	for _, userRow := range userRows {
+		usersById[models.UserId(userRow.Id)] = &models.User{DisplayName: userRow.DisplayName}
+	}
+
+	return usersById, nil
+}
+
+// DoUsersShareClub tells whether the two users belong to at least one club together.
+func DoUsersShareClub(userId models.UserId, otherUserId models.UserId) (bool, error) {
+	return databaseutil.DoUsersShareClub(int64(userId), int64(otherUserId))
+}
+
+// IsOrganizerOverUser tells whether the organizer organizes a club the member belongs to.
+func IsOrganizerOverUser(organizerId models.UserId, memberId models.UserId) (bool, error) {
+	return databaseutil.IsOrganizerOverUser(int64(organizerId), int64(memberId))
+}
+
+// PRIVATE
+
+func convertClubMembershipRowToClubMembership(
+	membershipRow *databaseutil.ClubMembershipRow,
+) (*models.ClubMembership, error) {
+	role, err := models.DeserializeClubRole(membershipRow.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ClubMembership{
+		Id: models.ClubId(membershipRow.ClubId),
+		Club: models.Club{
+			Name:         membershipRow.Name,
+			CreatorId:    models.UserId(membershipRow.CreatorId),
+			CreationTime: membershipRow.CreationTime,
+		},
+		Role: role,
+	}, nil
+}
@@ -0,0 +1,217 @@
+package clubservice
+
+import (
+	"errors"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+)
+
+// MaxInviteLifetime bounds how long an invite link stays valid.
+const MaxInviteLifetime = 30 * 24 * time.Hour
+
+var ClubInviteNotFoundError = errors.New("No outstanding invite exists with the given id")
+
+var ClubInviteNotUsableError = errors.New("The invite was revoked, has expired or has no uses left")
+
+var InvalidInviteLifetimeError = errors.New("Invites must expire within 30 days")
+
+var InvalidInviteMaxUsesError = errors.New("An invite's use limit must be at least 1")
+
+// CreateInvite lets an organizer invite others to the club until the invite expires or,
+// when maxUses is not nil, until it has been used that many times.
+func CreateInvite(
+	organizerId models.UserId,
+	clubId models.ClubId,
+	maxUses *int,
+	lifetime time.Duration,
+) (models.ClubInviteId, *models.ClubInvite, error) {
+	if err := CheckUserOrganizesClub(organizerId, clubId); err != nil {
+		return 0, nil, err
+	}
+
+	if lifetime <= 0 || lifetime > MaxInviteLifetime {
+		return 0, nil, InvalidInviteLifetimeError
+	}
+
+	if maxUses != nil && *maxUses < 1 {
+		return 0, nil, InvalidInviteMaxUsesError
+	}
+
+	invite := &models.ClubInvite{
+		ClubId:       clubId,
+		CreatorId:    organizerId,
+		MaxUses:      maxUses,
+		CreationTime: time.Now().UTC(),
+	}
+	invite.ExpirationTime = invite.CreationTime.Add(lifetime)
+
+	inviteId, err := databaseutil.InsertClubInvite(
+		int64(clubId),
+		int64(organizerId),
+		convertIntToNullableInt64(maxUses),
+		invite.ExpirationTime,
+		invite.CreationTime)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return models.ClubInviteId(inviteId), invite, nil
+}
+
+// GetOutstandingInvites returns the invites of the club that can still be used, newest first.
+// Only organizers of the club may list them.
+func GetOutstandingInvites(
+	organizerId models.UserId,
+	clubId models.ClubId,
+) ([]*models.ClubInviteWithId, error) {
+	if err := CheckUserOrganizesClub(organizerId, clubId); err != nil {
+		return nil, err
+	}
+
+	inviteRows, err := databaseutil.GetOutstandingClubInvites(int64(clubId), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	invites := make([]*models.ClubInviteWithId, 0, len(inviteRows))
+	for _, inviteRow := range inviteRows {
+		invites = append(invites, &models.ClubInviteWithId{
+			Id:         models.ClubInviteId(inviteRow.Id),
+			ClubInvite: convertClubInviteRowToClubInvite(inviteRow),
+		})
+	}
+
+	return invites, nil
+}
+
+// GetUsableInvite returns ClubInviteNotUsableError unless the invite can still be used to join its club.
+func GetUsableInvite(inviteId models.ClubInviteId) (*models.ClubInvite, error) {
+	inviteRow, err := databaseutil.GetClubInviteById(int64(inviteId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return nil, ClubInviteNotUsableError
+		}
+
+		return nil, err
+	}
+
+	if inviteRow.RevocationTime != nil ||
+		!inviteRow.ExpirationTime.After(time.Now().UTC()) ||
+		(inviteRow.MaxUses != nil && inviteRow.UseCount >= *inviteRow.MaxUses) {
+		return nil, ClubInviteNotUsableError
+	}
+
+	return convertClubInviteRowToClubInvite(inviteRow), nil
+}
+
+// SetInviteMaxUses changes how many times an invite may be used; nil removes the limit.
+// Only organizers of the invite's club may change it.
+func SetInviteMaxUses(organizerId models.UserId, inviteId models.ClubInviteId, maxUses *int) error {
+	if _, err := getInviteOrganizedByUser(organizerId, inviteId); err != nil {
+		return err
+	}
+
+	if maxUses != nil && *maxUses < 1 {
+		return InvalidInviteMaxUsesError
+	}
+
+	if err := databaseutil.UpdateClubInviteMaxUses(
+		int64(inviteId),
+		convertIntToNullableInt64(maxUses),
+	); err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return ClubInviteNotFoundError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// RevokeInvite stops an invite from being used again. Only organizers of the invite's club may revoke it.
+func RevokeInvite(organizerId models.UserId, inviteId models.ClubInviteId) error {
+	if _, err := getInviteOrganizedByUser(organizerId, inviteId); err != nil {
+		return err
+	}
+
+	if err := databaseutil.RevokeClubInvite(int64(inviteId), time.Now().UTC()); err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return ClubInviteNotFoundError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// JoinClubByInvite makes the user a member of the invite's club. Joining a club the user already
+// belongs to succeeds without using up the invite.
+func JoinClubByInvite(userId models.UserId, inviteId models.ClubInviteId) (models.ClubId, error) {
+	invite, err := GetUsableInvite(inviteId)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := databaseutil.RedeemClubInvite(int64(inviteId), int64(userId), time.Now().UTC()); err != nil {
+		if err == databaseutil.ClubInviteNotUsableError {
+			return 0, ClubInviteNotUsableError
+		}
+
+		return 0, err
+	}
+
+	return invite.ClubId, nil
+}
+
+// PRIVATE
+
+func getInviteOrganizedByUser(organizerId models.UserId, inviteId models.ClubInviteId) (*models.ClubInvite, error) {
+	inviteRow, err := databaseutil.GetClubInviteById(int64(inviteId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return nil, ClubInviteNotFoundError
+		}
+
+		return nil, err
+	}
+
+	if err := CheckUserOrganizesClub(organizerId, models.ClubId(inviteRow.ClubId)); err != nil {
+		if err == ClubNotFoundError {
+			return nil, ClubInviteNotFoundError
+		}
+
+		return nil, err
+	}
+
+	return convertClubInviteRowToClubInvite(inviteRow), nil
+}
+
+func convertClubInviteRowToClubInvite(inviteRow *databaseutil.ClubInviteRow) *models.ClubInvite {
+	invite := &models.ClubInvite{
+		ClubId:         models.ClubId(inviteRow.ClubId),
+		CreatorId:      models.UserId(inviteRow.CreatorId),
+		UseCount:       int(inviteRow.UseCount),
+		ExpirationTime: inviteRow.ExpirationTime,
+		CreationTime:   inviteRow.CreationTime,
+	}
+
+	if inviteRow.MaxUses != nil {
+		maxUses := int(*inviteRow.MaxUses)
+		invite.MaxUses = &maxUses
+	}
+
+	return invite
+}
+
+func convertIntToNullableInt64(value *int) *int64 {
+	if value == nil {
+		return nil
+	}
+
+	valueAsInt64 := int64(*value)
+	return &valueAsInt64
+}
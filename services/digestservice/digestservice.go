@@ -0,0 +1,280 @@
+/*
+Package digestservice emails users a daily or weekly digest of the publications of their clubs
+and of the questions that are still open.
+*/
+package digestservice
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/paths"
+	"github.com/atmiguel/cerealnotes/services/agendaservice"
+	"github.com/atmiguel/cerealnotes/services/publicationservice"
+)
+
+// openQuestionWindow keeps questions asked longer ago than this out of the digest,
+// so that it does not grow forever with questions nobody answers.
+const openQuestionWindow = time.Hour * 24 * 30
+
+// DigestPublication summarizes a publication that went live since the previous digest.
+// NoteCount includes the notes counted by WithheldCount.
+type DigestPublication struct {
+	Title         string
+	AuthorName    string
+	BookTitle     string
+	NoteCount     int
+	WithheldCount int
+}
+
+// Digest is what the digest templates are rendered from. WithheldCount counts the notes and questions
+// redacted because they are beyond the recipient's reading progress.
+type Digest struct {
+	RecipientName   string
+	Frequency       models.DigestFrequency
+	Publications    []*DigestPublication
+	OpenQuestions   []*agendaservice.AgendaSection
+	WithheldCount   int
+	PublicationsUrl string
+	AgendaUrl       string
+	UnsubscribeUrl  string
+}
+
+// Subscribe sends the user a digest with the given frequency from now on.
+// Changing the frequency of an existing subscription keeps the time its last digest was sent.
+func Subscribe(userId models.UserId, frequency models.DigestFrequency) error {
+	return databaseutil.UpsertDigestSubscription(int64(userId), frequency.String(), time.Now().UTC())
+}
+
+// Unsubscribe stops sending the user digests. Unsubscribing twice does nothing.
+func Unsubscribe(userId models.UserId) error {
+	return databaseutil.DeleteDigestSubscription(int64(userId))
+}
+
+// GetSubscription returns nil if the user receives no digest.
+func GetSubscription(userId models.UserId) (*models.DigestSubscription, error) {
+	subscriptionRow, err := databaseutil.GetDigestSubscription(int64(userId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	frequency, err := models.DeserializeDigestFrequency(subscriptionRow.Frequency)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.DigestSubscription{
+		Frequency:    frequency,
+		LastSentTime: subscriptionRow.LastSentTime,
+	}, nil
+}
+
+// SendDueDigests emails every subscriber whose digest is due and returns how many digests were sent.
+// Subscribers with nothing new published since their last digest are skipped until the next one is due.
+// A digest that cannot be sent is retried on the next run, without holding up the other subscribers;
+// the first such error is returned. It is safe to run from several server instances at once.
+func SendDueDigests() (int, error) {
+	if mailer == nil {
+		return 0, MailerNotConfiguredError
+	}
+
+	digestTemplates, err := parseDigestTemplates()
+	if err != nil {
+		return 0, err
+	}
+
+	// Postgres keeps microseconds, so the time must be truncated for it to be compared later
+	sendTime := time.Now().UTC().Truncate(time.Microsecond)
+
+	sentCount := 0
+	var firstErr error
+
+	for _, frequency := range []models.DigestFrequency{models.DAILY, models.WEEKLY} {
+		subscriptionRows, err := databaseutil.GetDigestSubscriptionsDue(
+			frequency.String(),
+			sendTime.Add(-frequency.Period()))
+		if err != nil {
+			return sentCount, err
+		}
+
+		for _, subscriptionRow := range subscriptionRows {
+			isSent, err := sendDigest(
+				digestTemplates,
+				subscriptionRow,
+				frequency,
+				sendTime,
+				databaseutil.UpdateDigestLastSentTime,
+				compileDigest)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("sending the digest of user %d: %s", subscriptionRow.UserId, err)
+				}
+
+				continue
+			}
+
+			if isSent {
+				sentCount++
+			}
+		}
+	}
+
+	return sentCount, firstErr
+}
+
+// PRIVATE
+
+// sendDigest claims the subscriber's digest before sending it, so that no other server instance sends it too,
+// and gives the claim back if the digest could not be sent. The claim is made with updateLastSentTime
+// and the digest put together with compile.
+func sendDigest(
+	digestTemplates *digestTemplates,
+	subscriptionRow *databaseutil.DigestSubscriptionRow,
+	frequency models.DigestFrequency,
+	sendTime time.Time,
+	updateLastSentTime func(userId int64, previousLastSentTime time.Time, lastSentTime time.Time) error,
+	compile func(userId models.UserId, publishedAfter time.Time, publishedBefore time.Time) (*Digest, error),
+) (bool, error) {
+	if err := updateLastSentTime(
+		subscriptionRow.UserId,
+		subscriptionRow.LastSentTime,
+		sendTime,
+	); err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	isSent, err := compileAndSendDigest(digestTemplates, subscriptionRow, frequency, sendTime, compile)
+	if err != nil {
+		if releaseErr := updateLastSentTime(
+			subscriptionRow.UserId,
+			sendTime,
+			subscriptionRow.LastSentTime,
+		); releaseErr != nil && releaseErr != databaseutil.QueryResultContainedNoRowsError {
+			return false, releaseErr
+		}
+
+		return false, err
+	}
+
+	return isSent, nil
+}
+
+func compileAndSendDigest(
+	digestTemplates *digestTemplates,
+	subscriptionRow *databaseutil.DigestSubscriptionRow,
+	frequency models.DigestFrequency,
+	sendTime time.Time,
+	compile func(userId models.UserId, publishedAfter time.Time, publishedBefore time.Time) (*Digest, error),
+) (bool, error) {
+	userId := models.UserId(subscriptionRow.UserId)
+
+	digest, err := compile(userId, subscriptionRow.LastSentTime, sendTime)
+	if err != nil {
+		return false, err
+	}
+
+	if len(digest.Publications) == 0 {
+		return false, nil
+	}
+
+	digest.RecipientName = subscriptionRow.DisplayName
+	digest.Frequency = frequency
+
+	unsubscribeLink, err := mailer.CreateUnsubscribeLink(userId)
+	if err != nil {
+		return false, err
+	}
+
+	digest.PublicationsUrl = mailer.SiteUrl + paths.PublicationsPage
+	digest.AgendaUrl = mailer.SiteUrl + paths.AgendaPage
+	digest.UnsubscribeUrl = mailer.SiteUrl + unsubscribeLink
+
+	textBody, htmlBody, err := digestTemplates.render(digest)
+	if err != nil {
+		return false, err
+	}
+
+	if err := sendMail(
+		subscriptionRow.DisplayName,
+		subscriptionRow.EmailAddress,
+		describeSubject(digest),
+		digest.UnsubscribeUrl,
+		textBody,
+		htmlBody,
+	); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// compileDigest gathers the publications by others that went live from publishedAfter, inclusive,
+// to publishedBefore, exclusive, along with the questions of the last weeks that are still open.
+// Spoilers are never revealed in a digest.
+func compileDigest(userId models.UserId, publishedAfter time.Time, publishedBefore time.Time) (*Digest, error) {
+	publications, err := publicationservice.GetLivePublications(userId, &publicationservice.PublicationFilter{
+		PublishedAfter:  &publishedAfter,
+		PublishedBefore: &publishedBefore,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &Digest{Publications: make([]*DigestPublication, 0, len(publications))}
+
+	// publications come most recently published first, which suits a digest too
+	for _, publication := range publications {
+		if publication.AuthorId == userId || publication.RetractionTime != nil {
+			continue
+		}
+
+		digestPublication := &DigestPublication{
+			Title:         publication.Title,
+			AuthorName:    publication.Author.DisplayName,
+			BookTitle:     publication.BookTitle,
+			WithheldCount: publication.WithheldCount,
+		}
+
+		for _, noteGroup := range publication.NoteGroups {
+			digestPublication.NoteCount += len(noteGroup.Notes)
+		}
+
+		digest.Publications = append(digest.Publications, digestPublication)
+		digest.WithheldCount += publication.WithheldCount
+	}
+
+	askedAfter := publishedBefore.Add(-openQuestionWindow)
+
+	agenda, err := agendaservice.CompileAgenda(userId, &agendaservice.AgendaFilter{
+		PublishedAfter:  &askedAfter,
+		PublishedBefore: &publishedBefore,
+		GroupBy:         models.BY_CHAPTER,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digest.OpenQuestions = agenda.Questions
+	digest.WithheldCount += agenda.WithheldCount
+
+	return digest, nil
+}
+
+func describeSubject(digest *Digest) string {
+	publicationCount := "1 new publication"
+	if len(digest.Publications) != 1 {
+		publicationCount = fmt.Sprintf("%d new publications", len(digest.Publications))
+	}
+
+	return fmt.Sprintf("Your %s CerealNotes digest: %s", digest.Frequency, publicationCount)
+}
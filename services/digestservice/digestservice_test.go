@@ -0,0 +1,548 @@
+package digestservice_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/handlers"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/paths"
+	"github.com/atmiguel/cerealnotes/services/agendaservice"
+	"github.com/atmiguel/cerealnotes/services/digestservice"
+)
+
+const siteUrl = "https://cerealnotes.example"
+
+var tokenSigningKey = []byte("digest test signing key")
+
+func TestMain(m *testing.M) {
+	// the templates are read relative to the root of the repository, as they are when the server runs
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+
+	handlers.SetTokenSigningKey(tokenSigningKey)
+
+	os.Exit(m.Run())
+}
+
+func TestSendDigestMailsTextAndHtmlWithSignedUnsubscribeLink(t *testing.T) {
+	server := startSmtpServer(t)
+	defer server.close()
+
+	setMailer(server.address)
+
+	lastSentTimes := newLastSentTimeStore()
+	subscriptionRow := newSubscriptionRow()
+	lastSentTimes.subscribe(subscriptionRow)
+
+	isSent, err := digestservice.SendDigest(
+		subscriptionRow,
+		models.DAILY,
+		subscriptionRow.LastSentTime.Add(time.Hour*24),
+		lastSentTimes.update,
+		compileSampleDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isSent {
+		t.Fatal("the digest was not sent")
+	}
+
+	messages := server.receivedMessages()
+	if len(messages) != 1 {
+		t.Fatalf("the server received %d messages, expected 1", len(messages))
+	}
+
+	message := messages[0]
+	if message.sender != "digest@cerealnotes.example" {
+		t.Errorf("sender = %q", message.sender)
+	}
+
+	if len(message.recipients) != 1 || message.recipients[0] != subscriptionRow.EmailAddress {
+		t.Errorf("recipients = %q, expected only %q", message.recipients, subscriptionRow.EmailAddress)
+	}
+
+	parsedMessage, err := mail.ReadMessage(strings.NewReader(message.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsedMessage.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if subject != "Your daily CerealNotes digest: 1 new publication" {
+		t.Errorf("subject = %q", subject)
+	}
+
+	if to := parsedMessage.Header.Get("To"); !strings.Contains(to, subscriptionRow.EmailAddress) {
+		t.Errorf("To = %q, expected it to hold %q", to, subscriptionRow.EmailAddress)
+	}
+
+	listUnsubscribe := parsedMessage.Header.Get("List-Unsubscribe")
+	if !strings.HasPrefix(listUnsubscribe, "<") || !strings.HasSuffix(listUnsubscribe, ">") {
+		t.Fatalf("List-Unsubscribe = %q, expected a url in angle brackets", listUnsubscribe)
+	}
+
+	unsubscribeUrl := strings.TrimSuffix(strings.TrimPrefix(listUnsubscribe, "<"), ">")
+
+	if listUnsubscribePost := parsedMessage.Header.Get("List-Unsubscribe-Post"); listUnsubscribePost !=
+		"List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post = %q", listUnsubscribePost)
+	}
+
+	textBody, htmlBody := readAlternativeParts(t, parsedMessage)
+
+	for _, expectedText := range []string{
+		"Hi Ada Lovelace,",
+		"since your last daily digest",
+		"* Thoughts on the first act by Grace Hopper (Dune)",
+		"3 note(s), 1 hidden to avoid spoilers",
+		"Read them at " + siteUrl + paths.PublicationsPage,
+		"Chapter 2",
+		"* Why did the spice stop flowing?",
+		"See the agenda at " + siteUrl + paths.AgendaPage,
+		"Unsubscribe: " + unsubscribeUrl,
+	} {
+		if !strings.Contains(textBody, expectedText) {
+			t.Errorf("the text part lacks %q:\n%s", expectedText, textBody)
+		}
+	}
+
+	for _, expectedHtml := range []string{
+		"<p>Hi Ada Lovelace,</p>",
+		"<strong>Thoughts on the first act</strong>",
+		"Why did the spice stop flowing?",
+		`<a href="` + siteUrl + paths.PublicationsPage + `">`,
+		`<a href="` + unsubscribeUrl + `">Unsubscribe</a>`,
+	} {
+		if !strings.Contains(htmlBody, expectedHtml) {
+			t.Errorf("the HTML part lacks %q:\n%s", expectedHtml, htmlBody)
+		}
+	}
+
+	assertUnsubscribeLinkIsSignedFor(t, unsubscribeUrl, models.UserId(subscriptionRow.UserId))
+}
+
+func TestSendDigestSkipsDigestsClaimedElsewhere(t *testing.T) {
+	server := startSmtpServer(t)
+	defer server.close()
+
+	setMailer(server.address)
+
+	lastSentTimes := newLastSentTimeStore()
+	subscriptionRow := newSubscriptionRow()
+	lastSentTimes.subscribe(subscriptionRow)
+
+	sendTime := subscriptionRow.LastSentTime.Add(time.Hour * 24)
+
+	// two server instances that both found the subscriber due, from the same row
+	for instance, expectedIsSent := range []bool{true, false} {
+		isSent, err := digestservice.SendDigest(
+			subscriptionRow,
+			models.DAILY,
+			sendTime,
+			lastSentTimes.update,
+			compileSampleDigest)
+		if err != nil {
+			t.Fatalf("instance %d: %s", instance, err)
+		}
+
+		if isSent != expectedIsSent {
+			t.Errorf("instance %d: isSent = %t, expected %t", instance, isSent, expectedIsSent)
+		}
+	}
+
+	if messageCount := len(server.receivedMessages()); messageCount != 1 {
+		t.Errorf("the server received %d messages, expected 1", messageCount)
+	}
+
+	if lastSentTime := lastSentTimes.get(subscriptionRow.UserId); !lastSentTime.Equal(sendTime) {
+		t.Errorf("last sent time = %v, expected %v", lastSentTime, sendTime)
+	}
+}
+
+func TestSendDigestGivesClaimBackWhenMailCannotBeSent(t *testing.T) {
+	server := startSmtpServer(t)
+	setMailer(server.address)
+	// nothing listens on the address anymore
+	server.close()
+
+	lastSentTimes := newLastSentTimeStore()
+	subscriptionRow := newSubscriptionRow()
+	lastSentTimes.subscribe(subscriptionRow)
+
+	isSent, err := digestservice.SendDigest(
+		subscriptionRow,
+		models.DAILY,
+		subscriptionRow.LastSentTime.Add(time.Hour*24),
+		lastSentTimes.update,
+		compileSampleDigest)
+	if err == nil || isSent {
+		t.Fatalf("SendDigest = (%t, %v), expected an error", isSent, err)
+	}
+
+	if lastSentTime := lastSentTimes.get(subscriptionRow.UserId); !lastSentTime.Equal(subscriptionRow.LastSentTime) {
+		t.Errorf("last sent time = %v, expected it to be given back as %v", lastSentTime, subscriptionRow.LastSentTime)
+	}
+}
+
+func TestSendDigestSkipsDigestsWithNothingNew(t *testing.T) {
+	server := startSmtpServer(t)
+	defer server.close()
+
+	setMailer(server.address)
+
+	lastSentTimes := newLastSentTimeStore()
+	compileEmptyDigest := func(models.UserId, time.Time, time.Time) (*digestservice.Digest, error) {
+		return &digestservice.Digest{Publications: []*digestservice.DigestPublication{}}, nil
+	}
+
+	subscriptionRow := newSubscriptionRow()
+	lastSentTimes.subscribe(subscriptionRow)
+
+	isSent, err := digestservice.SendDigest(
+		subscriptionRow,
+		models.WEEKLY,
+		subscriptionRow.LastSentTime.Add(time.Hour*24*7),
+		lastSentTimes.update,
+		compileEmptyDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isSent {
+		t.Error("a digest without new publications was sent")
+	}
+
+	if messageCount := len(server.receivedMessages()); messageCount != 0 {
+		t.Errorf("the server received %d messages, expected none", messageCount)
+	}
+}
+
+// PRIVATE
+
+func setMailer(serverAddress string) {
+	digestservice.SetMailer(&digestservice.Mailer{
+		ServerAddress:         serverAddress,
+		SenderAddress:         "digest@cerealnotes.example",
+		SiteUrl:               siteUrl,
+		CreateUnsubscribeLink: handlers.CreateDigestUnsubscribeLink,
+	})
+}
+
+func newSubscriptionRow() *databaseutil.DigestSubscriptionRow {
+	return &databaseutil.DigestSubscriptionRow{
+		UserId:       7,
+		DisplayName:  "Ada Lovelace",
+		EmailAddress: "ada@cerealnotes.example",
+		Frequency:    models.DAILY.String(),
+		LastSentTime: time.Date(2018, time.March, 4, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+func compileSampleDigest(models.UserId, time.Time, time.Time) (*digestservice.Digest, error) {
+	return &digestservice.Digest{
+		Publications: []*digestservice.DigestPublication{{
+			Title:         "Thoughts on the first act",
+			AuthorName:    "Grace Hopper",
+			BookTitle:     "Dune",
+			NoteCount:     3,
+			WithheldCount: 1,
+		}},
+		OpenQuestions: []*agendaservice.AgendaSection{{
+			Heading: "Chapter 2",
+			Items: []*agendaservice.AgendaItem{{
+				Author:  &models.User{DisplayName: "Grace Hopper"},
+				Content: "Why did the spice stop flowing?",
+			}},
+		}},
+		WithheldCount: 1,
+	}, nil
+}
+
+// assertUnsubscribeLinkIsSignedFor checks that the link names the user in a token signed with the server's key,
+// and that the unsubscribe page accepts it but not a forged one.
+func assertUnsubscribeLinkIsSignedFor(t *testing.T, unsubscribeUrl string, userId models.UserId) {
+	t.Helper()
+
+	if !strings.HasPrefix(unsubscribeUrl, siteUrl+paths.UnsubscribePage+"?") {
+		t.Fatalf("unsubscribe url = %q, expected the unsubscribe page", unsubscribeUrl)
+	}
+
+	parsedUrl, err := url.Parse(unsubscribeUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := parsedUrl.Query().Get("token")
+
+	claims := new(handlers.DigestUnsubscribeTokenClaim)
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return tokenSigningKey, nil
+	}); err != nil {
+		t.Fatalf("the unsubscribe token is not signed with the server's key: %s", err)
+	}
+
+	if claims.SubscriberId != userId {
+		t.Errorf("the unsubscribe token names user %d, expected %d", claims.SubscriberId, userId)
+	}
+
+	forgedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("another key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range []struct {
+		token          string
+		expectedStatus int
+	}{
+		{token, http.StatusOK},
+		{forgedToken, http.StatusBadRequest},
+	} {
+		request := httptest.NewRequest(
+			http.MethodGet,
+			paths.UnsubscribePage+"?token="+url.QueryEscape(testCase.token),
+			nil)
+		responseRecorder := httptest.NewRecorder()
+
+		handlers.HandleDigestUnsubscribePageRequest(responseRecorder, request)
+
+		if responseRecorder.Code != testCase.expectedStatus {
+			t.Errorf("the unsubscribe page answered %d, expected %d", responseRecorder.Code, testCase.expectedStatus)
+		}
+	}
+}
+
+// readAlternativeParts returns the plain text and HTML parts of a multipart/alternative message,
+// with their quoted-printable encoding undone.
+func readAlternativeParts(t *testing.T, message *mail.Message) (string, string) {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, expected multipart/alternative", mediaType)
+	}
+
+	bodiesByContentType := make(map[string]string)
+	contentTypes := make([]string, 0, 2)
+
+	partReader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := partReader.NextPart()
+		if err != nil {
+			break
+		}
+
+		// NextPart decodes quoted-printable parts transparently
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contentType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contentTypes = append(contentTypes, contentType)
+		bodiesByContentType[contentType] = string(body)
+	}
+
+	if strings.Join(contentTypes, ",") != "text/plain,text/html" {
+		t.Fatalf("parts = %q, expected plain text followed by HTML", contentTypes)
+	}
+
+	return bodiesByContentType["text/plain"], bodiesByContentType["text/html"]
+}
+
+// lastSentTimeStore stands in for the digest_subscription table, updating a last sent time
+// only while it is still the expected one, as databaseutil.UpdateDigestLastSentTime does.
+type lastSentTimeStore struct {
+	mutex                sync.Mutex
+	lastSentTimeByUserId map[int64]time.Time
+}
+
+func newLastSentTimeStore() *lastSentTimeStore {
+	return &lastSentTimeStore{lastSentTimeByUserId: make(map[int64]time.Time)}
+}
+
+func (store *lastSentTimeStore) subscribe(subscriptionRow *databaseutil.DigestSubscriptionRow) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.lastSentTimeByUserId[subscriptionRow.UserId] = subscriptionRow.LastSentTime
+}
+
+func (store *lastSentTimeStore) get(userId int64) time.Time {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.lastSentTimeByUserId[userId]
+}
+
+func (store *lastSentTimeStore) update(userId int64, previousLastSentTime time.Time, lastSentTime time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if currentLastSentTime, ok := store.lastSentTimeByUserId[userId]; !ok ||
+		!currentLastSentTime.Equal(previousLastSentTime) {
+		return databaseutil.QueryResultContainedNoRowsError
+	}
+
+	store.lastSentTimeByUserId[userId] = lastSentTime
+	return nil
+}
+
+// smtpServer accepts every message sent to it over SMTP and keeps it.
+type smtpServer struct {
+	address  string
+	listener net.Listener
+
+	mutex    sync.Mutex
+	messages []*receivedMessage
+}
+
+type receivedMessage struct {
+	sender     string
+	recipients []string
+	data       string
+}
+
+func startSmtpServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &smtpServer{address: listener.Addr().String(), listener: listener}
+
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.serve(connection)
+		}
+	}()
+
+	return server
+}
+
+func (server *smtpServer) close() {
+	server.listener.Close()
+}
+
+func (server *smtpServer) receivedMessages() []*receivedMessage {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]*receivedMessage(nil), server.messages...)
+}
+
+func (server *smtpServer) serve(connection net.Conn) {
+	defer connection.Close()
+
+	reader := textproto.NewReader(bufio.NewReader(connection))
+	writer := textproto.NewWriter(bufio.NewWriter(connection))
+
+	reply := func(line string) error {
+		return writer.PrintfLine("%s", line)
+	}
+
+	if err := reply("220 localhost ESMTP"); err != nil {
+		return
+	}
+
+	message := new(receivedMessage)
+
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		argument := strings.TrimSpace(line[len(command):])
+
+		switch command {
+		case "EHLO", "HELO":
+			err = reply("250 localhost")
+		case "MAIL":
+			message.sender = extractAddress(argument)
+			err = reply("250 OK")
+		case "RCPT":
+			message.recipients = append(message.recipients, extractAddress(argument))
+			err = reply("250 OK")
+		case "DATA":
+			if err = reply("354 End data with <CR><LF>.<CR><LF>"); err != nil {
+				return
+			}
+
+			// ReadDotBytes undoes the dot-stuffing of the client
+			data, readErr := reader.ReadDotBytes()
+			if readErr != nil {
+				return
+			}
+
+			message.data = string(data)
+
+			server.mutex.Lock()
+			server.messages = append(server.messages, message)
+			server.mutex.Unlock()
+
+			message = new(receivedMessage)
+			err = reply("250 OK")
+		case "RSET":
+			message = new(receivedMessage)
+			err = reply("250 OK")
+		case "NOOP":
+			err = reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			err = reply("502 Command not implemented")
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// extractAddress returns the address in arguments such as FROM:<ada@cerealnotes.example>.
+func extractAddress(argument string) string {
+	start := strings.Index(argument, "<")
+	end := strings.LastIndex(argument, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+
+	return argument[start+1 : end]
+}
@@ -0,0 +1,25 @@
+package digestservice
+
+import (
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+)
+
+// SendDigest sends one subscriber's digest the way SendDueDigests does,
+// claiming it with updateLastSentTime and putting it together with compile.
+func SendDigest(
+	subscriptionRow *databaseutil.DigestSubscriptionRow,
+	frequency models.DigestFrequency,
+	sendTime time.Time,
+	updateLastSentTime func(userId int64, previousLastSentTime time.Time, lastSentTime time.Time) error,
+	compile func(userId models.UserId, publishedAfter time.Time, publishedBefore time.Time) (*Digest, error),
+) (bool, error) {
+	digestTemplates, err := parseDigestTemplates()
+	if err != nil {
+		return false, err
+	}
+
+	return sendDigest(digestTemplates, subscriptionRow, frequency, sendTime, updateLastSentTime, compile)
+}
@@ -0,0 +1,178 @@
+package digestservice
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"text/template"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/models"
+)
+
+var MailerNotConfiguredError = errors.New("No mail server was configured to send digests through")
+
+const textTemplateFile = "templates/digest_email_text.tmpl"
+const htmlTemplateFile = "templates/digest_email_html.tmpl"
+
+// Mailer sends digests through an SMTP server at ServerAddress, given as host:port.
+// The server is only authenticated with when Username is set; plain authentication is refused
+// over an unencrypted connection unless the server runs on localhost.
+// SiteUrl, such as https://example.com, is prepended to the links in a digest.
+// CreateUnsubscribeLink returns the path, with its query, of the page that unsubscribes the user.
+type Mailer struct {
+	ServerAddress         string
+	Username              string
+	Password              string
+	SenderAddress         string
+	SiteUrl               string
+	CreateUnsubscribeLink func(userId models.UserId) (string, error)
+}
+
+var mailer *Mailer
+
+func SetMailer(newMailer *Mailer) {
+	mailer = newMailer
+}
+
+// PRIVATE
+
+// digestTemplates renders each digest as plain text and as HTML.
+type digestTemplates struct {
+	text *template.Template
+	html *htmltemplate.Template
+}
+
+func parseDigestTemplates() (*digestTemplates, error) {
+	textTemplate, err := template.ParseFiles(textTemplateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlTemplate, err := htmltemplate.ParseFiles(htmlTemplateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &digestTemplates{text: textTemplate, html: htmlTemplate}, nil
+}
+
+func (digestTemplates *digestTemplates) render(digest *Digest) ([]byte, []byte, error) {
+	textBody := new(bytes.Buffer)
+	if err := digestTemplates.text.Execute(textBody, digest); err != nil {
+		return nil, nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	if err := digestTemplates.html.Execute(htmlBody, digest); err != nil {
+		return nil, nil, err
+	}
+
+	return textBody.Bytes(), htmlBody.Bytes(), nil
+}
+
+// sendMail sends a message whose plain text and HTML bodies are alternatives of each other.
+func sendMail(
+	recipientName string,
+	recipientAddress string,
+	subject string,
+	unsubscribeUrl string,
+	textBody []byte,
+	htmlBody []byte,
+) error {
+	message, err := composeMessage(
+		&mail.Address{Name: "CerealNotes", Address: mailer.SenderAddress},
+		&mail.Address{Name: recipientName, Address: recipientAddress},
+		subject,
+		unsubscribeUrl,
+		textBody,
+		htmlBody)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if len(mailer.Username) > 0 {
+		host, _, err := net.SplitHostPort(mailer.ServerAddress)
+		if err != nil {
+			return err
+		}
+
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, host)
+	}
+
+	return smtp.SendMail(mailer.ServerAddress, auth, mailer.SenderAddress, []string{recipientAddress}, message)
+}
+
+// composeMessage builds a multipart/alternative message, plain text first as RFC 2046 asks.
+// The List-Unsubscribe headers let mail clients offer one-click unsubscribing as described in RFC 8058.
+func composeMessage(
+	sender *mail.Address,
+	recipient *mail.Address,
+	subject string,
+	unsubscribeUrl string,
+	textBody []byte,
+	htmlBody []byte,
+) ([]byte, error) {
+	message := new(bytes.Buffer)
+	bodyWriter := multipart.NewWriter(message)
+
+	headers := []struct {
+		name  string
+		value string
+	}{
+		{"From", sender.String()},
+		{"To", recipient.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"List-Unsubscribe", "<" + unsubscribeUrl + ">"},
+		{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", mime.FormatMediaType(
+			"multipart/alternative",
+			map[string]string{"boundary": bodyWriter.Boundary()})},
+	}
+
+	for _, header := range headers {
+		message.WriteString(header.name + ": " + header.value + "\r\n")
+	}
+	message.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=utf-8", textBody},
+		{"text/html; charset=utf-8", htmlBody},
+	} {
+		partWriter, err := bodyWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := quotedprintable.NewWriter(partWriter)
+		if _, err := encoder.Write(part.body); err != nil {
+			return nil, err
+		}
+
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := bodyWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return message.Bytes(), nil
+}
@@ -0,0 +1,41 @@
+package noteservice
+
+import (
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/bookservice"
+)
+
+// SetNoteBook changes which book a note is about. A bookId of 0 leaves the note without a book.
+// Only the author may do so, and only until the note is published.
+func SetNoteBook(userId models.UserId, noteId models.NoteId, bookId models.BookId) error {
+	if _, err := getNoteAuthoredByUser(userId, noteId); err != nil {
+		return err
+	}
+
+	if err := databaseutil.UpdateNoteBook(int64(noteId), convertBookIdToNullableInt(bookId)); err != nil {
+		switch err {
+		case databaseutil.NoteAlreadyPublishedError:
+			return NoteAlreadyPublishedError
+		case databaseutil.QueryResultContainedNoRowsError:
+			return NoteNotFoundError
+		case databaseutil.ForeignKeyConstraintError:
+			return bookservice.BookNotFoundError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// PRIVATE
+
+func convertBookIdToNullableInt(bookId models.BookId) *int64 {
+	if bookId == 0 {
+		return nil
+	}
+
+	bookIdAsInt := int64(bookId)
+	return &bookIdAsInt
+}
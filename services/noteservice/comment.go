@@ -0,0 +1,350 @@
+package noteservice
+
+import (
+	"errors"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+	"github.com/atmiguel/cerealnotes/services/notificationservice"
+)
+
+var CommentNotFoundError = errors.New("No comment exists with the given id on this note")
+
+var CommentNotAuthoredByUserError = errors.New("The comment was not written by this user")
+
+var NoteCommentingLockedError = errors.New("The author of the note has locked its comments")
+
+// CommentThread is the discussion of a note. Comments holds the comments that reply to no other,
+// oldest first, each with its replies nested inside it.
+type CommentThread struct {
+	Comments []*models.CommentWithId `json:"comments"`
+	IsLocked bool                    `json:"isLocked"`
+}
+
+// StoreNewComment comments on a published note the user can read and records whom the comment mentions.
+// A parentId other than 0 replies to an undeleted comment on the same note.
+// Nobody may comment once the note's author locked it. The authors of the note and of the comment
+// replied to are notified.
+func StoreNewComment(
+	userId models.UserId,
+	noteId models.NoteId,
+	parentId models.CommentId,
+	content string,
+) (models.CommentId, error) {
+	note, err := getPublishedNoteVisibleToUser(userId, noteId, true)
+	if err != nil {
+		return 0, err
+	}
+
+	if note.IsCommentingLocked {
+		return 0, NoteCommentingLockedError
+	}
+
+	var parentIdAsInt *int64
+	var parentAuthorId models.UserId
+	if parentId != 0 {
+		parentRow, err := getCommentRowOnNote(noteId, parentId)
+		if err != nil {
+			return 0, err
+		}
+
+		if parentRow.DeletionTime != nil {
+			return 0, CommentNotFoundError
+		}
+
+		parentIdAsInt = &parentRow.Id
+		parentAuthorId = models.UserId(parentRow.AuthorId)
+	}
+
+	commentId, err := databaseutil.InsertNoteComment(
+		int64(noteId),
+		parentIdAsInt,
+		int64(userId),
+		content,
+		time.Now().UTC())
+	if err != nil {
+		switch err {
+		case databaseutil.ForeignKeyConstraintError:
+			return 0, CommentNotFoundError
+		case databaseutil.NoteCommentingLockedError:
+			return 0, NoteCommentingLockedError
+		}
+
+		return 0, err
+	}
+
+	if err := recordMentions(userId, noteId, models.CommentId(commentId), content, true); err != nil {
+		return 0, err
+	}
+
+	if err := notifyAboutComment(userId, note, noteId, models.CommentId(commentId), parentAuthorId); err != nil {
+		return 0, err
+	}
+
+	return models.CommentId(commentId), nil
+}
+
+// GetCommentThreadVisibleToUser returns the discussion of a published note the user can read.
+// Unless revealSpoilers is set, NoteWithheldAsSpoilerError is returned for a note beyond
+// the user's reading progress. Removed comments that nobody visibly replied to are left out.
+func GetCommentThreadVisibleToUser(
+	userId models.UserId,
+	noteId models.NoteId,
+	revealSpoilers bool,
+) (*CommentThread, error) {
+	note, err := getPublishedNoteVisibleToUser(userId, noteId, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	if note.IsWithheld {
+		return nil, NoteWithheldAsSpoilerError
+	}
+
+	fellowMembersById, err := clubservice.GetFellowMembers(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	commentRows, err := databaseutil.GetNoteComments(int64(noteId))
+	if err != nil {
+		return nil, err
+	}
+
+	thread := &CommentThread{
+		Comments: make([]*models.CommentWithId, 0),
+		IsLocked: note.IsCommentingLocked,
+	}
+
+	// replies are stored after the comment they reply to, so parents come first
+	commentsById := make(map[models.CommentId]*models.CommentWithId, len(commentRows))
+	for _, commentRow := range commentRows {
+		comment := &models.CommentWithId{
+			Id:      models.CommentId(commentRow.Id),
+			Comment: convertCommentRowToComment(commentRow),
+		}
+
+		if _, ok := fellowMembersById[comment.AuthorId]; !ok || commentRow.DeletionTime != nil {
+			removeComment(comment.Comment)
+		}
+
+		commentsById[comment.Id] = comment
+
+		if comment.ParentId == 0 {
+			thread.Comments = append(thread.Comments, comment)
+			continue
+		}
+
+		parent := commentsById[comment.ParentId]
+		parent.Replies = append(parent.Replies, comment)
+	}
+
+	thread.Comments = pruneRemovedComments(thread.Comments)
+
+	return thread, nil
+}
+
+// UpdateCommentContent only succeeds for the author of a comment on a note whose comments are not locked.
+func UpdateCommentContent(
+	userId models.UserId,
+	noteId models.NoteId,
+	commentId models.CommentId,
+	content string,
+) error {
+	if _, err := getCommentAuthoredByUser(userId, noteId, commentId); err != nil {
+		return err
+	}
+
+	note, err := getPublishedNoteVisibleToUser(userId, noteId, true)
+	if err != nil {
+		return err
+	}
+
+	if note.IsCommentingLocked {
+		return NoteCommentingLockedError
+	}
+
+	if err := databaseutil.UpdateNoteCommentContent(int64(commentId), content, time.Now().UTC()); err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return CommentNotFoundError
+		}
+
+		return err
+	}
+
+	return recordMentions(userId, noteId, commentId, content, true)
+}
+
+// DeleteComment removes one of the user's comments. Its replies stay in the thread.
+func DeleteComment(userId models.UserId, noteId models.NoteId, commentId models.CommentId) error {
+	if _, err := getCommentAuthoredByUser(userId, noteId, commentId); err != nil {
+		return err
+	}
+
+	if err := databaseutil.MarkNoteCommentDeleted(int64(commentId), time.Now().UTC()); err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return CommentNotFoundError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// LockComments stops everyone from adding or editing comments on a note. Only the note's author may do so.
+func LockComments(userId models.UserId, noteId models.NoteId) error {
+	if _, err := getNoteAuthoredByUser(userId, noteId); err != nil {
+		return err
+	}
+
+	return databaseutil.InsertNoteCommentLock(int64(noteId), time.Now().UTC())
+}
+
+// UnlockComments reopens the discussion of a note. Only the note's author may do so.
+func UnlockComments(userId models.UserId, noteId models.NoteId) error {
+	if _, err := getNoteAuthoredByUser(userId, noteId); err != nil {
+		return err
+	}
+
+	return databaseutil.DeleteNoteCommentLock(int64(noteId))
+}
+
+// PRIVATE
+
+// getPublishedNoteVisibleToUser behaves like GetNoteVisibleToUser, but returns NoteNotPublishedError
+// for the user's own notes that nobody else can read yet.
+func getPublishedNoteVisibleToUser(
+	userId models.UserId,
+	noteId models.NoteId,
+	revealSpoilers bool,
+) (*models.Note, error) {
+	noteRow, err := getNoteRowVisibleToUser(userId, noteId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !noteRow.IsPublic {
+		return nil, NoteNotPublishedError
+	}
+
+	gate, err := newSpoilerGate(userId, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	note := convertNoteRowToNote(noteRow)
+	gate.redact(note)
+
+	return note, nil
+}
+
+// notifyAboutComment tells the author of the note about a comment on it, and the author of the comment
+// replied to, if any, about the reply. Nobody is notified about their own comment.
+func notifyAboutComment(
+	commenterId models.UserId,
+	note *models.Note,
+	noteId models.NoteId,
+	commentId models.CommentId,
+	parentAuthorId models.UserId,
+) error {
+	if note.AuthorId != commenterId {
+		if err := notificationservice.Notify([]models.UserId{note.AuthorId}, &models.CommentNotification{
+			Type:      models.NOTE_COMMENT,
+			NoteId:    noteId,
+			CommentId: commentId,
+			AuthorId:  commenterId,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if parentAuthorId != 0 && parentAuthorId != commenterId && parentAuthorId != note.AuthorId {
+		return notificationservice.Notify([]models.UserId{parentAuthorId}, &models.CommentNotification{
+			Type:      models.COMMENT_REPLY,
+			NoteId:    noteId,
+			CommentId: commentId,
+			AuthorId:  commenterId,
+		})
+	}
+
+	return nil
+}
+
+// getCommentRowOnNote returns CommentNotFoundError unless the comment exists and is on the note.
+func getCommentRowOnNote(noteId models.NoteId, commentId models.CommentId) (*databaseutil.NoteCommentRow, error) {
+	commentRow, err := databaseutil.GetNoteCommentById(int64(commentId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return nil, CommentNotFoundError
+		}
+
+		return nil, err
+	}
+
+	if models.NoteId(commentRow.NoteId) != noteId {
+		return nil, CommentNotFoundError
+	}
+
+	return commentRow, nil
+}
+
+// getCommentAuthoredByUser returns CommentNotAuthoredByUserError if the comment belongs to someone else.
+func getCommentAuthoredByUser(
+	userId models.UserId,
+	noteId models.NoteId,
+	commentId models.CommentId,
+) (*models.Comment, error) {
+	commentRow, err := getCommentRowOnNote(noteId, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if commentRow.DeletionTime != nil {
+		return nil, CommentNotFoundError
+	}
+
+	if models.UserId(commentRow.AuthorId) != userId {
+		return nil, CommentNotAuthoredByUserError
+	}
+
+	return convertCommentRowToComment(commentRow), nil
+}
+
+func convertCommentRowToComment(commentRow *databaseutil.NoteCommentRow) *models.Comment {
+	return &models.Comment{
+		NoteId:       models.NoteId(commentRow.NoteId),
+		ParentId:     models.CommentId(commentRow.ParentCommentId),
+		AuthorId:     models.UserId(commentRow.AuthorId),
+		Content:      commentRow.Content,
+		CreationTime: commentRow.CreationTime,
+		EditTime:     commentRow.EditTime,
+		Replies:      make([]*models.CommentWithId, 0),
+	}
+}
+
+func removeComment(comment *models.Comment) {
+	comment.AuthorId = 0
+	comment.Content = ""
+	comment.EditTime = nil
+	comment.IsRemoved = true
+}
+
+// pruneRemovedComments drops the removed comments left without any reply worth showing.
+func pruneRemovedComments(comments []*models.CommentWithId) []*models.CommentWithId {
+	prunedComments := make([]*models.CommentWithId, 0, len(comments))
+
+	for _, comment := range comments {
+		comment.Replies = pruneRemovedComments(comment.Replies)
+
+		if comment.IsRemoved && len(comment.Replies) == 0 {
+			continue
+		}
+
+		prunedComments = append(prunedComments, comment)
+	}
+
+	return prunedComments
+}
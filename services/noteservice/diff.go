@@ -0,0 +1,61 @@
+package noteservice
+
+import (
+	"strings"
+
+	"github.com/atmiguel/cerealnotes/models"
+)
+
+// computeLineDiff returns the shortest line-by-line edit script turning before into after,
+// based on the longest common subsequence of their lines.
+func computeLineDiff(before string, after string) []models.DiffLine {
+	beforeLines := strings.Split(before, "\n")
+	afterLines := strings.Split(after, "\n")
+
+	// commonLengths[i][j] is the length of the longest common subsequence of
+	// beforeLines[i:] and afterLines[j:].
+	commonLengths := make([][]int, len(beforeLines)+1)
+	for i := range commonLengths {
+		commonLengths[i] = make([]int, len(afterLines)+1)
+	}
+
+	for i := len(beforeLines) - 1; i >= 0; i-- {
+		for j := len(afterLines) - 1; j >= 0; j-- {
+			if beforeLines[i] == afterLines[j] {
+				commonLengths[i][j] = commonLengths[i+1][j+1] + 1
+			} else if commonLengths[i+1][j] >= commonLengths[i][j+1] {
+				commonLengths[i][j] = commonLengths[i+1][j]
+			} else {
+				commonLengths[i][j] = commonLengths[i][j+1]
+			}
+		}
+	}
+
+	diffLines := make([]models.DiffLine, 0, len(beforeLines)+len(afterLines))
+
+	i, j := 0, 0
+	for i < len(beforeLines) && j < len(afterLines) {
+		switch {
+		case beforeLines[i] == afterLines[j]:
+			diffLines = append(diffLines, models.DiffLine{Operation: models.DIFF_EQUAL, Text: beforeLines[i]})
+			i++
+			j++
+		case commonLengths[i+1][j] >= commonLengths[i][j+1]:
+			diffLines = append(diffLines, models.DiffLine{Operation: models.DIFF_DELETE, Text: beforeLines[i]})
+			i++
+		default:
+			diffLines = append(diffLines, models.DiffLine{Operation: models.DIFF_INSERT, Text: afterLines[j]})
+			j++
+		}
+	}
+
+	for ; i < len(beforeLines); i++ {
+		diffLines = append(diffLines, models.DiffLine{Operation: models.DIFF_DELETE, Text: beforeLines[i]})
+	}
+
+	for ; j < len(afterLines); j++ {
+		diffLines = append(diffLines, models.DiffLine{Operation: models.DIFF_INSERT, Text: afterLines[j]})
+	}
+
+	return diffLines
+}
@@ -0,0 +1,77 @@
+package noteservice
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/atmiguel/cerealnotes/models"
+)
+
+// formatDiff writes each line of a diff the way unified diffs do: "+" inserted, "-" deleted, " " unchanged.
+func formatDiff(diffLines []models.DiffLine) string {
+	prefixes := map[models.DiffOperation]string{
+		models.DIFF_EQUAL:  " ",
+		models.DIFF_INSERT: "+",
+		models.DIFF_DELETE: "-",
+	}
+
+	formattedLines := make([]string, 0, len(diffLines))
+	for _, diffLine := range diffLines {
+		formattedLines = append(formattedLines, prefixes[diffLine.Operation]+diffLine.Text)
+	}
+
+	return strings.Join(formattedLines, "\n")
+}
+
+func TestComputeLineDiff(t *testing.T) {
+	for before, afterToDiff := range map[string]map[string]string{
+		"a\nb\nc": {
+			"a\nb\nc":    " a\n b\n c",
+			"a\nc":       " a\n-b\n c",
+			"a\nb\nx\nc": " a\n b\n+x\n c",
+			"a\nx\nc":    " a\n-b\n+x\n c",
+			"c\na\nb":    "+c\n a\n b\n-c",
+			"a\nb\nc\n":  " a\n b\n c\n+",
+			"":           "-a\n-b\n-c\n+",
+		},
+		"": {
+			"":  " ",
+			"a": "-\n+a",
+		},
+		// repeated lines must not be matched out of order
+		"x\nx\ny": {
+			"x\ny\nx": " x\n-x\n y\n+x",
+			"y":       "-x\n-x\n y",
+		},
+	} {
+		for after, expectedDiff := range afterToDiff {
+			if diff := formatDiff(computeLineDiff(before, after)); diff != expectedDiff {
+				t.Errorf("computeLineDiff(%q, %q) =\n%s\nexpected\n%s", before, after, diff, expectedDiff)
+			}
+		}
+	}
+}
+
+func TestComputeLineDiffRebuildsBothSides(t *testing.T) {
+	before := "The ship sailed\nat dawn\nwith the crew\nasleep"
+	after := "At dawn\nthe ship sailed\nwith the crew\nawake\nand singing"
+
+	var rebuiltBefore, rebuiltAfter []string
+	for _, diffLine := range computeLineDiff(before, after) {
+		if diffLine.Operation != models.DIFF_INSERT {
+			rebuiltBefore = append(rebuiltBefore, diffLine.Text)
+		}
+
+		if diffLine.Operation != models.DIFF_DELETE {
+			rebuiltAfter = append(rebuiltAfter, diffLine.Text)
+		}
+	}
+
+	if strings.Join(rebuiltBefore, "\n") != before {
+		t.Errorf("the unchanged and deleted lines give %q, expected %q", rebuiltBefore, before)
+	}
+
+	if strings.Join(rebuiltAfter, "\n") != after {
+		t.Errorf("the unchanged and inserted lines give %q, expected %q", rebuiltAfter, after)
+	}
+}
@@ -0,0 +1,108 @@
+package noteservice
+
+import (
+	"errors"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/bookservice"
+)
+
+var NoteHasNoBookError = errors.New("The note is not about any book")
+
+var InvalidNoteLocationError = errors.New(
+	"A location needs a chapter of the book, a page of at least 1 or a percentage between 0 and 100")
+
+// SetNoteLocation anchors a note to a place in its book, replacing any location it already has.
+// Only the author may locate a note, and the note must be about a book.
+func SetNoteLocation(
+	userId models.UserId,
+	noteId models.NoteId,
+	location *models.Location,
+) error {
+	note, err := getNoteAuthoredByUser(userId, noteId)
+	if err != nil {
+		return err
+	}
+
+	if note.BookId == 0 {
+		return NoteHasNoBookError
+	}
+
+	book, err := bookservice.GetBookById(note.BookId)
+	if err != nil {
+		return err
+	}
+
+	if !bookservice.IsValidLocation(book, location) {
+		return InvalidNoteLocationError
+	}
+
+	return databaseutil.UpsertNoteLocation(
+		int64(noteId),
+		convertIntToNullableInt64(location.Chapter),
+		convertIntToNullableInt64(location.Page),
+		location.Percent)
+}
+
+// ClearNoteLocation leaves the note without a location. Only the author may clear it.
+func ClearNoteLocation(userId models.UserId, noteId models.NoteId) error {
+	if _, err := getNoteAuthoredByUser(userId, noteId); err != nil {
+		return err
+	}
+
+	return databaseutil.DeleteNoteLocation(int64(noteId))
+}
+
+// GetChapterNotesVisibleToUser returns every note about a chapter of a book that the user can read,
+// in reading order. Unless revealSpoilers is set, notes beyond the user's reading progress
+// come back redacted.
+func GetChapterNotesVisibleToUser(
+	userId models.UserId,
+	bookId models.BookId,
+	chapter int,
+	revealSpoilers bool,
+) ([]*models.NoteWithId, error) {
+	gate, err := newSpoilerGate(userId, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	bookIdAsInt := int64(bookId)
+	chapterAsInt := int64(chapter)
+
+	noteRows, err := databaseutil.GetNotesVisibleToUser(int64(userId), &databaseutil.NoteListingOptions{
+		BookId:         &bookIdAsInt,
+		MinChapter:     &chapterAsInt,
+		MaxChapter:     &chapterAsInt,
+		InReadingOrder: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]*models.NoteWithId, 0, len(noteRows))
+	for _, noteRow := range noteRows {
+		note := convertNoteRowToNote(noteRow)
+		gate.redact(note)
+
+		notes = append(notes, &models.NoteWithId{Id: models.NoteId(noteRow.Id), Note: note})
+	}
+
+	if err := attachReactionCountsToList(userId, notes); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// PRIVATE
+
+func convertIntToNullableInt64(value *int) *int64 {
+	if value == nil {
+		return nil
+	}
+
+	valueAsInt64 := int64(*value)
+	return &valueAsInt64
+}
@@ -0,0 +1,224 @@
+package noteservice
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+	"github.com/atmiguel/cerealnotes/services/notificationservice"
+)
+
+// MaxMentionCount caps how many of the most recent mentions are listed.
+const MaxMentionCount = 100
+
+// MentionsPage lists the mentions of a user along with the notes they were made in.
+// WithheldCount counts those notes that were redacted as spoilers.
+type MentionsPage struct {
+	Mentions      []*models.Mention
+	NotesById     NotesById
+	WithheldCount int
+}
+
+// GetMentionsOfUser returns the most recent mentions of the user in notes and comments the user can read,
+// newest first. A mention in a note only shows up once the note is published. Unless revealSpoilers is set,
+// notes beyond the user's reading progress come back redacted.
+func GetMentionsOfUser(userId models.UserId, revealSpoilers bool) (*MentionsPage, error) {
+	mentionRows, err := databaseutil.GetMentionsOfUser(int64(userId), MaxMentionCount)
+	if err != nil {
+		return nil, err
+	}
+
+	mentionsPage := &MentionsPage{Mentions: make([]*models.Mention, 0, len(mentionRows))}
+
+	noteIds := make([]int64, 0, len(mentionRows))
+	for _, mentionRow := range mentionRows {
+		mentionsPage.Mentions = append(mentionsPage.Mentions, &models.Mention{
+			NoteId:      models.NoteId(mentionRow.NoteId),
+			CommentId:   models.CommentId(mentionRow.CommentId),
+			MentionerId: models.UserId(mentionRow.MentionerId),
+			MentionTime: mentionRow.MentionTime,
+		})
+
+		noteIds = append(noteIds, mentionRow.NoteId)
+	}
+
+	noteRows, err := databaseutil.GetNotesByIds(noteIds)
+	if err != nil {
+		return nil, err
+	}
+
+	gate, err := newSpoilerGate(userId, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	mentionsPage.NotesById = convertNoteRowsToNotesById(noteRows)
+	for _, note := range mentionsPage.NotesById {
+		if gate.redact(note) {
+			mentionsPage.WithheldCount++
+		}
+	}
+
+	if err := attachReactionCounts(userId, mentionsPage.NotesById); err != nil {
+		return nil, err
+	}
+
+	return mentionsPage, nil
+}
+
+func (mentionsPage *MentionsPage) ToJson() ([]byte, error) {
+	type MentionsPageJson struct {
+		Mentions      []*models.Mention      `json:"mentions"`
+		NotesById     map[string]models.Note `json:"notesById"`
+		WithheldCount int                    `json:"withheldCount"`
+	}
+
+	return json.Marshal(&MentionsPageJson{
+		Mentions:      mentionsPage.Mentions,
+		NotesById:     mentionsPage.NotesById.toStringIndexedMap(),
+		WithheldCount: mentionsPage.WithheldCount,
+	})
+}
+
+// PRIVATE
+
+// recordMentions resolves the mentions in content written by the author against the members of the
+// author's clubs. A commentId of 0 stands for the content of the note itself.
+// Newly mentioned users are notified right away when isPublic is set, and otherwise once the note is published.
+func recordMentions(
+	authorId models.UserId,
+	noteId models.NoteId,
+	commentId models.CommentId,
+	content string,
+	isPublic bool,
+) error {
+	fellowMembersById, err := clubservice.GetFellowMembers(authorId)
+	if err != nil {
+		return err
+	}
+
+	delete(fellowMembersById, authorId)
+
+	mentionedUserIds := make([]int64, 0)
+	for _, mentionedUserId := range findMentionedUsers(content, fellowMembersById) {
+		mentionedUserIds = append(mentionedUserIds, int64(mentionedUserId))
+	}
+
+	var commentIdAsInt *int64
+	if commentId != 0 {
+		commentIdAsInt = new(int64)
+		*commentIdAsInt = int64(commentId)
+	}
+
+	mentionTime := time.Now().UTC()
+
+	newlyMentionedUserIds, err := databaseutil.ReplaceMentions(
+		int64(noteId),
+		commentIdAsInt,
+		mentionedUserIds,
+		mentionTime)
+	if err != nil {
+		return err
+	}
+
+	if !isPublic {
+		return nil
+	}
+
+	recipientIds := make([]models.UserId, 0, len(newlyMentionedUserIds))
+	for _, newlyMentionedUserId := range newlyMentionedUserIds {
+		recipientIds = append(recipientIds, models.UserId(newlyMentionedUserId))
+	}
+
+	return notificationservice.Notify(recipientIds, &models.MentionNotification{Mention: models.Mention{
+		NoteId:      noteId,
+		CommentId:   commentId,
+		MentionerId: authorId,
+		MentionTime: mentionTime,
+	}})
+}
+
+// findMentionedUsers returns the users named with an @ in the content, each once, in the order they are
+// first named. A mention names the user with the longest display name it starts with, ignoring case,
+// or failing that the only user whose display name starts with the mentioned first name.
+// Mentions that fit several users equally well name nobody.
+func findMentionedUsers(content string, usersById map[models.UserId]*models.User) []models.UserId {
+	mentionedUserIds := make([]models.UserId, 0)
+	isMentioned := make(map[models.UserId]bool)
+
+	for i := strings.IndexRune(content, '@'); i >= 0; {
+		if previousRune, _ := utf8.DecodeLastRuneInString(content[:i]); i == 0 || !isNameRune(previousRune) {
+			if userId, ok := matchMention(strings.ToLower(content[i+1:]), usersById); ok && !isMentioned[userId] {
+				mentionedUserIds = append(mentionedUserIds, userId)
+				isMentioned[userId] = true
+			}
+		}
+
+		next := strings.IndexRune(content[i+1:], '@')
+		if next < 0 {
+			break
+		}
+
+		i += 1 + next
+	}
+
+	return mentionedUserIds
+}
+
+// matchMention finds the user named at the start of text, which is already lowercase.
+func matchMention(text string, usersById map[models.UserId]*models.User) (models.UserId, bool) {
+	if userId, ok := matchUniqueName(text, usersById, func(user *models.User) string {
+		return user.DisplayName
+	}); ok {
+		return userId, true
+	}
+
+	return matchUniqueName(text, usersById, func(user *models.User) string {
+		if names := strings.Fields(user.DisplayName); len(names) > 0 {
+			return names[0]
+		}
+
+		return ""
+	})
+}
+
+func matchUniqueName(
+	text string,
+	usersById map[models.UserId]*models.User,
+	nameOf func(user *models.User) string,
+) (models.UserId, bool) {
+	var matchedUserId models.UserId
+	longestMatch := 0
+	isAmbiguous := false
+
+	for userId, user := range usersById {
+		name := strings.ToLower(nameOf(user))
+		if len(name) == 0 || len(name) < longestMatch || !strings.HasPrefix(text, name) {
+			continue
+		}
+
+		if nextRune, _ := utf8.DecodeRuneInString(text[len(name):]); len(text) > len(name) && isNameRune(nextRune) {
+			continue
+		}
+
+		if len(name) == longestMatch {
+			isAmbiguous = true
+			continue
+		}
+
+		matchedUserId = userId
+		longestMatch = len(name)
+		isAmbiguous = false
+	}
+
+	return matchedUserId, longestMatch > 0 && !isAmbiguous
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,99 @@
+package noteservice
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/atmiguel/cerealnotes/models"
+)
+
+func usersNamed(displayNames ...string) map[models.UserId]*models.User {
+	usersById := make(map[models.UserId]*models.User, len(displayNames))
+	for i, displayName := range displayNames {
+		usersById[models.UserId(i+1)] = &models.User{DisplayName: displayName}
+	}
+
+	return usersById
+}
+
+func expectMentions(t *testing.T, content string, usersById map[models.UserId]*models.User, expected ...models.UserId) {
+	t.Helper()
+
+	if expected == nil {
+		expected = []models.UserId{}
+	}
+
+	if mentionedUserIds := findMentionedUsers(content, usersById); !reflect.DeepEqual(mentionedUserIds, expected) {
+		t.Errorf("findMentionedUsers(%q) = %v, expected %v", content, mentionedUserIds, expected)
+	}
+}
+
+func TestMentionPrefersTheLongestDisplayName(t *testing.T) {
+	usersById := usersNamed("Ada Lovelace", "Ada")
+
+	expectMentions(t, "ask @Ada Lovelace", usersById, 1)
+	expectMentions(t, "ask @ada", usersById, 2)
+
+	// "Ada Lovelace" does not end where the mention does, so only "Ada" is left
+	expectMentions(t, "@ada lovelaces", usersById, 2)
+}
+
+func TestMentionFallsBackToAUniqueFirstName(t *testing.T) {
+	usersById := usersNamed("Grace Hopper", "Linus Pauling", "Linus Torvalds")
+
+	expectMentions(t, "@grace, what do you think?", usersById, 1)
+	expectMentions(t, "@grace's notes", usersById, 1)
+	expectMentions(t, "@linus", usersById)
+	expectMentions(t, "@Linus Torvalds", usersById, 3)
+}
+
+func TestMentionOfTwoUsersWithTheSameNameNamesNobody(t *testing.T) {
+	expectMentions(t, "@Sam Smith", usersNamed("Sam Smith", "Sam Smith"))
+}
+
+func TestMentionMustEndWhereTheNameDoes(t *testing.T) {
+	usersById := usersNamed("Grace Hopper", "Ada")
+
+	expectMentions(t, "@gracehopper", usersById)
+	expectMentions(t, "@ada2", usersById)
+	expectMentions(t, "@ada!", usersById, 2)
+}
+
+func TestMentionNeedsAnAtThatStartsAWord(t *testing.T) {
+	usersById := usersNamed("Grace Hopper")
+
+	expectMentions(t, "write to ada@grace instead", usersById)
+	expectMentions(t, "@@grace", usersById, 1)
+	expectMentions(t, "(@grace)", usersById, 1)
+	expectMentions(t, "trailing @", usersById)
+}
+
+func TestMentionIgnoresCaseBeyondAscii(t *testing.T) {
+	expectMentions(t, "thanks @ÉMILIE", usersNamed("Émilie du Châtelet"), 1)
+}
+
+func TestMentionedUsersComeOnceInTheOrderFirstNamed(t *testing.T) {
+	usersById := usersNamed("Ada Lovelace", "Grace Hopper")
+
+	expectMentions(t, "@grace, then @Ada Lovelace, then @Grace Hopper again", usersById, 2, 1)
+}
+
+func TestUserWithoutADisplayNameIsNeverMentioned(t *testing.T) {
+	expectMentions(t, "@ and @anyone", usersNamed(""))
+}
+
+func TestMatchMentionOnlyLooksAtTheStartOfTheText(t *testing.T) {
+	usersById := usersNamed("Ada")
+
+	if _, ok := matchMention("hello ada", usersById); ok {
+		t.Error("matched a name in the middle of the text")
+	}
+
+	if userId, ok := matchMention("ada", usersById); !ok || userId != 1 {
+		t.Errorf("matchMention(\"ada\") = (%d, %t), expected (1, true)", userId, ok)
+	}
+
+	if _, ok := matchMention("", usersById); ok {
+		t.Error("matched empty text")
+	}
+}
@@ -4,39 +4,460 @@ Package noteservice handles interactions with database layer.
 package noteservice
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/atmiguel/cerealnotes/databaseutil"
 	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/bookservice"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
 )
 
+var NoteNotFoundError = errors.New("No note exists with the given id")
+
+var NoteNotAuthoredByUserError = errors.New("The note was not written by this user")
+
+var NoteAlreadyPublishedError = errors.New("The note has already been published and can no longer change")
+
+var NoteNotPublishedError = errors.New("Only published notes can be discussed")
+
+var CategoryNotAvailableError = errors.New("The category is neither a default one nor one of the author's clubs'")
+
+// StoreNewNote also records the members of the author's clubs that the note mentions.
 func StoreNewNote(
 	note *models.Note,
 ) (models.NoteId, error) {
 
-	id, err := databaseutil.InsertNewNote(int64(note.AuthorId), note.Content, note.CreationTime)
+	id, err := databaseutil.InsertNewNote(
+		int64(note.AuthorId),
+		convertBookIdToNullableInt(note.BookId),
+		note.Content,
+		note.CreationTime)
 	if err != nil {
+		if err == databaseutil.ForeignKeyConstraintError {
+			return models.NoteId(0), bookservice.BookNotFoundError
+		}
+
+		return models.NoteId(0), err
+	}
+
+	if err := recordMentions(note.AuthorId, models.NoteId(id), 0, note.Content, false); err != nil {
 		return models.NoteId(0), err
 	}
 
 	return models.NoteId(id), nil
 }
 
-func StoreNewNoteCategoryRelationship(
+// SetNoteCategory replaces any category the note already has. Only the author may categorize a note;
+// to anyone else, the note does not exist. The category must be a default one or one of the author's clubs'.
+func SetNoteCategory(
+	userId models.UserId,
 	noteId models.NoteId,
 	category models.Category,
 ) error {
-	if err := databaseutil.InsertNoteCategoryRelationship(int64(noteId), category.String()); err != nil {
+	if _, err := getOwnNote(userId, noteId); err != nil {
+		return err
+	}
+
+	isAvailable, err := databaseutil.IsCategoryAvailableToUser(int64(category), int64(userId))
+	if err != nil {
+		return err
+	}
+
+	if !isAvailable {
+		return CategoryNotAvailableError
+	}
+
+	return databaseutil.UpsertNoteCategoryRelationship(int64(noteId), int64(category))
+}
+
+// ClearNoteCategory leaves the note uncategorized. Only the author may clear a note's category;
+// to anyone else, the note does not exist.
+func ClearNoteCategory(userId models.UserId, noteId models.NoteId) error {
+	if _, err := getOwnNote(userId, noteId); err != nil {
+		return err
+	}
+
+	return databaseutil.DeleteNoteCategoryRelationship(int64(noteId))
+}
+
+const DefaultNotePageSize = 50
+
+// MaxNotePageSize caps how many notes a single page may hold, whatever the caller asks for.
+const MaxNotePageSize = 100
+
+var InvalidNoteCursorError = errors.New("The note cursor is malformed")
+
+// NoteFilter narrows down a note listing. Nil fields do not filter anything.
+// The location ranges are inclusive and leave out notes whose location lacks that field.
+// InReadingOrder lists notes by their location in the book instead of newest first.
+// RevealSpoilers includes the content of notes beyond the user's reading progress.
+type NoteFilter struct {
+	AuthorId      *models.UserId
+	BookId        *models.BookId
+	Category      *models.Category
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	IsPublished   *bool
+	Tag           *string
+	IsAnswered    *bool
+
+	MinChapter *int
+	MaxChapter *int
+	MinPage    *int
+	MaxPage    *int
+	MinPercent *float64
+	MaxPercent *float64
+
+	InReadingOrder bool
+	RevealSpoilers bool
+}
+
+// NotesPage is one page of a note listing. NoteIds holds the order of the page.
+// NextCursor is empty on the last page. WithheldCount counts the notes on the page
+// that were redacted as spoilers.
+type NotesPage struct {
+	NotesById     NotesById
+	NoteIds       []models.NoteId
+	NextCursor    string
+	WithheldCount int
+}
+
+// GetNotesVisibleToUser returns one page of the user's own notes plus the notes by other authors
+// whose publication has gone live, newest first unless the filter asks for reading order.
+// An empty cursor starts from the first note.
+func GetNotesVisibleToUser(
+	userId models.UserId,
+	filter *NoteFilter,
+	cursor string,
+	pageSize int,
+) (*NotesPage, error) {
+	if pageSize > MaxNotePageSize {
+		pageSize = MaxNotePageSize
+	}
+
+	options := &databaseutil.NoteListingOptions{
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+		IsPublished:   filter.IsPublished,
+		IsAnswered:    filter.IsAnswered,
+		MinPercent:    filter.MinPercent,
+		MaxPercent:    filter.MaxPercent,
+
+		QuestionCategoryId: int64(models.QUESTIONS),
+
+		InReadingOrder: filter.InReadingOrder,
+		// fetch one extra note to learn whether another page follows
+		Limit: pageSize + 1,
+	}
+
+	options.MinChapter = convertIntToNullableInt64(filter.MinChapter)
+	options.MaxChapter = convertIntToNullableInt64(filter.MaxChapter)
+	options.MinPage = convertIntToNullableInt64(filter.MinPage)
+	options.MaxPage = convertIntToNullableInt64(filter.MaxPage)
+
+	if filter.AuthorId != nil {
+		authorId := int64(*filter.AuthorId)
+		options.AuthorId = &authorId
+	}
+
+	if filter.BookId != nil {
+		bookId := int64(*filter.BookId)
+		options.BookId = &bookId
+	}
+
+	if filter.Category != nil {
+		categoryId := int64(*filter.Category)
+		options.CategoryId = &categoryId
+	}
+
+	if filter.Tag != nil {
+		normalizedTag, err := NormalizeTag(*filter.Tag)
+		if err != nil {
+			return nil, err
+		}
+
+		options.TagName = &normalizedTag
+	}
+
+	if len(cursor) > 0 {
+		if err := decodeNoteCursor(cursor, options); err != nil {
+			return nil, err
+		}
+	}
+
+	gate, err := newSpoilerGate(userId, filter.RevealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	noteRows, err := databaseutil.GetNotesVisibleToUser(int64(userId), options)
+	if err != nil {
+		return nil, err
+	}
+
+	notesPage := &NotesPage{}
+
+	if len(noteRows) > pageSize {
+		noteRows = noteRows[:pageSize]
+
+		notesPage.NextCursor = encodeNoteCursor(noteRows[len(noteRows)-1], filter.InReadingOrder)
+	}
+
+	notesPage.NotesById = convertNoteRowsToNotesById(noteRows)
+	notesPage.NoteIds = make([]models.NoteId, 0, len(noteRows))
+	for _, noteRow := range noteRows {
+		noteId := models.NoteId(noteRow.Id)
+
+		if gate.redact(notesPage.NotesById[noteId]) {
+			notesPage.WithheldCount++
+		}
+
+		notesPage.NoteIds = append(notesPage.NoteIds, noteId)
+	}
+
+	if err := attachReactionCounts(userId, notesPage.NotesById); err != nil {
+		return nil, err
+	}
+
+	return notesPage, nil
+}
+
+func (notesPage *NotesPage) ToJson() ([]byte, error) {
+	type NotesPageJson struct {
+		NotesById     map[string]models.Note `json:"notesById"`
+		NoteIds       []models.NoteId        `json:"noteIds"`
+		NextCursor    string                 `json:"nextCursor,omitempty"`
+		WithheldCount int                    `json:"withheldCount"`
+	}
+
+	return json.Marshal(&NotesPageJson{
+		NotesById:     notesPage.NotesById.toStringIndexedMap(),
+		NoteIds:       notesPage.NoteIds,
+		NextCursor:    notesPage.NextCursor,
+		WithheldCount: notesPage.WithheldCount,
+	})
+}
+
+// GetNoteById returns NoteNotFoundError if no such note exists.
+func GetNoteById(noteId models.NoteId) (*models.Note, error) {
+	noteRow, err := databaseutil.GetNoteById(int64(noteId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return nil, NoteNotFoundError
+		}
+
+		return nil, err
+	}
+
+	return convertNoteRowToNote(noteRow), nil
+}
+
+// GetNoteVisibleToUser behaves like GetNoteById, but also returns NoteNotFoundError
+// for notes the user is not allowed to read: unpublished notes of others, and the notes of
+// anyone who shares no club with the user. Unless revealSpoilers is set, a note beyond
+// the user's reading progress comes back redacted.
+func GetNoteVisibleToUser(
+	userId models.UserId,
+	noteId models.NoteId,
+	revealSpoilers bool,
+) (*models.Note, error) {
+	noteRow, err := getNoteRowVisibleToUser(userId, noteId)
+	if err != nil {
+		return nil, err
+	}
+
+	gate, err := newSpoilerGate(userId, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	note := convertNoteRowToNote(noteRow)
+	gate.redact(note)
+
+	if err := attachReactionCounts(userId, NotesById{noteId: note}); err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+// UpdateNoteContent only succeeds for the author of a note that has not been published yet.
+// The mentions of the note are recorded anew from the new content.
+func UpdateNoteContent(
+	userId models.UserId,
+	noteId models.NoteId,
+	content string,
+) error {
+	if _, err := getNoteAuthoredByUser(userId, noteId); err != nil {
+		return err
+	}
+
+	if err := databaseutil.UpdateNoteContent(int64(noteId), content, time.Now().UTC()); err != nil {
+		if err == databaseutil.NoteAlreadyPublishedError {
+			return NoteAlreadyPublishedError
+		}
+
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return NoteNotFoundError
+		}
+
+		return err
+	}
+
+	return recordMentions(userId, noteId, 0, content, false)
+}
+
+// GetNoteRevisionsVisibleToUser returns the revisions of a note oldest first,
+// each one diffed against the revision before it. Unless revealSpoilers is set,
+// NoteWithheldAsSpoilerError is returned for a note beyond the user's reading progress.
+func GetNoteRevisionsVisibleToUser(
+	userId models.UserId,
+	noteId models.NoteId,
+	revealSpoilers bool,
+) ([]*models.NoteRevision, error) {
+	note, err := GetNoteVisibleToUser(userId, noteId, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	if note.IsWithheld {
+		return nil, NoteWithheldAsSpoilerError
+	}
+
+	revisionRows, err := databaseutil.GetNoteRevisions(int64(noteId))
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*models.NoteRevision, 0, len(revisionRows))
+	for i, revisionRow := range revisionRows {
+		revision := &models.NoteRevision{
+			Content:      revisionRow.Content,
+			CreationTime: revisionRow.CreationTime,
+		}
+
+		if i > 0 {
+			revision.Diff = computeLineDiff(revisionRows[i-1].Content, revisionRow.Content)
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+// DeleteNote moves one of the user's notes to their trash. Published notes stay where readers saw them
+// unless their publication is retracted first.
+func DeleteNote(userId models.UserId, noteId models.NoteId) error {
+	if _, err := getNoteAuthoredByUser(userId, noteId); err != nil {
+		return err
+	}
+
+	if err := databaseutil.MarkNoteDeleted(int64(noteId), time.Now().UTC()); err != nil {
+		if err == databaseutil.NoteAlreadyPublishedError {
+			return NoteAlreadyPublishedError
+		}
+
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return NoteNotFoundError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetDeletedNotesByAuthor returns the notes in the user's trash.
+func GetDeletedNotesByAuthor(userId models.UserId) (NotesById, error) {
+	noteRows, err := databaseutil.GetDeletedNotesByAuthor(int64(userId))
+	if err != nil {
+		return nil, err
+	}
+
+	notesById := convertNoteRowsToNotesById(noteRows)
+
+	if err := attachReactionCounts(userId, notesById); err != nil {
+		return nil, err
+	}
+
+	return notesById, nil
+}
+
+// RestoreDeletedNote returns NoteNotFoundError unless the note is in the user's trash.
+func RestoreDeletedNote(userId models.UserId, noteId models.NoteId) error {
+	if err := databaseutil.RestoreDeletedNote(int64(noteId), int64(userId)); err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return NoteNotFoundError
+		}
+
 		return err
 	}
 
 	return nil
 }
 
+// PurgeNotesDeletedBefore permanently removes notes that have been in the trash since before the cutoff.
+func PurgeNotesDeletedBefore(cutoffTime time.Time) (int64, error) {
+	return databaseutil.PurgeNotesDeletedBefore(cutoffTime)
+}
+
+// GetNotesByPublication returns the notes of each of the publications, oldest first.
+// Unless revealSpoilers is set, notes beyond the viewer's reading progress come back redacted.
+func GetNotesByPublication(
+	viewerId models.UserId,
+	publicationIds []models.PublicationId,
+	revealSpoilers bool,
+) (map[models.PublicationId][]*models.NoteWithId, error) {
+	gate, err := newSpoilerGate(viewerId, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	publicationIdsAsInts := make([]int64, 0, len(publicationIds))
+	for _, publicationId := range publicationIds {
+		publicationIdsAsInts = append(publicationIdsAsInts, int64(publicationId))
+	}
+
+	noteRows, err := databaseutil.GetNotesInPublications(publicationIdsAsInts)
+	if err != nil {
+		return nil, err
+	}
+
+	notesById := make(NotesById, len(noteRows))
+	notesByPublication := make(map[models.PublicationId][]*models.NoteWithId, len(publicationIds))
+	for _, noteRow := range noteRows {
+		publicationId := models.PublicationId(noteRow.PublicationId)
+
+		note := convertNoteRowToNote(noteRow)
+		gate.redact(note)
+
+		notesById[models.NoteId(noteRow.Id)] = note
+		notesByPublication[publicationId] = append(
+			notesByPublication[publicationId],
+			&models.NoteWithId{Id: models.NoteId(noteRow.Id), Note: note})
+	}
+
+	if err := attachReactionCounts(viewerId, notesById); err != nil {
+		return nil, err
+	}
+
+	return notesByPublication, nil
+}
+
 type NotesById map[models.NoteId]*models.Note
 
 func (notesById NotesById) ToJson() ([]byte, error) {
+	return json.Marshal(notesById.toStringIndexedMap())
+}
+
+func (notesById NotesById) toStringIndexedMap() map[string]models.Note {
 	// json doesn't support int indexed maps
 	notesByIdString := make(map[string]models.Note, len(notesById))
 
@@ -44,5 +465,225 @@ func (notesById NotesById) ToJson() ([]byte, error) {
 		notesByIdString[fmt.Sprint(id)] = *note
 	}
 
-	return json.Marshal(notesByIdString)
+	return notesByIdString
+}
+
+// PRIVATE
+
+// getNoteRowVisibleToUser returns NoteNotFoundError for notes the user is not allowed to read.
+func getNoteRowVisibleToUser(userId models.UserId, noteId models.NoteId) (*databaseutil.NoteRow, error) {
+	noteRow, err := databaseutil.GetNoteById(int64(noteId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return nil, NoteNotFoundError
+		}
+
+		return nil, err
+	}
+
+	if authorId := models.UserId(noteRow.AuthorId); authorId != userId {
+		if !noteRow.IsPublic {
+			return nil, NoteNotFoundError
+		}
+
+		doShareClub, err := clubservice.DoUsersShareClub(userId, authorId)
+		if err != nil {
+			return nil, err
+		}
+
+		if !doShareClub {
+			return nil, NoteNotFoundError
+		}
+	}
+
+	return noteRow, nil
+}
+
+// getNoteAuthoredByUser returns NoteNotAuthoredByUserError if the note exists but belongs to someone else.
+func getNoteAuthoredByUser(userId models.UserId, noteId models.NoteId) (*models.Note, error) {
+	note, err := GetNoteById(noteId)
+	if err != nil {
+		return nil, err
+	}
+
+	if note.AuthorId != userId {
+		return nil, NoteNotAuthoredByUserError
+	}
+
+	return note, nil
+}
+
+// getOwnNote behaves like getNoteAuthoredByUser, but reports the notes of other authors as NoteNotFoundError
+// so that it gives away nothing about them.
+func getOwnNote(userId models.UserId, noteId models.NoteId) (*models.Note, error) {
+	note, err := getNoteAuthoredByUser(userId, noteId)
+	if err == NoteNotAuthoredByUserError {
+		return nil, NoteNotFoundError
+	}
+
+	return note, err
+}
+
+// encodeNoteCursor hides the sort key of the last note on a page behind an opaque string.
+// The key is (creation time, id), preceded by the note's chapter, page and percent in reading order.
+func encodeNoteCursor(noteRow *databaseutil.NoteRow, inReadingOrder bool) string {
+	cursor := fmt.Sprintf("%s|%d", noteRow.CreationTime.Format(time.RFC3339Nano), noteRow.Id)
+
+	if inReadingOrder {
+		locationParts := make([]string, 0, 3)
+
+		for _, locationValue := range []*int64{noteRow.LocationChapter, noteRow.LocationPage} {
+			if locationValue == nil {
+				locationParts = append(locationParts, "")
+			} else {
+				locationParts = append(locationParts, strconv.FormatInt(*locationValue, 10))
+			}
+		}
+
+		if noteRow.LocationPercent == nil {
+			locationParts = append(locationParts, "")
+		} else {
+			locationParts = append(locationParts, strconv.FormatFloat(*noteRow.LocationPercent, 'g', -1, 64))
+		}
+
+		cursor = strings.Join(locationParts, "|") + "|" + cursor
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+// decodeNoteCursor fills in the cursor fields of the options. A cursor made for the other sort order
+// is rejected with InvalidNoteCursorError.
+func decodeNoteCursor(cursor string, options *databaseutil.NoteListingOptions) error {
+	decodedCursor, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return InvalidNoteCursorError
+	}
+
+	cursorParts := strings.Split(string(decodedCursor), "|")
+
+	if options.InReadingOrder {
+		if len(cursorParts) != 5 {
+			return InvalidNoteCursorError
+		}
+
+		for i, destination := range []**int64{&options.CursorChapter, &options.CursorPage} {
+			if len(cursorParts[i]) == 0 {
+				continue
+			}
+
+			locationValue, err := strconv.ParseInt(cursorParts[i], 10, 64)
+			if err != nil {
+				return InvalidNoteCursorError
+			}
+
+			*destination = &locationValue
+		}
+
+		if len(cursorParts[2]) > 0 {
+			percent, err := strconv.ParseFloat(cursorParts[2], 64)
+			if err != nil {
+				return InvalidNoteCursorError
+			}
+
+			options.CursorPercent = &percent
+		}
+
+		cursorParts = cursorParts[3:]
+	}
+
+	if len(cursorParts) != 2 {
+		return InvalidNoteCursorError
+	}
+
+	creationTime, err := time.Parse(time.RFC3339Nano, cursorParts[0])
+	if err != nil {
+		return InvalidNoteCursorError
+	}
+
+	noteId, err := strconv.ParseInt(cursorParts[1], 10, 64)
+	if err != nil {
+		return InvalidNoteCursorError
+	}
+
+	options.CursorCreationTime = &creationTime
+	options.CursorId = noteId
+
+	return nil
+}
+
+func convertNoteRowsToNotesById(noteRows []*databaseutil.NoteRow) NotesById {
+	notesById := make(NotesById, len(noteRows))
+
+	for _, noteRow := range noteRows {
+		notesById[models.NoteId(noteRow.Id)] = convertNoteRowToNote(noteRow)
+	}
+
+	return notesById
+}
+
+func convertNoteRowToNote(noteRow *databaseutil.NoteRow) *models.Note {
+	note := &models.Note{
+		AuthorId:        models.UserId(noteRow.AuthorId),
+		Content:         noteRow.Content,
+		CreationTime:    noteRow.CreationTime,
+		BookId:          models.BookId(noteRow.BookId),
+		PublicationId:   models.PublicationId(noteRow.PublicationId),
+		PublicationTime: noteRow.PublicationTime,
+		DeletionTime:    noteRow.DeletionTime,
+		Tags:            noteRow.Tags,
+
+		CommentCount:       noteRow.CommentCount,
+		IsCommentingLocked: noteRow.IsCommentingLocked,
+	}
+
+	if noteRow.CategoryId != 0 {
+		note.Category = &models.NoteCategory{
+			Id:        models.Category(noteRow.CategoryId),
+			Name:      noteRow.CategoryName,
+			SortOrder: noteRow.CategorySortOrder,
+		}
+	}
+
+	if noteRow.LocationChapter != nil || noteRow.LocationPage != nil || noteRow.LocationPercent != nil {
+		note.Location = &models.Location{Percent: noteRow.LocationPercent}
+
+		if noteRow.LocationChapter != nil {
+			chapter := int(*noteRow.LocationChapter)
+			note.Location.Chapter = &chapter
+		}
+
+		if noteRow.LocationPage != nil {
+			page := int(*noteRow.LocationPage)
+			note.Location.Page = &page
+		}
+	}
+
+	if noteRow.QuestionId != 0 {
+		note.QuestionId = models.NoteId(noteRow.QuestionId)
+	}
+
+	if note.Category != nil && note.Category.Id == models.QUESTIONS {
+		note.Question = &models.Question{
+			AnswerCount:      noteRow.AnswerCount,
+			AcceptedAnswerId: models.NoteId(noteRow.AcceptedAnswerId),
+		}
+	}
+
+	if noteRow.PredictionConfidence != nil || noteRow.PredictionOutcome != nil {
+		note.Prediction = new(models.Prediction)
+
+		if noteRow.PredictionConfidence != nil {
+			confidence := int(*noteRow.PredictionConfidence)
+			note.Prediction.Confidence = &confidence
+		}
+
+		if noteRow.PredictionOutcome != nil {
+			// the database only stores valid outcomes
+			outcome, _ := models.DeserializePredictionOutcome(*noteRow.PredictionOutcome)
+			note.Prediction.Outcome = &outcome
+		}
+	}
+
+	return note
 }
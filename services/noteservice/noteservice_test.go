@@ -0,0 +1,167 @@
+package noteservice
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+)
+
+// decodeInto decodes a cursor the way GetNotesVisibleToUser does for a listing in the given order.
+func decodeInto(t *testing.T, cursor string, inReadingOrder bool) *databaseutil.NoteListingOptions {
+	options := &databaseutil.NoteListingOptions{InReadingOrder: inReadingOrder}
+	if err := decodeNoteCursor(cursor, options); err != nil {
+		t.Fatalf("decodeNoteCursor(%q) returned %v", cursor, err)
+	}
+
+	return options
+}
+
+func TestNoteCursorKeepsCreationTimeToTheNanosecond(t *testing.T) {
+	// Postgres keeps microseconds, but a cursor must not lose anything the database handed it.
+	creationTime := time.Date(2018, time.March, 4, 15, 16, 17, 123456789, time.UTC)
+
+	options := decodeInto(t, encodeNoteCursor(&databaseutil.NoteRow{Id: 42, CreationTime: creationTime}, false), false)
+
+	if !options.CursorCreationTime.Equal(creationTime) || options.CursorId != 42 {
+		t.Errorf("decoded (%v, %d), expected (%v, 42)", options.CursorCreationTime, options.CursorId, creationTime)
+	}
+}
+
+func TestNoteCursorKeepsTheInstantOfOtherTimeZones(t *testing.T) {
+	creationTime := time.Date(2018, time.March, 4, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*60*60))
+
+	options := decodeInto(t, encodeNoteCursor(&databaseutil.NoteRow{Id: 1, CreationTime: creationTime}, false), false)
+
+	if !options.CursorCreationTime.Equal(creationTime) {
+		t.Errorf("decoded %v, expected the same instant as %v", options.CursorCreationTime, creationTime)
+	}
+}
+
+func TestNoteCursorIsUrlSafe(t *testing.T) {
+	percent := 99.25
+	noteRow := &databaseutil.NoteRow{Id: 1 << 62, CreationTime: time.Now(), LocationPercent: &percent}
+
+	for _, cursor := range []string{encodeNoteCursor(noteRow, false), encodeNoteCursor(noteRow, true)} {
+		for _, r := range cursor {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				t.Fatalf("cursor %q holds %q, which would need escaping in a query string", cursor, r)
+			}
+		}
+	}
+}
+
+func TestNewestFirstCursorLeavesOutTheLocation(t *testing.T) {
+	chapter := int64(3)
+	noteRow := &databaseutil.NoteRow{Id: 5, CreationTime: time.Now(), LocationChapter: &chapter}
+
+	options := decodeInto(t, encodeNoteCursor(noteRow, false), false)
+
+	if options.CursorChapter != nil || options.CursorPage != nil || options.CursorPercent != nil {
+		t.Errorf("a newest first cursor carried the location (%v, %v, %v)",
+			options.CursorChapter, options.CursorPage, options.CursorPercent)
+	}
+}
+
+func TestReadingOrderCursorPrefixesChapterPageAndPercent(t *testing.T) {
+	chapter, page, percent := int64(12), int64(0), 37.5
+	creationTime := time.Date(2018, time.March, 4, 15, 16, 17, 0, time.UTC)
+
+	cursor := encodeNoteCursor(&databaseutil.NoteRow{
+		Id:              7,
+		CreationTime:    creationTime,
+		LocationChapter: &chapter,
+		LocationPage:    &page,
+		LocationPercent: &percent,
+	}, true)
+
+	decodedCursor, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "12|0|37.5|2018-03-04T15:16:17Z|7"; string(decodedCursor) != expected {
+		t.Errorf("cursor holds %q, expected %q", decodedCursor, expected)
+	}
+
+	options := decodeInto(t, cursor, true)
+
+	// page 0 is a real page, not a missing one
+	if options.CursorChapter == nil || *options.CursorChapter != 12 ||
+		options.CursorPage == nil || *options.CursorPage != 0 ||
+		options.CursorPercent == nil || *options.CursorPercent != 37.5 {
+		t.Errorf("decoded the location (%v, %v, %v), expected (12, 0, 37.5)",
+			options.CursorChapter, options.CursorPage, options.CursorPercent)
+	}
+
+	if !options.CursorCreationTime.Equal(creationTime) || options.CursorId != 7 {
+		t.Errorf("decoded (%v, %d), expected (%v, 7)", options.CursorCreationTime, options.CursorId, creationTime)
+	}
+}
+
+func TestReadingOrderCursorKeepsUnknownLocationPartsNil(t *testing.T) {
+	page := int64(88)
+	cursor := encodeNoteCursor(&databaseutil.NoteRow{Id: 7, CreationTime: time.Now(), LocationPage: &page}, true)
+
+	decodedCursor, _ := base64.RawURLEncoding.DecodeString(cursor)
+	if !strings.HasPrefix(string(decodedCursor), "|88||") {
+		t.Errorf("cursor holds %q, expected an empty chapter, page 88 and an empty percent", decodedCursor)
+	}
+
+	options := decodeInto(t, cursor, true)
+
+	if options.CursorChapter != nil || options.CursorPercent != nil {
+		t.Errorf("decoded chapter %v and percent %v, expected both to stay unknown",
+			options.CursorChapter, options.CursorPercent)
+	}
+
+	if options.CursorPage == nil || *options.CursorPage != 88 {
+		t.Errorf("decoded page %v, expected 88", options.CursorPage)
+	}
+}
+
+func TestDecodeNoteCursorRejectsCursorsOfTheOtherOrder(t *testing.T) {
+	noteRow := &databaseutil.NoteRow{Id: 1, CreationTime: time.Now()}
+
+	if err := decodeNoteCursor(encodeNoteCursor(noteRow, true), &databaseutil.NoteListingOptions{}); err != InvalidNoteCursorError {
+		t.Errorf("a reading order cursor listed newest first returned %v, expected InvalidNoteCursorError", err)
+	}
+
+	readingOrder := &databaseutil.NoteListingOptions{InReadingOrder: true}
+	if err := decodeNoteCursor(encodeNoteCursor(noteRow, false), readingOrder); err != InvalidNoteCursorError {
+		t.Errorf("a newest first cursor listed in reading order returned %v, expected InvalidNoteCursorError", err)
+	}
+}
+
+func TestDecodeNoteCursorRejectsTamperedCursors(t *testing.T) {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	for description, cursor := range map[string]string{
+		"empty":                   "",
+		"not base64":              "not a cursor!",
+		"padded base64":           base64.URLEncoding.EncodeToString([]byte("2018-03-04T15:16:17Z|1")),
+		"no separator":            encode([]byte("2018-03-04T15:16:17Z")),
+		"no id":                   encode([]byte("2018-03-04T15:16:17Z|")),
+		"date without a time":     encode([]byte("2018-03-04|1")),
+		"id that is not a number": encode([]byte("2018-03-04T15:16:17Z|one")),
+		"extra field":             encode([]byte("2018-03-04T15:16:17Z|1|2")),
+	} {
+		if err := decodeNoteCursor(cursor, &databaseutil.NoteListingOptions{}); err != InvalidNoteCursorError {
+			t.Errorf("%s: decodeNoteCursor(%q) returned %v, expected InvalidNoteCursorError", description, cursor, err)
+		}
+	}
+
+	for description, cursor := range map[string]string{
+		"chapter that is not a number": encode([]byte("one|||2018-03-04T15:16:17Z|1")),
+		"fractional page":              encode([]byte("|1.5||2018-03-04T15:16:17Z|1")),
+		"percent that is not a number": encode([]byte("||half|2018-03-04T15:16:17Z|1")),
+		"location without a note key":  encode([]byte("1|2|3")),
+	} {
+		readingOrder := &databaseutil.NoteListingOptions{InReadingOrder: true}
+		if err := decodeNoteCursor(cursor, readingOrder); err != InvalidNoteCursorError {
+			t.Errorf("%s: decodeNoteCursor(%q) returned %v, expected InvalidNoteCursorError", description, cursor, err)
+		}
+	}
+}
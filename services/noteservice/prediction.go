@@ -0,0 +1,104 @@
+package noteservice
+
+import (
+	"errors"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+)
+
+var NoteIsNotAPredictionError = errors.New("The note is not in the predictions category")
+
+var NotPredictionResolverError = errors.New(
+	"Only the author of a prediction or an organizer of one of the author's clubs may resolve it")
+
+var InvalidPredictionConfidenceError = errors.New("Prediction confidence must be a percentage between 0 and 100")
+
+// SetPredictionConfidence sets or, when confidence is nil, clears the percentage chance the author
+// gives a prediction. Like its content, a prediction's confidence is fixed once it is published.
+func SetPredictionConfidence(
+	userId models.UserId,
+	noteId models.NoteId,
+	confidence *int,
+) error {
+	if confidence != nil && (*confidence < 0 || *confidence > 100) {
+		return InvalidPredictionConfidenceError
+	}
+
+	if _, err := getPredictionAuthoredByUser(userId, noteId); err != nil {
+		return err
+	}
+
+	var confidenceAsInt *int64
+	if confidence != nil {
+		value := int64(*confidence)
+		confidenceAsInt = &value
+	}
+
+	if err := databaseutil.UpsertPredictionConfidence(int64(noteId), confidenceAsInt); err != nil {
+		if err == databaseutil.NoteAlreadyPublishedError {
+			return NoteAlreadyPublishedError
+		}
+
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return NoteNotFoundError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// ResolvePrediction records whether a prediction came true, along with who resolved it.
+// The author may resolve a prediction, and so may the organizers of the author's clubs once it is published.
+// Resolving it again replaces the outcome.
+func ResolvePrediction(
+	userId models.UserId,
+	noteId models.NoteId,
+	outcome models.PredictionOutcome,
+) error {
+	// resolving gives nothing of the note away, so spoilers need not be held back
+	note, err := GetNoteVisibleToUser(userId, noteId, true)
+	if err != nil {
+		return err
+	}
+
+	if note.Category == nil || note.Category.Id != models.PREDICTIONS {
+		return NoteIsNotAPredictionError
+	}
+
+	if note.AuthorId != userId {
+		isOrganizer, err := clubservice.IsOrganizerOverUser(userId, note.AuthorId)
+		if err != nil {
+			return err
+		}
+
+		if !isOrganizer {
+			return NotPredictionResolverError
+		}
+	}
+
+	return databaseutil.UpsertPredictionOutcome(
+		int64(noteId),
+		outcome.String(),
+		int64(userId),
+		time.Now().UTC())
+}
+
+// PRIVATE
+
+func getPredictionAuthoredByUser(userId models.UserId, noteId models.NoteId) (*models.Note, error) {
+	note, err := getNoteAuthoredByUser(userId, noteId)
+	if err != nil {
+		return nil, err
+	}
+
+	if note.Category == nil || note.Category.Id != models.PREDICTIONS {
+		return nil, NoteIsNotAPredictionError
+	}
+
+	return note, nil
+}
@@ -0,0 +1,167 @@
+package noteservice
+
+import (
+	"errors"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+	"github.com/atmiguel/cerealnotes/services/notificationservice"
+)
+
+var NoteIsNotAQuestionError = errors.New("The note is not in the questions category")
+
+var NoteDoesNotAnswerQuestionError = errors.New("The note is not an answer to this question")
+
+// StoreNewAnswer stores a note answering a published question the user can read, and lets the asker know about it.
+// Answers can be read by everyone who can read the question, and are about the same book.
+// Like published notes, answers can no longer change once posted.
+func StoreNewAnswer(
+	userId models.UserId,
+	questionId models.NoteId,
+	content string,
+) (models.NoteId, error) {
+	question, err := getQuestionVisibleToUser(userId, questionId, true)
+	if err != nil {
+		return 0, err
+	}
+
+	if question.PublicationTime == nil {
+		return 0, NoteNotPublishedError
+	}
+
+	id, err := databaseutil.InsertAnswerNote(
+		int64(questionId),
+		int64(userId),
+		convertBookIdToNullableInt(question.BookId),
+		content,
+		time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	answerId := models.NoteId(id)
+
+	if err := recordMentions(userId, answerId, 0, content, true); err != nil {
+		return 0, err
+	}
+
+	if question.AuthorId != userId {
+		if err := notificationservice.Notify(
+			[]models.UserId{question.AuthorId},
+			&models.AnswerNotification{QuestionId: questionId, AnswerId: answerId, AuthorId: userId},
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	return answerId, nil
+}
+
+// GetAnswersVisibleToUser returns the answers to a question the user can read, oldest first,
+// leaving out those written by anyone who shares no club with the user.
+// Unless revealSpoilers is set, answers beyond the user's reading progress come back redacted,
+// and so do all the answers to a question beyond it.
+func GetAnswersVisibleToUser(
+	userId models.UserId,
+	questionId models.NoteId,
+	revealSpoilers bool,
+) ([]*models.NoteWithId, error) {
+	question, err := getQuestionVisibleToUser(userId, questionId, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	gate, err := newSpoilerGate(userId, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	fellowMembersById, err := clubservice.GetFellowMembers(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	noteRows, err := databaseutil.GetAnswersToQuestion(int64(questionId))
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make([]*models.NoteWithId, 0, len(noteRows))
+	for _, noteRow := range noteRows {
+		if _, ok := fellowMembersById[models.UserId(noteRow.AuthorId)]; !ok {
+			continue
+		}
+
+		answer := convertNoteRowToNote(noteRow)
+
+		if !gate.redact(answer) && question.IsWithheld && answer.AuthorId != userId {
+			redactNote(answer)
+		}
+
+		answers = append(answers, &models.NoteWithId{Id: models.NoteId(noteRow.Id), Note: answer})
+	}
+
+	if err := attachReactionCountsToList(userId, answers); err != nil {
+		return nil, err
+	}
+
+	return answers, nil
+}
+
+// AcceptAnswer marks one answer as the accepted one, replacing any earlier choice.
+// Only the asker may accept an answer.
+func AcceptAnswer(
+	userId models.UserId,
+	questionId models.NoteId,
+	answerId models.NoteId,
+) error {
+	question, err := getNoteAuthoredByUser(userId, questionId)
+	if err != nil {
+		return err
+	}
+
+	if question.Category == nil || question.Category.Id != models.QUESTIONS {
+		return NoteIsNotAQuestionError
+	}
+
+	answer, err := GetNoteById(answerId)
+	if err != nil {
+		return err
+	}
+
+	if answer.QuestionId != questionId {
+		return NoteDoesNotAnswerQuestionError
+	}
+
+	return databaseutil.UpsertAcceptedAnswer(int64(questionId), int64(answerId))
+}
+
+// ClearAcceptedAnswer reopens a question. Only the asker may do so.
+func ClearAcceptedAnswer(userId models.UserId, questionId models.NoteId) error {
+	if _, err := getNoteAuthoredByUser(userId, questionId); err != nil {
+		return err
+	}
+
+	return databaseutil.DeleteAcceptedAnswer(int64(questionId))
+}
+
+// PRIVATE
+
+func getQuestionVisibleToUser(
+	userId models.UserId,
+	questionId models.NoteId,
+	revealSpoilers bool,
+) (*models.Note, error) {
+	question, err := GetNoteVisibleToUser(userId, questionId, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	if question.Category == nil || question.Category.Id != models.QUESTIONS {
+		return nil, NoteIsNotAQuestionError
+	}
+
+	return question, nil
+}
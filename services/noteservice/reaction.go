@@ -0,0 +1,112 @@
+package noteservice
+
+import (
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+)
+
+// AddReaction reacts to a note the user can read, which is either published or the user's own.
+// Adding a reaction the user already gave does nothing.
+func AddReaction(userId models.UserId, noteId models.NoteId, reaction models.Reaction) error {
+	if _, err := GetNoteVisibleToUser(userId, noteId, true); err != nil {
+		return err
+	}
+
+	return databaseutil.InsertNoteReaction(int64(noteId), int64(userId), reaction.String(), time.Now().UTC())
+}
+
+// RemoveReaction takes back one of the user's reactions to a note. Removing a reaction
+// the user never gave does nothing.
+func RemoveReaction(userId models.UserId, noteId models.NoteId, reaction models.Reaction) error {
+	if _, err := GetNoteVisibleToUser(userId, noteId, true); err != nil {
+		return err
+	}
+
+	return databaseutil.DeleteNoteReaction(int64(noteId), int64(userId), reaction.String())
+}
+
+// GetReactionsVisibleToUser returns who reacted to a note the user can read and how, oldest first,
+// leaving out the reactions of anyone who shares no club with the user.
+func GetReactionsVisibleToUser(userId models.UserId, noteId models.NoteId) ([]*models.NoteReaction, error) {
+	if _, err := GetNoteVisibleToUser(userId, noteId, true); err != nil {
+		return nil, err
+	}
+
+	fellowMembersById, err := clubservice.GetFellowMembers(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	reactionRows, err := databaseutil.GetNoteReactions(int64(noteId))
+	if err != nil {
+		return nil, err
+	}
+
+	reactions := make([]*models.NoteReaction, 0, len(reactionRows))
+	for _, reactionRow := range reactionRows {
+		if _, ok := fellowMembersById[models.UserId(reactionRow.UserId)]; !ok {
+			continue
+		}
+
+		reaction, err := models.DeserializeReaction(reactionRow.Reaction)
+		if err != nil {
+			return nil, err
+		}
+
+		reactions = append(reactions, &models.NoteReaction{
+			UserId:       models.UserId(reactionRow.UserId),
+			Reaction:     reaction,
+			CreationTime: reactionRow.CreationTime,
+		})
+	}
+
+	return reactions, nil
+}
+
+// PRIVATE
+
+// attachReactionCounts fills in the reactions each of the notes received as seen by the viewer.
+func attachReactionCounts(viewerId models.UserId, notesById NotesById) error {
+	if len(notesById) == 0 {
+		return nil
+	}
+
+	noteIds := make([]int64, 0, len(notesById))
+	for noteId := range notesById {
+		noteIds = append(noteIds, int64(noteId))
+	}
+
+	countRows, err := databaseutil.GetNoteReactionCounts(noteIds, int64(viewerId))
+	if err != nil {
+		return err
+	}
+
+	for _, countRow := range countRows {
+		reaction, err := models.DeserializeReaction(countRow.Reaction)
+		if err != nil {
+			return err
+		}
+
+		note := notesById[models.NoteId(countRow.NoteId)]
+		note.Reactions = append(note.Reactions, &models.ReactionCount{
+			Reaction:   reaction,
+			Count:      countRow.Count,
+			HasReacted: countRow.HasReacted,
+		})
+	}
+
+	return nil
+}
+
+// attachReactionCountsToList behaves like attachReactionCounts for notes listed in order.
+func attachReactionCountsToList(viewerId models.UserId, notes []*models.NoteWithId) error {
+	notesById := make(NotesById, len(notes))
+	for _, note := range notes {
+		notesById[note.Id] = note.Note
+	}
+
+	return attachReactionCounts(viewerId, notesById)
+}
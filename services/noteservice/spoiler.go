@@ -0,0 +1,70 @@
+package noteservice
+
+import (
+	"errors"
+
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/progressservice"
+)
+
+var NoteWithheldAsSpoilerError = errors.New(
+	"The note is about a part of the book you have not read yet; ask to reveal it to see it anyway")
+
+// CountWithheldNotes counts the notes that were redacted because they lie beyond the reader's progress.
+func CountWithheldNotes(notes []*models.NoteWithId) int {
+	withheldCount := 0
+
+	for _, note := range notes {
+		if note.IsWithheld {
+			withheldCount++
+		}
+	}
+
+	return withheldCount
+}
+
+// spoilerGate redacts the notes of other authors that are anchored beyond the viewer's reading progress.
+// A nil gate reveals everything.
+type spoilerGate struct {
+	viewerId        models.UserId
+	locationsByBook map[models.BookId]*models.Location
+}
+
+func newSpoilerGate(viewerId models.UserId, revealSpoilers bool) (*spoilerGate, error) {
+	if revealSpoilers {
+		return nil, nil
+	}
+
+	locationsByBook, err := progressservice.GetCurrentLocationsByBook(viewerId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &spoilerGate{viewerId: viewerId, locationsByBook: locationsByBook}, nil
+}
+
+func (gate *spoilerGate) withholds(note *models.Note) bool {
+	if gate == nil || note.AuthorId == gate.viewerId || note.BookId == 0 || note.Location == nil {
+		return false
+	}
+
+	return note.Location.IsBeyond(gate.locationsByBook[note.BookId])
+}
+
+// redact strips a withheld note down to where it is in the book and who wrote it, and reports
+// whether it did so.
+func (gate *spoilerGate) redact(note *models.Note) bool {
+	if !gate.withholds(note) {
+		return false
+	}
+
+	redactNote(note)
+	return true
+}
+
+func redactNote(note *models.Note) {
+	note.Content = ""
+	note.Tags = nil
+	note.Prediction = nil
+	note.IsWithheld = true
+}
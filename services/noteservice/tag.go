@@ -0,0 +1,63 @@
+package noteservice
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+)
+
+const maxTagLength = 64
+
+// MaxTagSuggestionCount caps how many tags SuggestTags returns.
+const MaxTagSuggestionCount = 10
+
+var InvalidTagError = errors.New("Tags cannot be empty or longer than 64 characters")
+
+// NormalizeTag trims and lowercases a tag so that "Evan " and "evan" are the same tag.
+func NormalizeTag(tag string) (string, error) {
+	normalizedTag := strings.ToLower(strings.Join(strings.Fields(tag), " "))
+
+	if len(normalizedTag) == 0 || utf8.RuneCountInString(normalizedTag) > maxTagLength {
+		return "", InvalidTagError
+	}
+
+	return normalizedTag, nil
+}
+
+// AttachTagToNote only lets the author tag a note. Attaching a tag twice does nothing.
+func AttachTagToNote(userId models.UserId, noteId models.NoteId, tag string) error {
+	normalizedTag, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+
+	if _, err := getNoteAuthoredByUser(userId, noteId); err != nil {
+		return err
+	}
+
+	return databaseutil.InsertNoteTagRelationship(int64(noteId), normalizedTag)
+}
+
+// DetachTagFromNote only lets the author untag a note. Detaching a missing tag does nothing.
+func DetachTagFromNote(userId models.UserId, noteId models.NoteId, tag string) error {
+	normalizedTag, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+
+	if _, err := getNoteAuthoredByUser(userId, noteId); err != nil {
+		return err
+	}
+
+	return databaseutil.DeleteNoteTagRelationship(int64(noteId), normalizedTag)
+}
+
+// SuggestTags autocompletes the prefix against the tags the user has put on their own notes.
+func SuggestTags(userId models.UserId, prefix string) ([]string, error) {
+	normalizedPrefix := strings.ToLower(strings.TrimLeft(prefix, " \t"))
+
+	return databaseutil.GetTagNamesUsedByAuthor(int64(userId), normalizedPrefix, MaxTagSuggestionCount)
+}
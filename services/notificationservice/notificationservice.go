@@ -0,0 +1,180 @@
+/*
+Package notificationservice keeps the inbox in which users learn what happened while they were away.
+*/
+package notificationservice
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+)
+
+const DefaultNotificationPageSize = 50
+
+// MaxNotificationPageSize caps how many notifications a single page may hold, whatever the caller asks for.
+const MaxNotificationPageSize = 100
+
+// Inbox is one page of a user's notifications, newest first. NextCursor is 0 on the last page.
+// UnreadCount counts every unread notification of the user, not only those on the page.
+type Inbox struct {
+	Notifications []*models.NotificationWithId `json:"notifications"`
+	NextCursor    models.NotificationId        `json:"nextCursor,omitempty"`
+	UnreadCount   int                          `json:"unreadCount"`
+}
+
+// Notify sends the notification to each of the recipients once. Recipients with an id of 0 are skipped.
+func Notify(recipientIds []models.UserId, payload models.NotificationPayload) error {
+	isNotified := make(map[models.UserId]bool, len(recipientIds))
+
+	recipientIdsAsInts := make([]int64, 0, len(recipientIds))
+	for _, recipientId := range recipientIds {
+		if recipientId == 0 || isNotified[recipientId] {
+			continue
+		}
+		isNotified[recipientId] = true
+
+		recipientIdsAsInts = append(recipientIdsAsInts, int64(recipientId))
+	}
+
+	if len(recipientIdsAsInts) == 0 {
+		return nil
+	}
+
+	payloadInJson, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return databaseutil.InsertNotifications(
+		recipientIdsAsInts,
+		payload.NotificationType().String(),
+		payloadInJson,
+		time.Now().UTC())
+}
+
+// NotifyFellowMembers sends the notification to every member of the user's clubs except the user.
+func NotifyFellowMembers(userId models.UserId, payload models.NotificationPayload) error {
+	fellowMembersById, err := clubservice.GetFellowMembers(userId)
+	if err != nil {
+		return err
+	}
+
+	recipientIds := make([]models.UserId, 0, len(fellowMembersById))
+	for memberId := range fellowMembersById {
+		if memberId != userId {
+			recipientIds = append(recipientIds, memberId)
+		}
+	}
+
+	return Notify(recipientIds, payload)
+}
+
+// GetInbox returns one page of the user's notifications, or of the unread ones only.
+// A cursor of 0 starts from the newest notification.
+func GetInbox(
+	userId models.UserId,
+	isUnreadOnly bool,
+	cursor models.NotificationId,
+	pageSize int,
+) (*Inbox, error) {
+	if pageSize > MaxNotificationPageSize {
+		pageSize = MaxNotificationPageSize
+	}
+
+	// fetch one extra notification to learn whether another page follows
+	notificationRows, err := databaseutil.GetNotificationsOfUser(
+		int64(userId),
+		isUnreadOnly,
+		int64(cursor),
+		pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+
+	inbox := &Inbox{}
+
+	if len(notificationRows) > pageSize {
+		notificationRows = notificationRows[:pageSize]
+
+		inbox.NextCursor = models.NotificationId(notificationRows[len(notificationRows)-1].Id)
+	}
+
+	inbox.Notifications = make([]*models.NotificationWithId, 0, len(notificationRows))
+	for _, notificationRow := range notificationRows {
+		notification, err := convertNotificationRowToNotification(notificationRow)
+		if err != nil {
+			return nil, err
+		}
+
+		inbox.Notifications = append(inbox.Notifications, &models.NotificationWithId{
+			Id:           models.NotificationId(notificationRow.Id),
+			Notification: notification,
+		})
+	}
+
+	inbox.UnreadCount, err = CountUnreadNotifications(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return inbox, nil
+}
+
+func CountUnreadNotifications(userId models.UserId) (int, error) {
+	return databaseutil.CountUnreadNotifications(int64(userId))
+}
+
+// MarkNotificationsRead marks the given notifications of the user read, or every one of them
+// when notificationIds is nil. Ids of notifications the user did not receive are ignored.
+func MarkNotificationsRead(userId models.UserId, notificationIds []models.NotificationId) error {
+	var notificationIdsAsInts []int64
+
+	if notificationIds != nil {
+		notificationIdsAsInts = make([]int64, 0, len(notificationIds))
+		for _, notificationId := range notificationIds {
+			notificationIdsAsInts = append(notificationIdsAsInts, int64(notificationId))
+		}
+	}
+
+	return databaseutil.MarkNotificationsRead(int64(userId), notificationIdsAsInts, time.Now().UTC())
+}
+
+// PRIVATE
+
+func convertNotificationRowToNotification(
+	notificationRow *databaseutil.NotificationRow,
+) (*models.Notification, error) {
+	notificationType, err := models.DeserializeNotificationType(notificationRow.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload models.NotificationPayload
+
+	switch notificationType {
+	case models.NEW_PUBLICATION, models.PUBLICATION_LIVE:
+		payload = &models.PublicationNotification{Type: notificationType}
+	case models.NOTE_COMMENT, models.COMMENT_REPLY:
+		payload = &models.CommentNotification{Type: notificationType}
+	case models.QUESTION_ANSWER:
+		payload = new(models.AnswerNotification)
+	case models.MENTION:
+		payload = new(models.MentionNotification)
+	default:
+		return nil, models.CannotDeserializeNotificationTypeStringError
+	}
+
+	if err := json.Unmarshal(notificationRow.Payload, payload); err != nil {
+		return nil, err
+	}
+
+	return &models.Notification{
+		Type:         notificationType,
+		Payload:      payload,
+		CreationTime: notificationRow.CreationTime,
+		ReadTime:     notificationRow.ReadTime,
+	}, nil
+}
@@ -0,0 +1,120 @@
+/*
+Package progressservice handles interactions with database layer.
+*/
+package progressservice
+
+import (
+	"errors"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/bookservice"
+)
+
+var InvalidReadingProgressError = errors.New(
+	"Reading progress needs a chapter of the book, a page of at least 1 or a percentage between 0 and 100")
+
+// RecordReadingProgress stores how far the user has read into a book. Earlier progress is kept as history.
+func RecordReadingProgress(userId models.UserId, bookId models.BookId, location *models.Location) error {
+	book, err := bookservice.GetBookById(bookId)
+	if err != nil {
+		return err
+	}
+
+	if !bookservice.IsValidLocation(book, location) {
+		return InvalidReadingProgressError
+	}
+
+	var chapter *int64
+	if location.Chapter != nil {
+		chapter = new(int64)
+		*chapter = int64(*location.Chapter)
+	}
+
+	var page *int64
+	if location.Page != nil {
+		page = new(int64)
+		*page = int64(*location.Page)
+	}
+
+	if err := databaseutil.InsertReadingProgress(
+		int64(userId),
+		int64(bookId),
+		chapter,
+		page,
+		location.Percent,
+		time.Now().UTC(),
+	); err != nil {
+		if err == databaseutil.ForeignKeyConstraintError {
+			return bookservice.BookNotFoundError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetReadingProgressHistory returns every progress update the user recorded for the book, newest first.
+func GetReadingProgressHistory(userId models.UserId, bookId models.BookId) ([]*models.ReadingProgress, error) {
+	progressRows, err := databaseutil.GetReadingProgressHistory(int64(userId), int64(bookId))
+	if err != nil {
+		return nil, err
+	}
+
+	return convertReadingProgressRows(progressRows), nil
+}
+
+// GetCurrentReadingProgress returns the latest progress of the user in each book they have recorded progress in.
+func GetCurrentReadingProgress(userId models.UserId) ([]*models.ReadingProgress, error) {
+	progressRows, err := databaseutil.GetCurrentReadingProgress(int64(userId))
+	if err != nil {
+		return nil, err
+	}
+
+	return convertReadingProgressRows(progressRows), nil
+}
+
+// GetCurrentLocationsByBook is GetCurrentReadingProgress keyed by book.
+func GetCurrentLocationsByBook(userId models.UserId) (map[models.BookId]*models.Location, error) {
+	progresses, err := GetCurrentReadingProgress(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	locationsByBook := make(map[models.BookId]*models.Location, len(progresses))
+	for _, progress := range progresses {
+		locationsByBook[progress.BookId] = progress.Location
+	}
+
+	return locationsByBook, nil
+}
+
+// PRIVATE
+
+func convertReadingProgressRows(progressRows []*databaseutil.ReadingProgressRow) []*models.ReadingProgress {
+	progresses := make([]*models.ReadingProgress, 0, len(progressRows))
+
+	for _, progressRow := range progressRows {
+		location := &models.Location{Percent: progressRow.Percent}
+
+		if progressRow.Chapter != nil {
+			chapter := int(*progressRow.Chapter)
+			location.Chapter = &chapter
+		}
+
+		if progressRow.Page != nil {
+			page := int(*progressRow.Page)
+			location.Page = &page
+		}
+
+		progresses = append(progresses, &models.ReadingProgress{
+			BookId:     models.BookId(progressRow.BookId),
+			Location:   location,
+			RecordTime: progressRow.RecordTime,
+		})
+	}
+
+	return progresses
+}
@@ -0,0 +1,464 @@
+/*
+Package publicationservice handles interactions with database layer.
+*/
+package publicationservice
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/bookservice"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+	"github.com/atmiguel/cerealnotes/services/noteservice"
+	"github.com/atmiguel/cerealnotes/services/notificationservice"
+	"github.com/atmiguel/cerealnotes/services/scheduleservice"
+)
+
+var NoNotesToPublishError = errors.New("There are no notes to publish")
+
+var NoteNotAboutBookError = errors.New("The note is not about the book being published")
+
+var MilestoneNotAboutBookError = errors.New("The milestone is not about the book being published")
+
+var PublicationNotFoundError = errors.New("No publication exists with the given id")
+
+var PublicationNotAuthoredByUserError = errors.New("The publication was not created by this user")
+
+var PublicationAlreadyRetractedError = errors.New("The publication has already been retracted")
+
+var RetractionWindowClosedError = errors.New("The publication has been live for too long to be retracted")
+
+var retractionWindow time.Duration
+
+// SetRetractionWindow sets how long after going live a publication may still be retracted by its author.
+func SetRetractionWindow(window time.Duration) {
+	retractionWindow = window
+}
+
+// NoteGroup holds the notes of a publication that share a category.
+// Category is nil for the group of uncategorized notes.
+type NoteGroup struct {
+	Category *models.NoteCategory `json:"category,omitempty"`
+	Notes    []*models.NoteWithId `json:"notes"`
+}
+
+// PublicationWithNotes is a publication as readers see it: with its author, the titles of its book
+// and milestone, and its notes grouped by category, in category sort order, with uncategorized notes last.
+// WithheldCount counts the notes redacted because they are beyond the reader's progress.
+type PublicationWithNotes struct {
+	Id models.PublicationId `json:"id"`
+	models.Publication
+	Author         *models.User `json:"author"`
+	BookTitle      string       `json:"bookTitle,omitempty"`
+	MilestoneTitle string       `json:"milestoneTitle,omitempty"`
+	NoteGroups     []*NoteGroup `json:"noteGroups"`
+	WithheldCount  int          `json:"withheldCount"`
+}
+
+// PublishNotes bundles notes the author wrote about a book into a new publication.
+// When noteIds is nil, every unpublished note of the author about the book is published.
+// A non-nil milestoneId attaches the publication to a milestone about the same book,
+// of a club the author belongs to. The publication goes live right away unless publishAt is in the future,
+// in which case the members of the author's clubs are only notified once it does.
+// Failing to notify them is only logged, since the publication is live by then.
+func PublishNotes(
+	authorId models.UserId,
+	bookId models.BookId,
+	milestoneId *models.MilestoneId,
+	title string,
+	introMessage string,
+	noteIds []models.NoteId,
+	publishAt *time.Time,
+) (models.PublicationId, error) {
+	if _, err := bookservice.GetBookById(bookId); err != nil {
+		return 0, err
+	}
+
+	var milestoneIdAsInt *int64
+	if milestoneId != nil {
+		milestone, err := scheduleservice.GetMilestoneVisibleToUser(authorId, *milestoneId)
+		if err != nil {
+			return 0, err
+		}
+
+		if milestone.BookId != bookId {
+			return 0, MilestoneNotAboutBookError
+		}
+
+		milestoneIdAsInt = new(int64)
+		*milestoneIdAsInt = int64(*milestoneId)
+	}
+
+	var noteIdsAsInts []int64
+
+	if noteIds == nil {
+		unpublishedNoteIds, err := databaseutil.GetUnpublishedNoteIdsByAuthor(int64(authorId), int64(bookId))
+		if err != nil {
+			return 0, err
+		}
+
+		noteIdsAsInts = unpublishedNoteIds
+	} else {
+		// Check each note up front so that the caller learns which rule was broken.
+		isCheckedByNoteId := make(map[models.NoteId]bool, len(noteIds))
+
+		for _, noteId := range noteIds {
+			if isCheckedByNoteId[noteId] {
+				continue
+			}
+			isCheckedByNoteId[noteId] = true
+
+			note, err := noteservice.GetNoteById(noteId)
+			if err != nil {
+				return 0, err
+			}
+
+			if note.AuthorId != authorId {
+				return 0, noteservice.NoteNotAuthoredByUserError
+			}
+
+			if note.PublicationId != 0 || note.QuestionId != 0 {
+				return 0, noteservice.NoteAlreadyPublishedError
+			}
+
+			if note.BookId != bookId {
+				return 0, NoteNotAboutBookError
+			}
+
+			noteIdsAsInts = append(noteIdsAsInts, int64(noteId))
+		}
+	}
+
+	if len(noteIdsAsInts) == 0 {
+		return 0, NoNotesToPublishError
+	}
+
+	creationTime := time.Now().UTC()
+
+	scheduledPublishAt := creationTime
+	publicationTime := &creationTime
+	if publishAt != nil && publishAt.After(creationTime) {
+		scheduledPublishAt = publishAt.UTC()
+		publicationTime = nil
+	}
+
+	publicationId, err := databaseutil.InsertPublication(
+		int64(authorId),
+		int64(bookId),
+		milestoneIdAsInt,
+		title,
+		introMessage,
+		creationTime,
+		scheduledPublishAt,
+		publicationTime,
+		noteIdsAsInts)
+	if err != nil {
+		switch err {
+		case databaseutil.QueryResultContainedNoRowsError:
+			return 0, noteservice.NoteNotFoundError
+		case databaseutil.NoteAlreadyPublishedError:
+			return 0, noteservice.NoteAlreadyPublishedError
+		}
+
+		return 0, err
+	}
+
+	if publicationTime != nil {
+		if err := notifyAboutLivePublication(publicationId, false); err != nil {
+			log.Printf("Failed to notify about publication %d: %s\n", publicationId, err)
+		}
+	}
+
+	return models.PublicationId(publicationId), nil
+}
+
+// PublicationFilter narrows down a listing of live publications. Nil fields do not filter anything.
+// PublishedAfter is inclusive and PublishedBefore exclusive.
+// RevealSpoilers includes the content of notes beyond the viewer's reading progress.
+type PublicationFilter struct {
+	BookId          *models.BookId
+	MilestoneId     *models.MilestoneId
+	PublishedAfter  *time.Time
+	PublishedBefore *time.Time
+
+	RevealSpoilers bool
+}
+
+// GetLivePublications returns every publication by the viewer or by the members of the viewer's clubs
+// that has gone live, most recently published first. Unless the filter reveals spoilers,
+// notes beyond the viewer's reading progress come back redacted.
+func GetLivePublications(
+	viewerId models.UserId,
+	filter *PublicationFilter,
+) ([]*PublicationWithNotes, error) {
+	options := &databaseutil.PublicationListingOptions{
+		PublishedAfter:  filter.PublishedAfter,
+		PublishedBefore: filter.PublishedBefore,
+	}
+
+	if filter.BookId != nil {
+		bookId := int64(*filter.BookId)
+		options.BookId = &bookId
+	}
+
+	if filter.MilestoneId != nil {
+		milestoneId := int64(*filter.MilestoneId)
+		options.MilestoneId = &milestoneId
+	}
+
+	publicationRows, err := databaseutil.GetLivePublications(int64(viewerId), options)
+	if err != nil {
+		return nil, err
+	}
+
+	return attachNotesToPublicationRows(viewerId, publicationRows, filter.RevealSpoilers)
+}
+
+// GetPublicationVisibleToUser returns PublicationNotFoundError if no such publication exists,
+// or if the user is not its author and it is still scheduled or its author shares no club with the user.
+func GetPublicationVisibleToUser(
+	userId models.UserId,
+	publicationId models.PublicationId,
+	revealSpoilers bool,
+) (*PublicationWithNotes, error) {
+	publicationRow, err := databaseutil.GetPublicationById(int64(publicationId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return nil, PublicationNotFoundError
+		}
+
+		return nil, err
+	}
+
+	if authorId := models.UserId(publicationRow.AuthorId); authorId != userId {
+		if publicationRow.PublicationTime == nil {
+			return nil, PublicationNotFoundError
+		}
+
+		doShareClub, err := clubservice.DoUsersShareClub(userId, authorId)
+		if err != nil {
+			return nil, err
+		}
+
+		if !doShareClub {
+			return nil, PublicationNotFoundError
+		}
+	}
+
+	publications, err := attachNotesToPublicationRows(
+		userId,
+		[]*databaseutil.PublicationRow{publicationRow},
+		revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	return publications[0], nil
+}
+
+// RetractPublication returns the notes of the publication to the unpublished state.
+// Only the author may retract, and only while the publication is scheduled or within
+// the retraction window after it went live.
+func RetractPublication(userId models.UserId, publicationId models.PublicationId) error {
+	publicationRow, err := databaseutil.GetPublicationById(int64(publicationId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return PublicationNotFoundError
+		}
+
+		return err
+	}
+
+	if models.UserId(publicationRow.AuthorId) != userId {
+		return PublicationNotAuthoredByUserError
+	}
+
+	if publicationRow.RetractionTime != nil {
+		return PublicationAlreadyRetractedError
+	}
+
+	retractionTime := time.Now().UTC()
+
+	if publicationRow.PublicationTime != nil &&
+		retractionTime.Sub(*publicationRow.PublicationTime) > retractionWindow {
+		return RetractionWindowClosedError
+	}
+
+	if err := databaseutil.RetractPublication(int64(publicationId), int64(userId), retractionTime); err != nil {
+		if err == databaseutil.UniqueConstraintError {
+			return PublicationAlreadyRetractedError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// PublishDuePublications makes every scheduled publication whose time has come go live,
+// and sends out the notifications that go with it. It is safe to run from several server instances at once.
+// The ids of all the publications that went live are returned even when notifying about some of them failed,
+// along with the first such error.
+func PublishDuePublications() ([]models.PublicationId, error) {
+	publicationIdsAsInts, err := databaseutil.PublishDuePublications(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	publicationIds := make([]models.PublicationId, 0, len(publicationIdsAsInts))
+	var firstErr error
+
+	for _, publicationId := range publicationIdsAsInts {
+		publicationIds = append(publicationIds, models.PublicationId(publicationId))
+
+		if err := notifyAboutLivePublication(publicationId, true); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("notifying about publication %d: %s", publicationId, err)
+		}
+	}
+
+	return publicationIds, firstErr
+}
+
+// PRIVATE
+
+// notifyAboutLivePublication tells the members of the author's clubs about a publication that just went live,
+// and everyone its notes mention about the mention. The author of a scheduled publication learns that it went live.
+func notifyAboutLivePublication(publicationId int64, wasScheduled bool) error {
+	publicationRow, err := databaseutil.GetPublicationById(publicationId)
+	if err != nil {
+		return err
+	}
+
+	authorId := models.UserId(publicationRow.AuthorId)
+
+	payload := &models.PublicationNotification{
+		Type:          models.NEW_PUBLICATION,
+		PublicationId: models.PublicationId(publicationRow.Id),
+		AuthorId:      authorId,
+		BookId:        models.BookId(publicationRow.BookId),
+		Title:         publicationRow.Title,
+	}
+
+	if err := notificationservice.NotifyFellowMembers(authorId, payload); err != nil {
+		return err
+	}
+
+	if wasScheduled {
+		authorPayload := *payload
+		authorPayload.Type = models.PUBLICATION_LIVE
+
+		if err := notificationservice.Notify([]models.UserId{authorId}, &authorPayload); err != nil {
+			return err
+		}
+	}
+
+	mentionRows, err := databaseutil.GetMentionsInPublication(publicationId)
+	if err != nil {
+		return err
+	}
+
+	for _, mentionRow := range mentionRows {
+		if err := notificationservice.Notify(
+			[]models.UserId{models.UserId(mentionRow.MentionedUserId)},
+			&models.MentionNotification{Mention: models.Mention{
+				NoteId:      models.NoteId(mentionRow.NoteId),
+				MentionerId: authorId,
+				MentionTime: mentionRow.MentionTime,
+			}},
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func attachNotesToPublicationRows(
+	viewerId models.UserId,
+	publicationRows []*databaseutil.PublicationRow,
+	revealSpoilers bool,
+) ([]*PublicationWithNotes, error) {
+	publicationIds := make([]models.PublicationId, 0, len(publicationRows))
+	for _, publicationRow := range publicationRows {
+		publicationIds = append(publicationIds, models.PublicationId(publicationRow.Id))
+	}
+
+	notesByPublication, err := noteservice.GetNotesByPublication(viewerId, publicationIds, revealSpoilers)
+	if err != nil {
+		return nil, err
+	}
+
+	publications := make([]*PublicationWithNotes, 0, len(publicationRows))
+	for _, publicationRow := range publicationRows {
+		publicationId := models.PublicationId(publicationRow.Id)
+
+		publications = append(publications, &PublicationWithNotes{
+			Id: publicationId,
+			Publication: models.Publication{
+				AuthorId:        models.UserId(publicationRow.AuthorId),
+				BookId:          models.BookId(publicationRow.BookId),
+				MilestoneId:     models.MilestoneId(publicationRow.MilestoneId),
+				CreationTime:    publicationRow.CreationTime,
+				PublishAt:       publicationRow.PublishAt,
+				PublicationTime: publicationRow.PublicationTime,
+				RetractionTime:  publicationRow.RetractionTime,
+				Title:           publicationRow.Title,
+				IntroMessage:    publicationRow.IntroMessage,
+			},
+			Author:         &models.User{DisplayName: publicationRow.AuthorDisplayName},
+			BookTitle:      publicationRow.BookTitle,
+			MilestoneTitle: publicationRow.MilestoneTitle,
+			NoteGroups:     groupNotesByCategory(notesByPublication[publicationId]),
+			WithheldCount:  noteservice.CountWithheldNotes(notesByPublication[publicationId]),
+		})
+	}
+
+	return publications, nil
+}
+
+// groupNotesByCategory keeps the order of the notes within each group.
+func groupNotesByCategory(notes []*models.NoteWithId) []*NoteGroup {
+	noteGroupsByCategory := make(map[models.Category]*NoteGroup)
+	categorizedNoteGroups := make([]*NoteGroup, 0)
+	uncategorizedNoteGroup := &NoteGroup{Notes: make([]*models.NoteWithId, 0)}
+
+	for _, note := range notes {
+		if note.Category == nil {
+			uncategorizedNoteGroup.Notes = append(uncategorizedNoteGroup.Notes, note)
+			continue
+		}
+
+		noteGroup, ok := noteGroupsByCategory[note.Category.Id]
+		if !ok {
+			category := *note.Category
+			noteGroup = &NoteGroup{Category: &category, Notes: make([]*models.NoteWithId, 0)}
+
+			noteGroupsByCategory[category.Id] = noteGroup
+			categorizedNoteGroups = append(categorizedNoteGroups, noteGroup)
+		}
+
+		noteGroup.Notes = append(noteGroup.Notes, note)
+	}
+
+	sort.Slice(categorizedNoteGroups, func(i, j int) bool {
+		categoryI := categorizedNoteGroups[i].Category
+		categoryJ := categorizedNoteGroups[j].Category
+
+		if categoryI.SortOrder != categoryJ.SortOrder {
+			return categoryI.SortOrder < categoryJ.SortOrder
+		}
+
+		return categoryI.Id < categoryJ.Id
+	})
+
+	if len(uncategorizedNoteGroup.Notes) > 0 {
+		return append(categorizedNoteGroups, uncategorizedNoteGroup)
+	}
+
+	return categorizedNoteGroups
+}
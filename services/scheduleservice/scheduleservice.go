@@ -0,0 +1,222 @@
+/*
+Package scheduleservice keeps the reading schedules clubs follow as they read a book together.
+*/
+package scheduleservice
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/bookservice"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+)
+
+var MilestoneNotFoundError = errors.New("No milestone exists with the given id")
+
+var MilestoneStillInUseError = errors.New("Publications are still attached to this milestone")
+
+var InvalidChapterRangeError = errors.New("Milestone chapters must be a range within the chapters of the book")
+
+// Schedule is a club's reading schedule for a book. CurrentMilestoneId names the earliest milestone
+// that is not due yet, and is 0 once every milestone is past due.
+type Schedule struct {
+	Milestones         []*models.MilestoneWithId `json:"milestones"`
+	CurrentMilestoneId models.MilestoneId        `json:"currentMilestoneId,omitempty"`
+}
+
+// CreateMilestone adds a milestone to the reading schedule of a club. Only organizers of the club may do so.
+func CreateMilestone(organizerId models.UserId, milestone *models.Milestone) (models.MilestoneId, error) {
+	if err := clubservice.CheckUserOrganizesClub(organizerId, milestone.ClubId); err != nil {
+		return 0, err
+	}
+
+	if err := validateChapterRange(milestone); err != nil {
+		return 0, err
+	}
+
+	milestoneId, err := databaseutil.InsertReadingMilestone(
+		int64(milestone.ClubId),
+		int64(milestone.BookId),
+		strings.TrimSpace(milestone.Title),
+		milestone.FirstChapter,
+		milestone.LastChapter,
+		milestone.DueTime.UTC(),
+		int64(organizerId),
+		time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return models.MilestoneId(milestoneId), nil
+}
+
+// UpdateMilestone changes the title, chapters and due date of a milestone; its club and book stay the same.
+// Only organizers of the milestone's club may change it.
+func UpdateMilestone(
+	organizerId models.UserId,
+	milestoneId models.MilestoneId,
+	milestone *models.Milestone,
+) error {
+	storedMilestone, err := getMilestoneOrganizedByUser(organizerId, milestoneId)
+	if err != nil {
+		return err
+	}
+
+	milestone.ClubId = storedMilestone.ClubId
+	milestone.BookId = storedMilestone.BookId
+
+	if err := validateChapterRange(milestone); err != nil {
+		return err
+	}
+
+	if err := databaseutil.UpdateReadingMilestone(
+		int64(milestoneId),
+		strings.TrimSpace(milestone.Title),
+		milestone.FirstChapter,
+		milestone.LastChapter,
+		milestone.DueTime.UTC(),
+	); err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return MilestoneNotFoundError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// DeleteMilestone removes a milestone from its schedule once no publication is attached to it anymore.
+// Only organizers of the milestone's club may delete it.
+func DeleteMilestone(organizerId models.UserId, milestoneId models.MilestoneId) error {
+	if _, err := getMilestoneOrganizedByUser(organizerId, milestoneId); err != nil {
+		return err
+	}
+
+	if err := databaseutil.DeleteReadingMilestone(int64(milestoneId)); err != nil {
+		switch err {
+		case databaseutil.QueryResultContainedNoRowsError:
+			return MilestoneNotFoundError
+		case databaseutil.ForeignKeyConstraintError:
+			return MilestoneStillInUseError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetSchedule returns the reading schedule of a club for a book, ordered by due date.
+// Only members of the club may see it.
+func GetSchedule(userId models.UserId, clubId models.ClubId, bookId models.BookId) (*Schedule, error) {
+	if _, err := clubservice.GetRoleOfUser(userId, clubId); err != nil {
+		return nil, err
+	}
+
+	milestoneRows, err := databaseutil.GetReadingMilestones(int64(clubId), int64(bookId))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	schedule := &Schedule{Milestones: make([]*models.MilestoneWithId, 0, len(milestoneRows))}
+	for _, milestoneRow := range milestoneRows {
+		milestoneId := models.MilestoneId(milestoneRow.Id)
+
+		if schedule.CurrentMilestoneId == 0 && milestoneRow.DueTime.After(now) {
+			schedule.CurrentMilestoneId = milestoneId
+		}
+
+		schedule.Milestones = append(schedule.Milestones, &models.MilestoneWithId{
+			Id:        milestoneId,
+			Milestone: convertMilestoneRowToMilestone(milestoneRow),
+		})
+	}
+
+	return schedule, nil
+}
+
+// GetMilestoneVisibleToUser returns MilestoneNotFoundError unless the milestone exists
+// and the user belongs to its club.
+func GetMilestoneVisibleToUser(userId models.UserId, milestoneId models.MilestoneId) (*models.Milestone, error) {
+	milestone, err := getMilestoneById(milestoneId)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := clubservice.GetRoleOfUser(userId, milestone.ClubId); err != nil {
+		if err == clubservice.ClubNotFoundError {
+			return nil, MilestoneNotFoundError
+		}
+
+		return nil, err
+	}
+
+	return milestone, nil
+}
+
+// PRIVATE
+
+func getMilestoneById(milestoneId models.MilestoneId) (*models.Milestone, error) {
+	milestoneRow, err := databaseutil.GetReadingMilestoneById(int64(milestoneId))
+	if err != nil {
+		if err == databaseutil.QueryResultContainedNoRowsError {
+			return nil, MilestoneNotFoundError
+		}
+
+		return nil, err
+	}
+
+	return convertMilestoneRowToMilestone(milestoneRow), nil
+}
+
+func getMilestoneOrganizedByUser(
+	organizerId models.UserId,
+	milestoneId models.MilestoneId,
+) (*models.Milestone, error) {
+	milestone, err := GetMilestoneVisibleToUser(organizerId, milestoneId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := clubservice.CheckUserOrganizesClub(organizerId, milestone.ClubId); err != nil {
+		return nil, err
+	}
+
+	return milestone, nil
+}
+
+// validateChapterRange also returns bookservice.BookNotFoundError if the milestone's book does not exist.
+// Books without a chapter list accept any range.
+func validateChapterRange(milestone *models.Milestone) error {
+	book, err := bookservice.GetBookById(milestone.BookId)
+	if err != nil {
+		return err
+	}
+
+	if milestone.FirstChapter < 1 || milestone.LastChapter < milestone.FirstChapter {
+		return InvalidChapterRangeError
+	}
+
+	if len(book.Chapters) > 0 && milestone.LastChapter > len(book.Chapters) {
+		return InvalidChapterRangeError
+	}
+
+	return nil
+}
+
+func convertMilestoneRowToMilestone(milestoneRow *databaseutil.MilestoneRow) *models.Milestone {
+	return &models.Milestone{
+		ClubId:       models.ClubId(milestoneRow.ClubId),
+		BookId:       models.BookId(milestoneRow.BookId),
+		Title:        milestoneRow.Title,
+		FirstChapter: milestoneRow.FirstChapter,
+		LastChapter:  milestoneRow.LastChapter,
+		DueTime:      milestoneRow.DueTime,
+	}
+}
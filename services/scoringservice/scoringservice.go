@@ -0,0 +1,172 @@
+/*
+Package scoringservice scores the predictions of each member once they are resolved.
+*/
+package scoringservice
+
+import (
+	"sort"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
+)
+
+// calibrationBucketWidth splits confidences into the buckets 0-9, 10-19, ..., 90-100.
+const calibrationBucketWidth = 10
+
+// CalibrationBucket compares how confident a member was with how often they were right,
+// over the predictions whose confidence falls within the bucket.
+type CalibrationBucket struct {
+	MinConfidence     int     `json:"minConfidence"`
+	MaxConfidence     int     `json:"maxConfidence"`
+	PredictionCount   int     `json:"predictionCount"`
+	AverageConfidence float64 `json:"averageConfidence"`
+	CorrectFraction   float64 `json:"correctFraction"`
+}
+
+// PredictionScore summarizes the scored predictions of one member.
+// BrierScore is the mean squared difference between confidence and outcome: 0 is perfect.
+type PredictionScore struct {
+	UserId             models.UserId        `json:"userId"`
+	Author             *models.User         `json:"author"`
+	PredictionCount    int                  `json:"predictionCount"`
+	BrierScore         float64              `json:"brierScore"`
+	CalibrationBuckets []*CalibrationBucket `json:"calibrationBuckets"`
+}
+
+// GetLeaderboard scores every member with at least one published prediction that has a confidence
+// and was resolved as correct or incorrect. Void predictions do not count. Best scores come first.
+// Only the members of the club are scored, or the viewer and the members of the viewer's clubs
+// when clubId is nil; the viewer must belong to the club. A nil bookId scores the predictions about every book.
+func GetLeaderboard(
+	viewerId models.UserId,
+	clubId *models.ClubId,
+	bookId *models.BookId,
+) ([]*PredictionScore, error) {
+	var clubIdAsInt *int64
+	if clubId != nil {
+		if _, err := clubservice.GetRoleOfUser(viewerId, *clubId); err != nil {
+			return nil, err
+		}
+
+		clubIdAsInt = new(int64)
+		*clubIdAsInt = int64(*clubId)
+	}
+
+	var bookIdAsInt *int64
+	if bookId != nil {
+		bookIdAsInt = new(int64)
+		*bookIdAsInt = int64(*bookId)
+	}
+
+	predictionRows, err := databaseutil.GetScoredPredictions(int64(viewerId), clubIdAsInt, bookIdAsInt)
+	if err != nil {
+		return nil, err
+	}
+
+	return scorePredictions(predictionRows), nil
+}
+
+// PRIVATE
+
+func scorePredictions(predictionRows []*databaseutil.ScoredPredictionRow) []*PredictionScore {
+	type bucketTotals struct {
+		predictionCount int
+		confidenceSum   float64
+		correctCount    int
+	}
+
+	type scoreTotals struct {
+		score               *PredictionScore
+		squaredErrorSum     float64
+		bucketTotalsByIndex map[int]*bucketTotals
+	}
+
+	scoreTotalsByUserId := make(map[models.UserId]*scoreTotals)
+
+	for _, predictionRow := range predictionRows {
+		userId := models.UserId(predictionRow.AuthorId)
+
+		totals, ok := scoreTotalsByUserId[userId]
+		if !ok {
+			totals = &scoreTotals{
+				score: &PredictionScore{
+					UserId: userId,
+					Author: &models.User{DisplayName: predictionRow.AuthorDisplayName},
+				},
+				bucketTotalsByIndex: make(map[int]*bucketTotals),
+			}
+			scoreTotalsByUserId[userId] = totals
+		}
+
+		probability := float64(predictionRow.Confidence) / 100
+		outcome := 0.0
+		if predictionRow.IsCorrect {
+			outcome = 1.0
+		}
+
+		totals.score.PredictionCount++
+		totals.squaredErrorSum += (probability - outcome) * (probability - outcome)
+
+		bucketIndex := int(predictionRow.Confidence) / calibrationBucketWidth
+		if bucketIndex*calibrationBucketWidth >= 100 {
+			// 100% shares the top bucket with 90-99%
+			bucketIndex--
+		}
+
+		bucket, ok := totals.bucketTotalsByIndex[bucketIndex]
+		if !ok {
+			bucket = new(bucketTotals)
+			totals.bucketTotalsByIndex[bucketIndex] = bucket
+		}
+
+		bucket.predictionCount++
+		bucket.confidenceSum += float64(predictionRow.Confidence)
+		if predictionRow.IsCorrect {
+			bucket.correctCount++
+		}
+	}
+
+	scores := make([]*PredictionScore, 0, len(scoreTotalsByUserId))
+	for _, totals := range scoreTotalsByUserId {
+		score := totals.score
+		score.BrierScore = totals.squaredErrorSum / float64(score.PredictionCount)
+		score.CalibrationBuckets = make([]*CalibrationBucket, 0, len(totals.bucketTotalsByIndex))
+
+		for bucketIndex := 0; bucketIndex*calibrationBucketWidth < 100; bucketIndex++ {
+			bucket, ok := totals.bucketTotalsByIndex[bucketIndex]
+			if !ok {
+				continue
+			}
+
+			maxConfidence := (bucketIndex+1)*calibrationBucketWidth - 1
+			if maxConfidence+1 >= 100 {
+				maxConfidence = 100
+			}
+
+			score.CalibrationBuckets = append(score.CalibrationBuckets, &CalibrationBucket{
+				MinConfidence:     bucketIndex * calibrationBucketWidth,
+				MaxConfidence:     maxConfidence,
+				PredictionCount:   bucket.predictionCount,
+				AverageConfidence: bucket.confidenceSum / float64(bucket.predictionCount),
+				CorrectFraction:   float64(bucket.correctCount) / float64(bucket.predictionCount),
+			})
+		}
+
+		scores = append(scores, score)
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].BrierScore != scores[j].BrierScore {
+			return scores[i].BrierScore < scores[j].BrierScore
+		}
+
+		if scores[i].PredictionCount != scores[j].PredictionCount {
+			return scores[i].PredictionCount > scores[j].PredictionCount
+		}
+
+		return scores[i].UserId < scores[j].UserId
+	})
+
+	return scores
+}
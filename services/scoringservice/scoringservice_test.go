@@ -0,0 +1,138 @@
+package scoringservice
+
+import (
+	"math"
+	"testing"
+
+	"github.com/atmiguel/cerealnotes/databaseutil"
+)
+
+func prediction(authorId int64, confidence int64, isCorrect bool) *databaseutil.ScoredPredictionRow {
+	return &databaseutil.ScoredPredictionRow{
+		AuthorId:          authorId,
+		AuthorDisplayName: "member",
+		Confidence:        confidence,
+		IsCorrect:         isCorrect,
+	}
+}
+
+func isClose(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestScorePredictionsWithoutPredictionsIsEmpty(t *testing.T) {
+	if scores := scorePredictions(nil); len(scores) != 0 {
+		t.Errorf("scored %d members without any prediction", len(scores))
+	}
+}
+
+func TestBrierScoreAtTheExtremes(t *testing.T) {
+	// Confidence 0 on something that did not happen is as good as 100 on something that did.
+	for _, predictionRow := range []*databaseutil.ScoredPredictionRow{
+		prediction(1, 100, true),
+		prediction(1, 0, false),
+	} {
+		if score := scorePredictions([]*databaseutil.ScoredPredictionRow{predictionRow})[0]; score.BrierScore != 0 {
+			t.Errorf("confidence %d with outcome %v scored %v, expected 0",
+				predictionRow.Confidence, predictionRow.IsCorrect, score.BrierScore)
+		}
+	}
+
+	for _, predictionRow := range []*databaseutil.ScoredPredictionRow{
+		prediction(1, 100, false),
+		prediction(1, 0, true),
+	} {
+		if score := scorePredictions([]*databaseutil.ScoredPredictionRow{predictionRow})[0]; score.BrierScore != 1 {
+			t.Errorf("confidence %d with outcome %v scored %v, expected 1",
+				predictionRow.Confidence, predictionRow.IsCorrect, score.BrierScore)
+		}
+	}
+}
+
+func TestBrierScoreIsTheMeanSquaredError(t *testing.T) {
+	scores := scorePredictions([]*databaseutil.ScoredPredictionRow{
+		prediction(1, 70, true),  // 0.3² = 0.09
+		prediction(1, 50, false), // 0.5² = 0.25
+		prediction(1, 20, false), // 0.2² = 0.04
+	})
+
+	if expected := (0.09 + 0.25 + 0.04) / 3; !isClose(scores[0].BrierScore, expected) {
+		t.Errorf("scored %v, expected %v", scores[0].BrierScore, expected)
+	}
+
+	if scores[0].PredictionCount != 3 {
+		t.Errorf("counted %d predictions, expected 3", scores[0].PredictionCount)
+	}
+}
+
+func TestCertaintySharesTheTopCalibrationBucket(t *testing.T) {
+	buckets := scorePredictions([]*databaseutil.ScoredPredictionRow{
+		prediction(1, 90, false),
+		prediction(1, 100, true),
+	})[0].CalibrationBuckets
+
+	if len(buckets) != 1 {
+		t.Fatalf("got %d buckets, expected 90 and 100 to share one", len(buckets))
+	}
+
+	bucket := buckets[0]
+	if bucket.MinConfidence != 90 || bucket.MaxConfidence != 100 {
+		t.Errorf("bucket spans %d-%d, expected 90-100", bucket.MinConfidence, bucket.MaxConfidence)
+	}
+
+	if bucket.PredictionCount != 2 || bucket.AverageConfidence != 95 || bucket.CorrectFraction != 0.5 {
+		t.Errorf("bucket holds %+v, expected 2 predictions averaging 95 and half of them correct", *bucket)
+	}
+}
+
+func TestCalibrationBucketsSkipEmptyRangesAndStayInOrder(t *testing.T) {
+	buckets := scorePredictions([]*databaseutil.ScoredPredictionRow{
+		prediction(1, 79, false),
+		prediction(1, 9, false),
+		prediction(1, 70, true),
+		prediction(1, 10, true),
+	})[0].CalibrationBuckets
+
+	expectedRanges := [][2]int{{0, 9}, {10, 19}, {70, 79}}
+	if len(buckets) != len(expectedRanges) {
+		t.Fatalf("got %d buckets, expected %d", len(buckets), len(expectedRanges))
+	}
+
+	for i, expectedRange := range expectedRanges {
+		if buckets[i].MinConfidence != expectedRange[0] || buckets[i].MaxConfidence != expectedRange[1] {
+			t.Errorf("bucket %d spans %d-%d, expected %d-%d",
+				i, buckets[i].MinConfidence, buckets[i].MaxConfidence, expectedRange[0], expectedRange[1])
+		}
+	}
+
+	if top := buckets[2]; top.AverageConfidence != 74.5 || top.CorrectFraction != 0.5 {
+		t.Errorf("the 70-79 bucket averages %v with %v correct, expected 74.5 and 0.5",
+			top.AverageConfidence, top.CorrectFraction)
+	}
+}
+
+func TestLeaderboardOrder(t *testing.T) {
+	scores := scorePredictions([]*databaseutil.ScoredPredictionRow{
+		// member 4 is the least accurate
+		prediction(4, 100, false),
+		// members 2 and 3 tie on accuracy, but member 3 made more predictions
+		prediction(2, 50, true),
+		prediction(3, 50, true),
+		prediction(3, 50, false),
+		// members 5 and 1 tie on both, so the lower id comes first
+		prediction(5, 100, true),
+		prediction(1, 0, false),
+	})
+
+	var userIds []int64
+	for _, score := range scores {
+		userIds = append(userIds, int64(score.UserId))
+	}
+
+	expectedUserIds := []int64{1, 5, 3, 2, 4}
+	for i := range expectedUserIds {
+		if i >= len(userIds) || userIds[i] != expectedUserIds[i] {
+			t.Fatalf("ranked %v, expected %v", userIds, expectedUserIds)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/atmiguel/cerealnotes/databaseutil"
 	"github.com/atmiguel/cerealnotes/models"
+	"github.com/atmiguel/cerealnotes/services/clubservice"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -46,6 +47,41 @@ func StoreNewUser(
 	return nil
 }
 
+// StoreNewUserJoiningClub creates a user who joins the invite's club at signup.
+// The user is not created if the invite can no longer be used.
+func StoreNewUserJoiningClub(
+	displayName string,
+	emailAddress *models.EmailAddress,
+	password string,
+	inviteId models.ClubInviteId,
+) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword(
+		[]byte(password),
+		bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := databaseutil.InsertUserRedeemingClubInvite(
+		displayName,
+		emailAddress.String(),
+		hashedPassword,
+		time.Now().UTC(),
+		int64(inviteId),
+	); err != nil {
+		switch err {
+		case databaseutil.UniqueConstraintError:
+			return EmailAddressAlreadyInUseError
+		case databaseutil.ClubInviteNotUsableError:
+			return clubservice.ClubInviteNotUsableError
+		}
+
+		return err
+	}
+
+	return nil
+}
+
 func AuthenticateUserCredentials(emailAddress *models.EmailAddress, password string) error {
 	storedHashedPassword, err := databaseutil.GetPasswordForUserWithEmailAddress(emailAddress.String())
 	if err != nil {
@@ -50,6 +50,9 @@ $(function() {
     var emailAddressField = 'emailAddress';
     var passwordField = 'password';
 
+    // set when arriving through a club invite link
+    var inviteToken = new URLSearchParams(window.location.search).get('invite');
+
     var signupFormMetadata = {
         $form: $('#signup-form'),
         fields: [displayNameField, emailAddressField, passwordField],
@@ -132,16 +135,29 @@ $(function() {
     };
 
     attachSubmitClickHandler(signupFormMetadata, (formDataAsJsonString) => {
+        if (inviteToken) {
+            var formData = JSON.parse(formDataAsJsonString);
+            formData.inviteToken = inviteToken;
+            formDataAsJsonString = JSON.stringify(formData);
+        }
+
         $.post('/api/user', formDataAsJsonString, (responseBody, _, $XmlHttpResponse) => {
             if ($XmlHttpResponse.status === 201) {
                 mui.tabs.activate('login-form');
-                alert('Successfully created user, please sign in');
+
+                if (inviteToken) {
+                    alert('Successfully created user and joined the club, please sign in');
+                } else {
+                    alert('Successfully created user, please sign in');
+                }
             } else {
                 alert('Unexpected successful status');
             }
         }).fail(($XmlHttpResponse) => {
             if ($XmlHttpResponse.status === 409) {
                 alert('Email address already in use');
+            } else if ($XmlHttpResponse.status === 410) {
+                alert('This invite link has expired, been revoked or been used up');
             } else {
                 alert('Unexpected error ' + $XmlHttpResponse.responseText);
             }
@@ -151,7 +167,11 @@ $(function() {
     attachSubmitClickHandler(loginFormMetadata, (formDataAsJsonString) => {
         $.post('/api/session', formDataAsJsonString, (responseBody, _, $XmlHttpResponse) => {
             if ($XmlHttpResponse.status === 201) {
-                location.reload();
+                if (inviteToken) {
+                    location.assign('/join-club?invite=' + encodeURIComponent(inviteToken));
+                } else {
+                    location.reload();
+                }
             } else {
                 alert('Error in logging in');
             }
@@ -24,9 +24,9 @@ const $createDivider = function() {
 
 const $createNote = function(note) {
     const $author = $createAuthor(note.authorId);
-    const $type = $createType(note.type);
+    const $type = $createType(note.category || 'uncategorized');
     const $creationTime = $createCreationTime(note.creationTime);
-    const $content = $createContent(note.content);
+    const $content = $createContent(note.isWithheld ? 'Hidden to avoid spoilers' : note.content);
 
     const $header = $('<div>').addClass('note-header')
         .append($author).append($createDivider())
@@ -42,12 +42,12 @@ $(function() {
     $.get('/api/user', function(usersById) {
         USERS_BY_ID = usersById;
 
-        $.get('/api/note', function(notes) {
+        $.get('/api/note', function(notesPage) {
             const $notes = $('#notes');
 
-            notes.forEach((note) => {
+            notesPage.noteIds.forEach((noteId) => {
                 $notes.append(
-                    $createNote(note)
+                    $createNote(notesPage.notesById[noteId])
                 );
             });
         });